@@ -0,0 +1,25 @@
+-- +goose Up
+CREATE TABLE url_daily_clicks (
+    url_id UUID NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    clicks INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (url_id, day)
+);
+
+-- carry over today's counters before the column goes away
+INSERT INTO url_daily_clicks (url_id, day, clicks)
+SELECT id, (now() AT TIME ZONE 'UTC')::date, daily_clicks
+FROM urls
+WHERE daily_clicks > 0;
+
+ALTER TABLE urls DROP COLUMN daily_clicks;
+
+-- +goose Down
+ALTER TABLE urls ADD COLUMN daily_clicks INT DEFAULT 0;
+
+UPDATE urls
+SET daily_clicks = d.clicks
+FROM url_daily_clicks d
+WHERE d.url_id = urls.id AND d.day = (now() AT TIME ZONE 'UTC')::date;
+
+DROP TABLE url_daily_clicks;
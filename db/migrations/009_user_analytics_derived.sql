@@ -0,0 +1,29 @@
+-- +goose Up
+-- user_analytics is now derived from urls, one row per user
+DELETE FROM user_analytics a
+USING user_analytics b
+WHERE a.user_id = b.user_id AND a.ctid > b.ctid;
+
+ALTER TABLE user_analytics ADD CONSTRAINT user_analytics_user_id_key UNIQUE (user_id);
+
+-- rebuild every row so the averages written by the old incremental update are fixed
+INSERT INTO user_analytics (user_id, total_urls, total_total_clicks, avg_daily_clicks, created_at, updated_at)
+SELECT
+    usr.id,
+    COUNT(l.id),
+    COALESCE(SUM(l.total_clicks), 0),
+    COALESCE(SUM(l.total_clicks), 0)::double precision
+        / GREATEST(EXTRACT(EPOCH FROM now() - usr.created_at) / 86400, 1)::double precision,
+    now(),
+    now()
+FROM users usr
+LEFT JOIN urls l ON l.user_id = usr.id
+GROUP BY usr.id, usr.created_at
+ON CONFLICT (user_id) DO UPDATE
+SET total_urls = EXCLUDED.total_urls,
+    total_total_clicks = EXCLUDED.total_total_clicks,
+    avg_daily_clicks = EXCLUDED.avg_daily_clicks,
+    updated_at = now();
+
+-- +goose Down
+ALTER TABLE user_analytics DROP CONSTRAINT user_analytics_user_id_key;
@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE digest_subscriptions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    frequency TEXT NOT NULL CHECK (frequency IN ('daily', 'weekly')),
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    unsubscribe_token TEXT NOT NULL UNIQUE,
+    last_sent_at TIMESTAMP with time zone,
+    created_at TIMESTAMP with time zone NOT NULL DEFAULT now(),
+    UNIQUE (user_id, email)
+);
+
+-- +goose Down
+DROP TABLE digest_subscriptions;
@@ -0,0 +1,31 @@
+-- +goose Up
+-- hour buckets (UTC, truncated in the app) for alerting on sub-day windows
+CREATE TABLE url_hourly_clicks (
+    url_id UUID NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    hour TIMESTAMP with time zone NOT NULL,
+    clicks INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (url_id, hour)
+);
+
+CREATE TABLE alert_rules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- NULL means the rule covers every link of the account
+    url_id UUID REFERENCES urls(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('threshold', 'no_clicks', 'spike')),
+    threshold DOUBLE PRECISION NOT NULL DEFAULT 0,
+    window_hours INT NOT NULL DEFAULT 1,
+    cooldown_minutes INT NOT NULL DEFAULT 60,
+    notify_email BOOLEAN NOT NULL DEFAULT true,
+    webhook_url TEXT,
+    webhook_secret TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    last_triggered_at TIMESTAMP with time zone,
+    created_at TIMESTAMP with time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX alert_rules_user_id_idx ON alert_rules (user_id);
+
+-- +goose Down
+DROP TABLE alert_rules;
+DROP TABLE url_hourly_clicks;
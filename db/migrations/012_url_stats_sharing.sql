@@ -0,0 +1,8 @@
+-- +goose Up
+ALTER TABLE urls ADD COLUMN stats_public BOOLEAN NOT NULL DEFAULT false;
+-- bumped to invalidate every share token issued for the link
+ALTER TABLE urls ADD COLUMN stats_share_version INT NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE urls DROP COLUMN stats_share_version;
+ALTER TABLE urls DROP COLUMN stats_public;
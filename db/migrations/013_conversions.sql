@@ -0,0 +1,38 @@
+-- +goose Up
+ALTER TABLE urls ADD COLUMN conversion_tracking BOOLEAN NOT NULL DEFAULT false;
+-- authenticates server-to-server postbacks, pixels rely on the click ID alone
+ALTER TABLE urls ADD COLUMN conversion_secret TEXT;
+
+-- one row per counted click on a link with conversion tracking on, the id is
+-- the click ID appended to the destination URL
+CREATE TABLE url_clicks (
+    id UUID PRIMARY KEY,
+    url_id UUID NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    clicked_at TIMESTAMP with time zone NOT NULL DEFAULT now(),
+    referrer TEXT NOT NULL DEFAULT '',
+    variant TEXT NOT NULL DEFAULT '',
+    country TEXT NOT NULL DEFAULT '',
+    device TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX url_clicks_url_id_clicked_at_idx ON url_clicks (url_id, clicked_at);
+
+CREATE TABLE conversions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    click_id UUID NOT NULL REFERENCES url_clicks(id) ON DELETE CASCADE,
+    url_id UUID NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    goal TEXT NOT NULL DEFAULT 'default',
+    value DOUBLE PRECISION NOT NULL DEFAULT 0,
+    source TEXT NOT NULL CHECK (source IN ('pixel', 'postback')),
+    created_at TIMESTAMP with time zone NOT NULL DEFAULT now(),
+    -- a reloaded pixel or retried postback counts once per goal
+    UNIQUE (click_id, goal)
+);
+
+CREATE INDEX conversions_url_id_idx ON conversions (url_id);
+
+-- +goose Down
+DROP TABLE conversions;
+DROP TABLE url_clicks;
+ALTER TABLE urls DROP COLUMN conversion_secret;
+ALTER TABLE urls DROP COLUMN conversion_tracking;
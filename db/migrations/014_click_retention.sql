@@ -0,0 +1,42 @@
+-- +goose Up
+-- accounts that opt out keep click IDs for conversions but no referrer,
+-- country, device or IP
+ALTER TABLE users ADD COLUMN no_personal_data BOOLEAN NOT NULL DEFAULT false;
+
+-- truncated or hashed in the app before it gets here, never the raw address
+ALTER TABLE url_clicks ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX url_clicks_clicked_at_idx ON url_clicks (clicked_at);
+
+-- raw clicks past retention are rolled up here (per UTC day) and deleted,
+-- their conversions along with them
+CREATE TABLE url_click_rollups (
+    url_id UUID NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    referrer TEXT NOT NULL DEFAULT '',
+    variant TEXT NOT NULL DEFAULT '',
+    clicks INT NOT NULL DEFAULT 0,
+    converted_clicks INT NOT NULL DEFAULT 0,
+    conversions INT NOT NULL DEFAULT 0,
+    value DOUBLE PRECISION NOT NULL DEFAULT 0,
+    PRIMARY KEY (url_id, day, referrer, variant)
+);
+
+-- what each purge deleted, for the legal/audit trail
+CREATE TABLE retention_runs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    ran_at TIMESTAMP with time zone NOT NULL DEFAULT now(),
+    cutoff TIMESTAMP with time zone NOT NULL,
+    clicks_deleted BIGINT NOT NULL DEFAULT 0,
+    conversions_deleted BIGINT NOT NULL DEFAULT 0,
+    rollup_rows BIGINT NOT NULL DEFAULT 0,
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    error TEXT
+);
+
+-- +goose Down
+DROP TABLE retention_runs;
+DROP TABLE url_click_rollups;
+DROP INDEX url_clicks_clicked_at_idx;
+ALTER TABLE url_clicks DROP COLUMN ip;
+ALTER TABLE users DROP COLUMN no_personal_data;
@@ -0,0 +1,35 @@
+-- +goose Up
+-- login used to put refresh tokens in password_reset_tokens (7 day expiry vs
+-- 10 minutes for resets), where either could be redeemed as the other
+DELETE FROM password_reset_tokens WHERE expiry - created_at > interval '1 hour';
+
+-- never used until now, rebuilt for hashed, rotating tokens
+DROP TABLE refresh_tokens;
+
+CREATE TABLE refresh_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- every token rotated from the same login shares a family
+    family_id UUID NOT NULL,
+    -- SHA-256 of the token, the token itself is only ever sent to the client
+    token_hash TEXT NOT NULL UNIQUE,
+    expiry TIMESTAMP with time zone NOT NULL,
+    created_at TIMESTAMP with time zone NOT NULL DEFAULT now(),
+    -- set when the token is exchanged; presenting it again is reuse
+    used_at TIMESTAMP with time zone,
+    revoked_at TIMESTAMP with time zone
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
+
+-- +goose Down
+DROP TABLE refresh_tokens;
+
+CREATE TABLE refresh_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    token TEXT NOT NULL UNIQUE,
+    expiry TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT now()
+);
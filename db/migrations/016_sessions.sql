@@ -0,0 +1,53 @@
+-- +goose Up
+-- one row per login; its refresh tokens are the token family and its access
+-- tokens are listed so they can be denylisted when it's revoked
+CREATE TABLE sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP with time zone NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMP with time zone NOT NULL DEFAULT now(),
+    -- pushed forward on every refresh, the session is dead once its refresh token is
+    expires_at TIMESTAMP with time zone NOT NULL,
+    revoked_at TIMESTAMP with time zone
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
+
+-- token families from before sessions existed become sessions of their own
+INSERT INTO sessions (id, user_id, created_at, last_used_at, expires_at, revoked_at)
+SELECT family_id,
+       user_id,
+       min(created_at),
+       max(created_at),
+       max(expiry),
+       CASE WHEN bool_and(revoked_at IS NOT NULL) THEN max(revoked_at) END
+FROM refresh_tokens
+GROUP BY family_id, user_id;
+
+ALTER TABLE refresh_tokens
+    ADD CONSTRAINT refresh_tokens_family_id_fkey FOREIGN KEY (family_id) REFERENCES sessions(id) ON DELETE CASCADE;
+
+-- every access token handed out, by jti
+CREATE TABLE access_tokens (
+    jti UUID PRIMARY KEY,
+    session_id UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    expiry TIMESTAMP with time zone NOT NULL
+);
+
+CREATE INDEX access_tokens_session_id_idx ON access_tokens (session_id);
+
+-- access tokens that must be refused before they expire; AuthMiddleware
+-- checks every request against it
+CREATE TABLE revoked_access_tokens (
+    jti UUID PRIMARY KEY,
+    expiry TIMESTAMP with time zone NOT NULL
+);
+
+-- +goose Down
+DROP TABLE revoked_access_tokens;
+DROP TABLE access_tokens;
+ALTER TABLE refresh_tokens DROP CONSTRAINT refresh_tokens_family_id_fkey;
+DROP TABLE sessions;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- personal API keys for scripts and CI, sent as Authorization: Bearer nano_...
+CREATE TABLE api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    -- first characters of the key, so it can be recognised in a list
+    prefix TEXT NOT NULL,
+    -- SHA-256 of the key, the key itself is only shown once
+    key_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL,
+    expires_at TIMESTAMP with time zone,
+    last_used_at TIMESTAMP with time zone,
+    created_at TIMESTAMP with time zone NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMP with time zone
+);
+
+CREATE INDEX api_keys_user_id_idx ON api_keys (user_id);
+
+-- +goose Down
+DROP TABLE api_keys;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- NULL until the owner follows the link mailed to them
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP with time zone;
+-- last verification mail, resends are throttled on it
+ALTER TABLE users ADD COLUMN verification_sent_at TIMESTAMP with time zone;
+
+-- accounts from before verification existed keep working as they did
+UPDATE users SET email_verified_at = created_at;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN verification_sent_at;
+ALTER TABLE users DROP COLUMN email_verified_at;
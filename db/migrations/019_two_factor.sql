@@ -0,0 +1,38 @@
+-- +goose Up
+-- TOTP (RFC 6238) second factor; unconfirmed until the first code checks out
+CREATE TABLE user_totp (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret TEXT NOT NULL,
+    confirmed_at TIMESTAMP with time zone,
+    -- last 30s time step a code was accepted for, so a code can't be replayed
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP with time zone NOT NULL DEFAULT now()
+);
+
+-- single-use codes for when the authenticator is lost, stored as SHA-256
+CREATE TABLE totp_recovery_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMP with time zone,
+    created_at TIMESTAMP with time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX totp_recovery_codes_user_id_idx ON totp_recovery_codes (user_id);
+
+-- password checked, second factor pending; exchanged for real tokens once
+CREATE TABLE login_challenges (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMP with time zone NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP with time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX login_challenges_user_id_idx ON login_challenges (user_id);
+
+-- +goose Down
+DROP TABLE login_challenges;
+DROP TABLE totp_recovery_codes;
+DROP TABLE user_totp;
@@ -0,0 +1,31 @@
+-- +goose Up
+-- accounts at external OpenID Connect providers, keyed by issuer and subject
+-- (the provider's stable user ID, unlike the email)
+CREATE TABLE user_identities (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    -- email the provider last reported, for display only
+    email TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP with time zone NOT NULL DEFAULT now(),
+    last_login_at TIMESTAMP with time zone NOT NULL DEFAULT now(),
+    UNIQUE (issuer, subject)
+);
+
+CREATE INDEX user_identities_user_id_idx ON user_identities (user_id);
+
+-- sign-ins sent to a provider and not back yet; the state parameter is the
+-- key, and the PKCE verifier and nonce are checked when the code comes back
+CREATE TABLE oidc_login_states (
+    state_hash TEXT PRIMARY KEY,
+    provider TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    code_verifier TEXT NOT NULL,
+    expires_at TIMESTAMP with time zone NOT NULL,
+    created_at TIMESTAMP with time zone NOT NULL DEFAULT now()
+);
+
+-- +goose Down
+DROP TABLE oidc_login_states;
+DROP TABLE user_identities;
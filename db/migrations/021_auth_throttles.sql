@@ -0,0 +1,24 @@
+-- +goose Up
+-- failed attempts at the auth endpoints, per client IP and per account
+-- (keyed by the SHA-256 of the email, so unknown emails are throttled the
+-- same way as real ones and can't be told apart)
+CREATE TABLE auth_throttles (
+    scope TEXT NOT NULL,
+    key TEXT NOT NULL,
+    -- the account an email bucket belongs to, when there is one
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP with time zone NOT NULL DEFAULT now(),
+    last_ip TEXT NOT NULL DEFAULT '',
+    -- no attempts are accepted until then (exponential backoff)
+    blocked_until TIMESTAMP with time zone,
+    -- set when the failures reached the lockout threshold and the owner was mailed
+    locked_at TIMESTAMP with time zone,
+    PRIMARY KEY (scope, key)
+);
+
+CREATE INDEX auth_throttles_last_failure_at_idx ON auth_throttles (last_failure_at);
+CREATE INDEX auth_throttles_user_id_idx ON auth_throttles (user_id);
+
+-- +goose Down
+DROP TABLE auth_throttles;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- a requested email change, applied once links mailed to both the current
+-- and the new address have been followed; one pending change per user
+CREATE TABLE email_changes (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    new_email TEXT NOT NULL,
+    old_token_hash TEXT NOT NULL UNIQUE,
+    new_token_hash TEXT NOT NULL UNIQUE,
+    old_confirmed_at TIMESTAMP with time zone,
+    new_confirmed_at TIMESTAMP with time zone,
+    expires_at TIMESTAMP with time zone NOT NULL,
+    created_at TIMESTAMP with time zone NOT NULL DEFAULT now()
+);
+
+-- +goose Down
+DROP TABLE email_changes;
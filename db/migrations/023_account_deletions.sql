@@ -0,0 +1,18 @@
+-- +goose Up
+-- a requested account deletion: confirmed from a mailed link, then carried
+-- out by the account deleter once delete_after has passed, unless cancelled
+CREATE TABLE account_deletions (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    requested_at TIMESTAMP with time zone NOT NULL DEFAULT now(),
+    -- the confirmation link stops working then
+    expires_at TIMESTAMP with time zone NOT NULL,
+    confirmed_at TIMESTAMP with time zone,
+    -- the end of the grace period, set on confirmation
+    delete_after TIMESTAMP with time zone
+);
+
+CREATE INDEX account_deletions_delete_after_idx ON account_deletions (delete_after);
+
+-- +goose Down
+DROP TABLE account_deletions;
@@ -0,0 +1,20 @@
+-- +goose Up
+-- support staff can look, admins can also act; everyone else is a user
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'support', 'admin'));
+-- suspended accounts can't sign in and their links stop redirecting
+ALTER TABLE users ADD COLUMN suspended_at TIMESTAMP with time zone;
+ALTER TABLE users ADD COLUMN suspension_reason TEXT NOT NULL DEFAULT '';
+
+-- links taken down by an admin answer 410 instead of redirecting
+ALTER TABLE urls ADD COLUMN disabled_at TIMESTAMP with time zone;
+ALTER TABLE urls ADD COLUMN disabled_reason TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX users_role_idx ON users (role) WHERE role <> 'user';
+
+-- +goose Down
+DROP INDEX users_role_idx;
+ALTER TABLE urls DROP COLUMN disabled_reason;
+ALTER TABLE urls DROP COLUMN disabled_at;
+ALTER TABLE users DROP COLUMN suspension_reason;
+ALTER TABLE users DROP COLUMN suspended_at;
+ALTER TABLE users DROP COLUMN role;
@@ -0,0 +1,59 @@
+-- +goose Up
+-- links are owned by a workspace. Every user has a personal one (deleted
+-- with them) and can create team workspaces to share with others.
+CREATE TABLE workspaces (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name TEXT NOT NULL,
+    personal_user_id UUID UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP with time zone NOT NULL DEFAULT now()
+);
+
+-- owners manage the workspace and its owners, admins manage members,
+-- editors manage links and viewers only read
+CREATE TABLE workspace_members (
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('owner', 'admin', 'editor', 'viewer')),
+    created_at TIMESTAMP with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (workspace_id, user_id)
+);
+
+CREATE INDEX workspace_members_user_id_idx ON workspace_members (user_id);
+
+-- a pending invitation, deleted once accepted; one per address and workspace
+CREATE TABLE workspace_invitations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    role TEXT NOT NULL CHECK (role IN ('admin', 'editor', 'viewer')),
+    token_hash TEXT NOT NULL UNIQUE,
+    invited_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP with time zone NOT NULL,
+    created_at TIMESTAMP with time zone NOT NULL DEFAULT now(),
+    UNIQUE (workspace_id, email)
+);
+
+-- user_id stays as the link's creator
+ALTER TABLE urls ADD COLUMN workspace_id UUID REFERENCES workspaces(id) ON DELETE CASCADE;
+
+INSERT INTO workspaces (name, personal_user_id)
+SELECT 'Personal', id FROM users;
+
+INSERT INTO workspace_members (workspace_id, user_id, role)
+SELECT id, personal_user_id, 'owner' FROM workspaces;
+
+UPDATE urls
+SET workspace_id = workspaces.id
+FROM workspaces
+WHERE workspaces.personal_user_id = urls.user_id;
+
+ALTER TABLE urls ALTER COLUMN workspace_id SET NOT NULL;
+
+CREATE INDEX urls_workspace_id_idx ON urls (workspace_id);
+
+-- +goose Down
+DROP INDEX urls_workspace_id_idx;
+ALTER TABLE urls DROP COLUMN workspace_id;
+DROP TABLE workspace_invitations;
+DROP TABLE workspace_members;
+DROP TABLE workspaces;
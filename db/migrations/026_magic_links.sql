@@ -0,0 +1,15 @@
+-- +goose Up
+-- emailed sign-in links waiting to be followed. Each is good once, names the
+-- address it was sent to, and only works in the browser holding the nonce
+-- cookie set when it was requested.
+CREATE TABLE magic_links (
+    token_hash TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    nonce_hash TEXT NOT NULL,
+    expires_at TIMESTAMP with time zone NOT NULL,
+    created_at TIMESTAMP with time zone NOT NULL DEFAULT now()
+);
+
+-- +goose Down
+DROP TABLE magic_links;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- digests only go to addresses that agreed to them. The account's own
+-- verified address is confirmed on the spot; any other gets a link first.
+ALTER TABLE digest_subscriptions
+    ADD COLUMN confirmed_at TIMESTAMP with time zone,
+    ADD COLUMN confirmation_token_hash TEXT UNIQUE,
+    ADD COLUMN confirmation_sent_at TIMESTAMP with time zone;
+
+-- subscriptions to someone else's address stay paused until confirmed
+UPDATE digest_subscriptions s
+SET confirmed_at = now()
+FROM users u
+WHERE u.id = s.user_id
+  AND lower(u.email) = lower(s.email)
+  AND u.email_verified_at IS NOT NULL;
+
+-- +goose Down
+ALTER TABLE digest_subscriptions
+    DROP COLUMN confirmation_sent_at,
+    DROP COLUMN confirmation_token_hash,
+    DROP COLUMN confirmed_at;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- sessions now store client IPs the way click-level data does. Addresses
+-- stored raw before that are truncated to their /24 (IPv4) or /48 (IPv6)
+-- network, the default CLICK_IP_MODE.
+UPDATE sessions
+SET ip = host(network(set_masklen(ip::inet, CASE WHEN family(ip::inet) = 4 THEN 24 ELSE 48 END)))
+WHERE ip ~ '^[0-9a-fA-F.:]+$' AND ip ~ '[.:]';
+
+-- +goose Down
+-- the full addresses are gone, there is nothing to restore
@@ -0,0 +1,44 @@
+-- +goose Up
+-- no-personal-data mode belongs to the workspace whose links collect the
+-- clicks, not to whoever created a link
+ALTER TABLE workspaces ADD COLUMN no_personal_data BOOLEAN NOT NULL DEFAULT false;
+
+-- users who had it on get their personal workspace now if they had none yet
+INSERT INTO workspaces (name, personal_user_id)
+SELECT 'Personal', id FROM users WHERE no_personal_data
+ON CONFLICT (personal_user_id) DO NOTHING;
+
+INSERT INTO workspace_members (workspace_id, user_id, role)
+SELECT w.id, w.personal_user_id, 'owner'
+FROM workspaces w
+JOIN users u ON u.id = w.personal_user_id
+WHERE u.no_personal_data
+ON CONFLICT (workspace_id, user_id) DO NOTHING;
+
+UPDATE workspaces w
+SET no_personal_data = true
+FROM users u
+WHERE u.id = w.personal_user_id AND u.no_personal_data;
+
+-- a team workspace holding links of someone who had it on keeps it on, so no
+-- link starts collecting personal data again
+UPDATE workspaces w
+SET no_personal_data = true
+WHERE w.personal_user_id IS NULL
+  AND EXISTS (
+      SELECT 1 FROM urls
+      JOIN users u ON u.id = urls.user_id
+      WHERE urls.workspace_id = w.id AND u.no_personal_data
+  );
+
+ALTER TABLE users DROP COLUMN no_personal_data;
+
+-- +goose Down
+ALTER TABLE users ADD COLUMN no_personal_data BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE users u
+SET no_personal_data = true
+FROM workspaces w
+WHERE w.personal_user_id = u.id AND w.no_personal_data;
+
+ALTER TABLE workspaces DROP COLUMN no_personal_data;
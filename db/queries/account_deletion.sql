@@ -0,0 +1,67 @@
+-- name: RequestAccountDeletion :execrows
+-- replaces an unconfirmed request, at most once a minute; no row means the
+-- last request is too recent or the deletion is already scheduled
+INSERT INTO account_deletions (user_id, token_hash, expires_at)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id) DO UPDATE
+SET token_hash = EXCLUDED.token_hash,
+    requested_at = now(),
+    expires_at = EXCLUDED.expires_at
+WHERE account_deletions.confirmed_at IS NULL
+  AND account_deletions.requested_at < now() - interval '1 minute';
+
+-- name: ConfirmAccountDeletion :one
+UPDATE account_deletions
+SET confirmed_at = now(), delete_after = $2
+WHERE token_hash = $1 AND confirmed_at IS NULL AND expires_at > now()
+RETURNING user_id, delete_after::timestamptz;
+
+-- name: GetAccountDeletion :one
+SELECT * FROM account_deletions WHERE user_id = $1;
+
+-- name: CancelAccountDeletion :execrows
+DELETE FROM account_deletions WHERE user_id = $1;
+
+-- name: ListDueAccountDeletions :many
+SELECT user_id FROM account_deletions
+WHERE delete_after <= now()
+ORDER BY delete_after
+LIMIT $1;
+
+-- name: DeleteScheduledUser :one
+-- everything the user owns goes with them (ON DELETE CASCADE); a deletion
+-- cancelled in the meantime leaves no row
+DELETE FROM users
+WHERE id = $1
+  AND EXISTS (SELECT 1 FROM account_deletions d WHERE d.user_id = users.id AND d.delete_after <= now())
+RETURNING email, pfp_url;
+
+-- name: ListSoleOwnedWorkspaces :many
+-- shared workspaces that would be left without an owner if the user went
+SELECT w.id, w.name
+FROM workspaces w
+JOIN workspace_members m ON m.workspace_id = w.id AND m.user_id = $1 AND m.role = 'owner'
+WHERE w.personal_user_id IS NULL
+  AND EXISTS (SELECT 1 FROM workspace_members o WHERE o.workspace_id = w.id AND o.user_id <> $1)
+  AND NOT EXISTS (SELECT 1 FROM workspace_members o WHERE o.workspace_id = w.id AND o.user_id <> $1 AND o.role = 'owner');
+
+-- name: TransferSharedWorkspaceURLs :many
+-- the links a departing user made in shared workspaces pass to the longest
+-- standing other owner of each; returns who got links, once per link
+UPDATE urls
+SET user_id = heirs.user_id
+FROM (
+    SELECT DISTINCT ON (workspace_id) workspace_id, user_id
+    FROM workspace_members
+    WHERE role = 'owner' AND user_id <> $1
+    ORDER BY workspace_id, created_at
+) AS heirs
+WHERE urls.workspace_id = heirs.workspace_id AND urls.user_id = $1
+RETURNING heirs.user_id;
+
+-- name: DeleteUnsharedWorkspaces :exec
+-- team workspaces the user is the only member of
+DELETE FROM workspaces w
+WHERE w.personal_user_id IS NULL
+  AND EXISTS (SELECT 1 FROM workspace_members m WHERE m.workspace_id = w.id AND m.user_id = $1)
+  AND NOT EXISTS (SELECT 1 FROM workspace_members m WHERE m.workspace_id = w.id AND m.user_id <> $1);
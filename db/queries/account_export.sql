@@ -0,0 +1,57 @@
+-- name: ExportUserURLs :many
+SELECT id, url, short_url, total_clicks, last_clicked, created_at, updated_at, stats_public, conversion_tracking
+FROM urls
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: ExportUserDailyClicks :many
+SELECT u.short_url, d.day, d.clicks
+FROM url_daily_clicks d
+JOIN urls u ON u.id = d.url_id
+WHERE u.user_id = $1
+ORDER BY u.short_url, d.day;
+
+-- name: ExportUserHourlyClicks :many
+SELECT u.short_url, h.hour, h.clicks
+FROM url_hourly_clicks h
+JOIN urls u ON u.id = h.url_id
+WHERE u.user_id = $1
+ORDER BY u.short_url, h.hour;
+
+-- name: ExportUserClicks :many
+SELECT c.id, u.short_url, c.clicked_at, c.referrer, c.variant, c.country, c.device, c.ip
+FROM url_clicks c
+JOIN urls u ON u.id = c.url_id
+WHERE u.user_id = $1
+ORDER BY c.clicked_at;
+
+-- name: ExportUserClickRollups :many
+SELECT u.short_url, r.day, r.referrer, r.variant, r.clicks, r.converted_clicks, r.conversions, r.value
+FROM url_click_rollups r
+JOIN urls u ON u.id = r.url_id
+WHERE u.user_id = $1
+ORDER BY u.short_url, r.day;
+
+-- name: ExportUserConversions :many
+SELECT cv.id, cv.click_id, u.short_url, cv.goal, cv.value, cv.source, cv.created_at
+FROM conversions cv
+JOIN urls u ON u.id = cv.url_id
+WHERE u.user_id = $1
+ORDER BY cv.created_at;
+
+-- name: ExportUserSessions :many
+-- revoked and expired ones too
+SELECT * FROM sessions
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: ExportUserAPIKeys :many
+SELECT * FROM api_keys
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: ExportUserAuthFailures :many
+SELECT scope, failures, last_failure_at, last_ip, blocked_until, locked_at
+FROM auth_throttles
+WHERE user_id = $1
+ORDER BY last_failure_at;
@@ -0,0 +1,73 @@
+-- name: GetActiveUserRole :one
+-- no row for a suspended or deleted account
+SELECT role FROM users WHERE id = $1 AND suspended_at IS NULL;
+
+-- name: SearchUsers :many
+-- search matches part of the email or username; NULL filters match everyone
+SELECT u.id, u.username, u.email, u.role, u.created_at, u.email_verified_at, u.suspended_at, u.suspension_reason,
+       (SELECT COUNT(*) FROM urls WHERE urls.user_id = u.id)::int AS links
+FROM users u
+WHERE (sqlc.arg(search)::text = '' OR u.email ILIKE '%' || sqlc.arg(search)::text || '%' OR u.username ILIKE '%' || sqlc.arg(search)::text || '%')
+  AND (sqlc.narg(role)::text IS NULL OR u.role = sqlc.narg(role)::text)
+  AND (sqlc.narg(suspended)::bool IS NULL OR (u.suspended_at IS NOT NULL) = sqlc.narg(suspended)::bool)
+ORDER BY u.created_at DESC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: SuspendUser :execrows
+UPDATE users
+SET suspended_at = now(), suspension_reason = $2, updated_at = now()
+WHERE id = $1 AND suspended_at IS NULL;
+
+-- name: UnsuspendUser :execrows
+UPDATE users
+SET suspended_at = NULL, suspension_reason = '', updated_at = now()
+WHERE id = $1 AND suspended_at IS NOT NULL;
+
+-- name: SetUserRole :execrows
+UPDATE users SET role = $2, updated_at = now() WHERE id = $1;
+
+-- name: SearchURLs :many
+-- search matches part of the slug or destination
+SELECT l.id, l.url, l.short_url, l.total_clicks, l.last_clicked, l.created_at, l.disabled_at, l.disabled_reason,
+       u.id AS owner_id, u.username AS owner_username, u.email AS owner_email
+FROM urls l
+JOIN users u ON u.id = l.user_id
+WHERE (sqlc.arg(search)::text = '' OR l.short_url ILIKE '%' || sqlc.arg(search)::text || '%' OR l.url ILIKE '%' || sqlc.arg(search)::text || '%')
+  AND (sqlc.narg(owner_id)::uuid IS NULL OR l.user_id = sqlc.narg(owner_id)::uuid)
+  AND (sqlc.narg(disabled)::bool IS NULL OR (l.disabled_at IS NOT NULL) = sqlc.narg(disabled)::bool)
+ORDER BY l.created_at DESC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: GetURLWithOwner :one
+SELECT l.id, l.url, l.short_url, l.total_clicks, l.last_clicked, l.created_at, l.updated_at,
+       l.stats_public, l.conversion_tracking, l.disabled_at, l.disabled_reason,
+       u.id AS owner_id, u.username AS owner_username, u.email AS owner_email, u.suspended_at AS owner_suspended_at
+FROM urls l
+JOIN users u ON u.id = l.user_id
+WHERE l.short_url = $1;
+
+-- name: DisableURL :execrows
+UPDATE urls
+SET disabled_at = now(), disabled_reason = $2
+WHERE short_url = $1 AND disabled_at IS NULL;
+
+-- name: EnableURL :execrows
+UPDATE urls
+SET disabled_at = NULL, disabled_reason = ''
+WHERE short_url = $1 AND disabled_at IS NOT NULL;
+
+-- name: GetSystemStats :one
+SELECT
+    (SELECT COUNT(*) FROM users)::int AS users,
+    (SELECT COUNT(*) FROM users WHERE email_verified_at IS NOT NULL)::int AS verified_users,
+    (SELECT COUNT(*) FROM users WHERE suspended_at IS NOT NULL)::int AS suspended_users,
+    (SELECT COUNT(*) FROM users WHERE created_at > now() - interval '1 day')::int AS signups_last_day,
+    (SELECT COUNT(*) FROM users WHERE created_at > now() - interval '7 days')::int AS signups_last_week,
+    (SELECT COUNT(*) FROM urls)::int AS links,
+    (SELECT COUNT(*) FROM urls WHERE disabled_at IS NOT NULL)::int AS disabled_links,
+    (SELECT COUNT(*) FROM urls WHERE created_at > now() - interval '1 day')::int AS links_last_day,
+    (SELECT COALESCE(SUM(total_clicks), 0) FROM urls)::bigint AS total_clicks,
+    (SELECT COALESCE(SUM(clicks), 0) FROM url_daily_clicks WHERE day = (now() AT TIME ZONE 'UTC')::date)::bigint AS clicks_today,
+    (SELECT COUNT(*) FROM sessions WHERE revoked_at IS NULL AND expires_at > now())::int AS active_sessions,
+    (SELECT COUNT(*) FROM api_keys WHERE revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now()))::int AS active_api_keys,
+    (SELECT COUNT(*) FROM account_deletions WHERE delete_after IS NOT NULL)::int AS scheduled_deletions;
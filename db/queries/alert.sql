@@ -0,0 +1,33 @@
+-- name: CreateAlertRule :one
+INSERT INTO alert_rules (user_id, url_id, kind, threshold, window_hours, cooldown_minutes, notify_email, webhook_url, webhook_secret)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING id, user_id, url_id, kind, threshold, window_hours, cooldown_minutes, notify_email, webhook_url, webhook_secret, enabled, last_triggered_at, created_at;
+
+-- name: ListAlertRulesByUser :many
+SELECT r.id, r.user_id, r.url_id, r.kind, r.threshold, r.window_hours, r.cooldown_minutes, r.notify_email, r.webhook_url, r.enabled, r.last_triggered_at, r.created_at, u.short_url
+FROM alert_rules r
+LEFT JOIN urls u ON u.id = r.url_id
+WHERE r.user_id = $1
+ORDER BY r.created_at;
+
+-- name: DeleteAlertRule :execrows
+DELETE FROM alert_rules WHERE id = $1 AND user_id = $2;
+
+-- name: ListEnabledAlertRules :many
+-- rules on a link only count while their owner is still in its workspace
+SELECT r.id, r.user_id, r.url_id, r.kind, r.threshold, r.window_hours, r.cooldown_minutes, r.notify_email, r.webhook_url, r.webhook_secret, r.last_triggered_at, r.created_at,
+       usr.email, u.short_url, u.created_at AS url_created_at
+FROM alert_rules r
+JOIN users usr ON usr.id = r.user_id
+LEFT JOIN urls u ON u.id = r.url_id
+WHERE r.enabled
+  AND (r.url_id IS NULL OR EXISTS (
+      SELECT 1 FROM workspace_members m
+      WHERE m.workspace_id = u.workspace_id AND m.user_id = r.user_id
+  ));
+
+-- name: ClaimAlertTrigger :execrows
+UPDATE alert_rules
+SET last_triggered_at = now()
+WHERE id = $1
+  AND (last_triggered_at IS NULL OR last_triggered_at < now() - make_interval(mins => cooldown_minutes));
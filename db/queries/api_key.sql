@@ -0,0 +1,33 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: ListUserAPIKeys :many
+SELECT * FROM api_keys
+WHERE user_id = $1 AND revoked_at IS NULL
+ORDER BY created_at DESC;
+
+-- name: CountUserAPIKeys :one
+SELECT COUNT(*)::int FROM api_keys
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET revoked_at = now()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: GetActiveAPIKeyByHash :one
+-- keys of suspended accounts stop working with them
+SELECT id, user_id, scopes
+FROM api_keys
+WHERE key_hash = $1
+  AND revoked_at IS NULL
+  AND (expires_at IS NULL OR expires_at > now())
+  AND NOT EXISTS (SELECT 1 FROM users WHERE users.id = api_keys.user_id AND users.suspended_at IS NOT NULL);
+
+-- name: TouchAPIKey :exec
+-- last use is tracked to the minute, so a busy key isn't a write per request
+UPDATE api_keys
+SET last_used_at = now()
+WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute');
@@ -0,0 +1,43 @@
+-- name: GetAuthThrottleBlock :one
+-- no row means attempts are accepted
+SELECT blocked_until::timestamptz FROM auth_throttles
+WHERE scope = $1 AND key = $2 AND blocked_until > now();
+
+-- name: RecordAuthFailure :one
+-- counts a failure; failures from before reset_before are forgotten, and a
+-- lockout ends with them
+INSERT INTO auth_throttles (scope, key, user_id, failures, last_failure_at, last_ip)
+VALUES ($1, $2, $3, 1, now(), $4)
+ON CONFLICT (scope, key) DO UPDATE
+SET failures = CASE WHEN auth_throttles.last_failure_at < sqlc.arg(reset_before) THEN 1 ELSE auth_throttles.failures + 1 END,
+    locked_at = CASE WHEN auth_throttles.last_failure_at < sqlc.arg(reset_before) THEN NULL ELSE auth_throttles.locked_at END,
+    user_id = COALESCE(EXCLUDED.user_id, auth_throttles.user_id),
+    last_failure_at = now(),
+    last_ip = EXCLUDED.last_ip
+RETURNING failures;
+
+-- name: BlockAuthThrottle :exec
+UPDATE auth_throttles SET blocked_until = $3
+WHERE scope = $1 AND key = $2;
+
+-- name: LockAuthThrottle :execrows
+-- one row the first time an account crosses the lockout threshold
+UPDATE auth_throttles SET locked_at = now()
+WHERE scope = $1 AND key = $2 AND locked_at IS NULL;
+
+-- name: ClearAuthThrottle :exec
+DELETE FROM auth_throttles WHERE scope = $1 AND key = $2;
+
+-- name: ClearUserAuthThrottles :execrows
+DELETE FROM auth_throttles WHERE user_id = $1;
+
+-- name: DeleteStaleAuthThrottles :exec
+DELETE FROM auth_throttles
+WHERE last_failure_at < $1 AND (blocked_until IS NULL OR blocked_until < now());
+
+-- name: ListLockedAccounts :many
+SELECT t.user_id, u.username, u.email, t.failures, t.locked_at, t.blocked_until, t.last_failure_at, t.last_ip
+FROM auth_throttles t
+JOIN users u ON u.id = t.user_id
+WHERE t.scope = $1 AND t.locked_at IS NOT NULL AND t.blocked_until > now()
+ORDER BY t.locked_at DESC;
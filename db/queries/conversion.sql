@@ -0,0 +1,115 @@
+-- name: CreateURLClick :exec
+-- writes a click still waiting in the aggregator's buffer early, for a
+-- conversion that came in first; the buffered copy is then skipped
+INSERT INTO url_clicks (id, url_id, clicked_at, referrer, variant, country, device, ip)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (id) DO NOTHING;
+
+-- name: CreateURLClicks :exec
+-- the aggregator's batch of tracked clicks. Links deleted since are skipped
+-- like in the click buckets, and clicks already written are left alone.
+INSERT INTO url_clicks (id, url_id, clicked_at, referrer, variant, country, device, ip)
+SELECT b.id, b.url_id, b.clicked_at, b.referrer, b.variant, b.country, b.device, b.ip
+FROM unnest(
+    sqlc.arg(ids)::uuid[],
+    sqlc.arg(url_ids)::uuid[],
+    sqlc.arg(clicked_at)::timestamptz[],
+    sqlc.arg(referrers)::text[],
+    sqlc.arg(variants)::text[],
+    sqlc.arg(countries)::text[],
+    sqlc.arg(devices)::text[],
+    sqlc.arg(ips)::text[]
+) AS b(id, url_id, clicked_at, referrer, variant, country, device, ip)
+JOIN urls ON urls.id = b.url_id
+FOR KEY SHARE OF urls
+ON CONFLICT (id) DO NOTHING;
+
+-- name: SetURLConversionTracking :one
+UPDATE urls
+SET conversion_tracking = sqlc.arg(conversion_tracking),
+    conversion_secret = CASE
+        WHEN sqlc.arg(rotate_secret)::bool OR conversion_secret IS NULL THEN sqlc.arg(new_secret)::text
+        ELSE conversion_secret
+    END
+WHERE id = sqlc.arg(id)
+RETURNING conversion_tracking, conversion_secret;
+
+-- name: GetClickForConversion :one
+SELECT c.id, c.url_id, u.conversion_tracking, u.conversion_secret
+FROM url_clicks c
+JOIN urls u ON u.id = c.url_id
+WHERE c.id = $1 AND u.short_url = $2;
+
+-- name: RecordConversion :execrows
+INSERT INTO conversions (click_id, url_id, goal, value, source)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (click_id, goal) DO NOTHING;
+
+-- name: GetURLConversionStats :one
+SELECT COALESCE(SUM(s.tracked_clicks), 0)::int AS tracked_clicks,
+       COALESCE(SUM(s.converted_clicks), 0)::int AS converted_clicks,
+       COALESCE(SUM(s.conversions), 0)::int AS conversions,
+       COALESCE(SUM(s.value), 0)::float8 AS value
+FROM (
+    SELECT COUNT(DISTINCT c.id) AS tracked_clicks,
+           COUNT(DISTINCT cv.click_id) AS converted_clicks,
+           COUNT(cv.id) AS conversions,
+           SUM(cv.value) AS value
+    FROM url_clicks c
+    JOIN urls u ON u.id = c.url_id
+    LEFT JOIN conversions cv ON cv.click_id = c.id
+    WHERE u.short_url = $1 AND c.clicked_at >= $2
+    UNION ALL
+    -- clicks past retention only survive as daily rollups
+    SELECT SUM(r.clicks), SUM(r.converted_clicks), SUM(r.conversions), SUM(r.value)
+    FROM url_click_rollups r
+    JOIN urls u ON u.id = r.url_id
+    WHERE u.short_url = $1 AND r.day >= $2::date
+) s;
+
+-- name: GetURLConversionsByReferrer :many
+SELECT s.referrer,
+       SUM(s.tracked_clicks)::int AS tracked_clicks,
+       SUM(s.converted_clicks)::int AS converted_clicks
+FROM (
+    SELECT c.referrer,
+           COUNT(DISTINCT c.id) AS tracked_clicks,
+           COUNT(DISTINCT cv.click_id) AS converted_clicks
+    FROM url_clicks c
+    JOIN urls u ON u.id = c.url_id
+    LEFT JOIN conversions cv ON cv.click_id = c.id
+    WHERE u.short_url = $1 AND c.clicked_at >= $2
+    GROUP BY c.referrer
+    UNION ALL
+    SELECT r.referrer, SUM(r.clicks), SUM(r.converted_clicks)
+    FROM url_click_rollups r
+    JOIN urls u ON u.id = r.url_id
+    WHERE u.short_url = $1 AND r.day >= $2::date
+    GROUP BY r.referrer
+) s
+GROUP BY s.referrer
+ORDER BY tracked_clicks DESC
+LIMIT 20;
+
+-- name: GetURLConversionsByVariant :many
+SELECT s.variant,
+       SUM(s.tracked_clicks)::int AS tracked_clicks,
+       SUM(s.converted_clicks)::int AS converted_clicks
+FROM (
+    SELECT c.variant,
+           COUNT(DISTINCT c.id) AS tracked_clicks,
+           COUNT(DISTINCT cv.click_id) AS converted_clicks
+    FROM url_clicks c
+    JOIN urls u ON u.id = c.url_id
+    LEFT JOIN conversions cv ON cv.click_id = c.id
+    WHERE u.short_url = $1 AND c.clicked_at >= $2
+    GROUP BY c.variant
+    UNION ALL
+    SELECT r.variant, SUM(r.clicks), SUM(r.converted_clicks)
+    FROM url_click_rollups r
+    JOIN urls u ON u.id = r.url_id
+    WHERE u.short_url = $1 AND r.day >= $2::date
+    GROUP BY r.variant
+) s
+GROUP BY s.variant
+ORDER BY s.variant;
@@ -0,0 +1,82 @@
+-- name: UpsertDigestSubscription :one
+-- an address confirmed once stays confirmed
+INSERT INTO digest_subscriptions (user_id, email, frequency, timezone, unsubscribe_token, last_sent_at, confirmed_at)
+VALUES (
+    sqlc.arg(user_id), sqlc.arg(email), sqlc.arg(frequency), sqlc.arg(timezone), sqlc.arg(unsubscribe_token), now(),
+    CASE WHEN sqlc.arg(confirmed)::bool THEN now() END
+)
+ON CONFLICT (user_id, email) DO UPDATE
+SET frequency = EXCLUDED.frequency,
+    timezone = EXCLUDED.timezone,
+    confirmed_at = COALESCE(digest_subscriptions.confirmed_at, EXCLUDED.confirmed_at)
+RETURNING id, user_id, email, frequency, timezone, unsubscribe_token, last_sent_at, created_at, confirmed_at, confirmation_token_hash, confirmation_sent_at;
+
+-- name: CountPendingDigestSubscriptions :one
+-- unconfirmed addresses other than this one
+SELECT COUNT(*)::int AS pending FROM digest_subscriptions
+WHERE user_id = $1 AND confirmed_at IS NULL AND email <> $2;
+
+-- name: ClaimDigestConfirmation :execrows
+-- at most one confirmation mail an hour per address; no row means it's
+-- confirmed already or the last mail is too recent
+UPDATE digest_subscriptions
+SET confirmation_token_hash = $2, confirmation_sent_at = now()
+WHERE id = $1
+  AND confirmed_at IS NULL
+  AND (confirmation_sent_at IS NULL OR confirmation_sent_at < now() - interval '1 hour');
+
+-- name: ConfirmDigestSubscription :one
+-- confirmation links work for a week
+UPDATE digest_subscriptions
+SET confirmed_at = now(), confirmation_token_hash = NULL
+WHERE confirmation_token_hash = $1
+  AND confirmed_at IS NULL
+  AND confirmation_sent_at > now() - interval '7 days'
+RETURNING email, frequency;
+
+-- name: ListDigestSubscriptionsByUser :many
+SELECT id, user_id, email, frequency, timezone, unsubscribe_token, last_sent_at, created_at, confirmed_at, confirmation_token_hash, confirmation_sent_at
+FROM digest_subscriptions
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: ListDigestSubscriptions :many
+-- only confirmed addresses get digests
+SELECT s.id, s.user_id, s.email, s.frequency, s.timezone, s.unsubscribe_token, s.last_sent_at, u.username
+FROM digest_subscriptions s
+JOIN users u ON u.id = s.user_id
+WHERE s.confirmed_at IS NOT NULL;
+
+-- name: DeleteDigestSubscription :execrows
+DELETE FROM digest_subscriptions WHERE id = $1 AND user_id = $2;
+
+-- name: UnsubscribeDigest :execrows
+DELETE FROM digest_subscriptions WHERE unsubscribe_token = $1;
+
+-- name: ClaimDigest :execrows
+UPDATE digest_subscriptions
+SET last_sent_at = now()
+WHERE id = $1 AND (last_sent_at IS NULL OR last_sent_at < $2);
+
+-- name: ReleaseDigest :exec
+UPDATE digest_subscriptions
+SET last_sent_at = $2
+WHERE id = $1;
+
+-- name: GetDigestLinkClicks :many
+-- the links in the subscriber's workspaces, from the hourly buckets since the
+-- period is the subscriber's local days and daily buckets are UTC dates
+SELECT
+    u.short_url,
+    u.url,
+    u.created_at,
+    COALESCE(SUM(h.clicks) FILTER (WHERE h.hour >= sqlc.arg(period_start)::timestamptz), 0)::int AS clicks,
+    COALESCE(SUM(h.clicks) FILTER (WHERE h.hour < sqlc.arg(period_start)::timestamptz), 0)::int AS previous_clicks
+FROM urls u
+LEFT JOIN url_hourly_clicks h
+    ON h.url_id = u.id
+    AND h.hour >= sqlc.arg(previous_start)::timestamptz
+    AND h.hour < sqlc.arg(period_end)::timestamptz
+WHERE u.workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = sqlc.arg(user_id))
+GROUP BY u.id
+ORDER BY clicks DESC;
@@ -0,0 +1,28 @@
+-- name: StartEmailChange :execrows
+-- replaces any pending change, at most once a minute; no row means the last
+-- request is too recent
+INSERT INTO email_changes (user_id, new_email, old_token_hash, new_token_hash, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (user_id) DO UPDATE
+SET new_email = EXCLUDED.new_email,
+    old_token_hash = EXCLUDED.old_token_hash,
+    new_token_hash = EXCLUDED.new_token_hash,
+    old_confirmed_at = NULL,
+    new_confirmed_at = NULL,
+    expires_at = EXCLUDED.expires_at,
+    created_at = now()
+WHERE email_changes.created_at < now() - interval '1 minute';
+
+-- name: ConfirmEmailChange :one
+-- marks whichever side the token was mailed to as confirmed
+UPDATE email_changes
+SET old_confirmed_at = CASE WHEN old_token_hash = sqlc.arg(token_hash) THEN COALESCE(old_confirmed_at, now()) ELSE old_confirmed_at END,
+    new_confirmed_at = CASE WHEN new_token_hash = sqlc.arg(token_hash) THEN COALESCE(new_confirmed_at, now()) ELSE new_confirmed_at END
+WHERE (old_token_hash = sqlc.arg(token_hash) OR new_token_hash = sqlc.arg(token_hash)) AND expires_at > now()
+RETURNING user_id, new_email, (old_confirmed_at IS NOT NULL AND new_confirmed_at IS NOT NULL)::bool AS complete;
+
+-- name: GetPendingEmailChange :one
+SELECT * FROM email_changes WHERE user_id = $1 AND expires_at > now();
+
+-- name: DeleteEmailChange :exec
+DELETE FROM email_changes WHERE user_id = $1;
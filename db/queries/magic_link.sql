@@ -0,0 +1,18 @@
+-- name: CreateMagicLink :exec
+INSERT INTO magic_links (token_hash, user_id, email, nonce_hash, expires_at)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: ConsumeMagicLink :one
+-- a link is good for one sign-in, from the browser that asked for it, and
+-- is void once the account's email changes
+DELETE FROM magic_links
+USING users
+WHERE magic_links.token_hash = $1
+  AND magic_links.nonce_hash = $2
+  AND magic_links.expires_at > now()
+  AND users.id = magic_links.user_id
+  AND users.email = magic_links.email
+RETURNING magic_links.user_id, magic_links.email;
+
+-- name: DeleteExpiredMagicLinks :exec
+DELETE FROM magic_links WHERE expires_at < now();
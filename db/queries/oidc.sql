@@ -0,0 +1,28 @@
+-- name: CreateOIDCLoginState :exec
+INSERT INTO oidc_login_states (state_hash, provider, nonce, code_verifier, expires_at)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: ConsumeOIDCLoginState :one
+-- a state is good for one callback
+DELETE FROM oidc_login_states
+WHERE state_hash = $1 AND expires_at > now()
+RETURNING provider, nonce, code_verifier;
+
+-- name: DeleteExpiredOIDCLoginStates :exec
+DELETE FROM oidc_login_states WHERE expires_at < now();
+
+-- name: LoginUserIdentity :one
+-- the account an external identity is linked to, noting the sign-in
+UPDATE user_identities
+SET last_login_at = now(), email = $3
+WHERE issuer = $1 AND subject = $2
+RETURNING user_id;
+
+-- name: LinkUserIdentity :exec
+INSERT INTO user_identities (user_id, issuer, subject, email)
+VALUES ($1, $2, $3, $4);
+
+-- name: ListUserIdentities :many
+SELECT * FROM user_identities
+WHERE user_id = $1
+ORDER BY created_at;
@@ -1,3 +1,17 @@
 -- name: StoreRefreshToken :exec
-INSERT INTO refresh_tokens (user_id, token, expiry)
-VALUES ($1, $2, $3);
+INSERT INTO refresh_tokens (user_id, family_id, token_hash, expiry)
+VALUES ($1, $2, $3, $4);
+
+-- name: ClaimRefreshToken :one
+UPDATE refresh_tokens
+SET used_at = now()
+WHERE token_hash = $1
+  AND used_at IS NULL
+  AND revoked_at IS NULL
+  AND expiry > now()
+RETURNING id, user_id, family_id;
+
+-- name: GetRefreshTokenByHash :one
+SELECT id, user_id, family_id, expiry, used_at, revoked_at
+FROM refresh_tokens
+WHERE token_hash = $1;
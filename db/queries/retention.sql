@@ -0,0 +1,54 @@
+-- name: SetWorkspaceNoPersonalData :one
+UPDATE workspaces
+SET no_personal_data = $2
+WHERE id = $1
+RETURNING no_personal_data;
+
+-- name: ScrubWorkspaceClickData :execrows
+-- every link in the workspace, whoever created it
+UPDATE url_clicks c
+SET referrer = '', country = '', device = '', ip = ''
+FROM urls u
+WHERE u.id = c.url_id
+  AND u.workspace_id = $1
+  AND (c.referrer <> '' OR c.country <> '' OR c.device <> '' OR c.ip <> '');
+
+-- name: RollupExpiredClicks :execrows
+INSERT INTO url_click_rollups (url_id, day, referrer, variant, clicks, converted_clicks, conversions, value)
+SELECT c.url_id,
+       (c.clicked_at AT TIME ZONE 'UTC')::date,
+       c.referrer,
+       c.variant,
+       COUNT(DISTINCT c.id),
+       COUNT(DISTINCT cv.click_id),
+       COUNT(cv.id),
+       COALESCE(SUM(cv.value), 0)
+FROM url_clicks c
+LEFT JOIN conversions cv ON cv.click_id = c.id
+WHERE c.clicked_at < $1
+GROUP BY 1, 2, 3, 4
+ON CONFLICT (url_id, day, referrer, variant) DO UPDATE
+SET clicks = url_click_rollups.clicks + EXCLUDED.clicks,
+    converted_clicks = url_click_rollups.converted_clicks + EXCLUDED.converted_clicks,
+    conversions = url_click_rollups.conversions + EXCLUDED.conversions,
+    value = url_click_rollups.value + EXCLUDED.value;
+
+-- name: CountExpiredConversions :one
+SELECT COUNT(*)
+FROM conversions cv
+JOIN url_clicks c ON c.id = cv.click_id
+WHERE c.clicked_at < $1;
+
+-- name: DeleteExpiredClicks :execrows
+DELETE FROM url_clicks WHERE clicked_at < $1;
+
+-- name: CreateRetentionRun :one
+INSERT INTO retention_runs (cutoff, clicks_deleted, conversions_deleted, rollup_rows, duration_ms, error)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, ran_at, cutoff, clicks_deleted, conversions_deleted, rollup_rows, duration_ms, error;
+
+-- name: ListRetentionRuns :many
+SELECT id, ran_at, cutoff, clicks_deleted, conversions_deleted, rollup_rows, duration_ms, error
+FROM retention_runs
+ORDER BY ran_at DESC
+LIMIT $1;
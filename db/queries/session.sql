@@ -0,0 +1,53 @@
+-- name: CreateSession :one
+INSERT INTO sessions (user_id, device, ip, user_agent, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id;
+
+-- name: TouchSession :exec
+UPDATE sessions
+SET last_used_at = now(), ip = $2, expires_at = $3
+WHERE id = $1;
+
+-- name: ListUserSessions :many
+SELECT * FROM sessions
+WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > now()
+ORDER BY last_used_at DESC;
+
+-- name: RevokeSessions :many
+-- revokes one of the user's sessions, or all of them when id is NULL, along
+-- with their refresh tokens and every access token they still have live
+WITH revoked AS (
+    UPDATE sessions
+    SET revoked_at = now()
+    WHERE user_id = sqlc.arg(user_id)
+      AND (sqlc.narg(id)::uuid IS NULL OR id = sqlc.narg(id)::uuid)
+      AND revoked_at IS NULL
+    RETURNING id
+), revoked_refresh AS (
+    UPDATE refresh_tokens
+    SET revoked_at = now()
+    WHERE family_id IN (SELECT id FROM revoked) AND revoked_at IS NULL
+), denied AS (
+    INSERT INTO revoked_access_tokens (jti, expiry)
+    SELECT jti, expiry FROM access_tokens
+    WHERE session_id IN (SELECT id FROM revoked) AND expiry > now()
+    ON CONFLICT DO NOTHING
+)
+SELECT id FROM revoked;
+
+-- name: DeleteExpiredSessions :exec
+-- the user's dead sessions (their tokens cascade), plus any access token
+-- bookkeeping that has outlived the tokens themselves
+WITH expired_access AS (
+    DELETE FROM access_tokens WHERE expiry < now()
+), expired_denied AS (
+    DELETE FROM revoked_access_tokens WHERE expiry < now()
+)
+DELETE FROM sessions WHERE user_id = $1 AND expires_at < now();
+
+-- name: StoreAccessToken :exec
+INSERT INTO access_tokens (jti, session_id, expiry)
+VALUES ($1, $2, $3);
+
+-- name: IsAccessTokenRevoked :one
+SELECT EXISTS (SELECT 1 FROM revoked_access_tokens WHERE jti = $1);
@@ -0,0 +1,57 @@
+-- name: GetUserTOTP :one
+SELECT * FROM user_totp WHERE user_id = $1;
+
+-- name: StartTOTPEnrollment :execrows
+-- a fresh secret replaces an unconfirmed one, never a confirmed one
+INSERT INTO user_totp (user_id, secret)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, last_used_step = 0, created_at = now()
+WHERE user_totp.confirmed_at IS NULL;
+
+-- name: ConfirmTOTP :execrows
+UPDATE user_totp
+SET confirmed_at = now()
+WHERE user_id = $1 AND confirmed_at IS NULL;
+
+-- name: UseTOTPStep :execrows
+-- claims a time step; no row means a code for it (or a later one) was already used
+UPDATE user_totp
+SET last_used_step = $2
+WHERE user_id = $1 AND last_used_step < $2;
+
+-- name: DeleteUserTOTP :exec
+DELETE FROM user_totp WHERE user_id = $1;
+
+-- name: CreateRecoveryCodes :exec
+INSERT INTO totp_recovery_codes (user_id, code_hash)
+SELECT $1, unnest(sqlc.arg(code_hashes)::text[]);
+
+-- name: UseRecoveryCode :execrows
+UPDATE totp_recovery_codes
+SET used_at = now()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+-- name: CountUnusedRecoveryCodes :one
+SELECT COUNT(*)::int FROM totp_recovery_codes
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM totp_recovery_codes WHERE user_id = $1;
+
+-- name: CreateLoginChallenge :exec
+INSERT INTO login_challenges (user_id, token_hash, expires_at)
+VALUES ($1, $2, $3);
+
+-- name: AttemptLoginChallenge :one
+-- counts an attempt against a live challenge and returns whose it is
+UPDATE login_challenges
+SET attempts = attempts + 1
+WHERE token_hash = $1 AND expires_at > now() AND attempts < sqlc.arg(max_attempts)::int
+RETURNING id, user_id;
+
+-- name: DeleteLoginChallenge :exec
+DELETE FROM login_challenges WHERE id = $1;
+
+-- name: DeleteExpiredLoginChallenges :exec
+DELETE FROM login_challenges WHERE user_id = $1 AND expires_at < now();
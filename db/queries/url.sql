@@ -1,17 +1,7 @@
 -- name: CreateURL :one
-INSERT INTO urls (user_id, url, short_url)
-VALUES ($1, $2, $3)
-RETURNING id, user_id, url, short_url, total_clicks, daily_clicks, last_clicked, created_at, updated_at;
-
--- name: GetURLByID :one
-SELECT id, url, short_url, created_at, updated_at
-FROM urls
-WHERE id = $1;
-
--- name: GetURLsByUserID :many
-SELECT id, url, short_url, created_at, updated_at 
-FROM urls 
-WHERE user_id = $1;
+INSERT INTO urls (user_id, url, short_url, workspace_id)
+VALUES ($1, $2, $3, $4)
+RETURNING id, user_id, url, short_url, total_clicks, last_clicked, created_at, updated_at, stats_public, stats_share_version, conversion_tracking, conversion_secret, disabled_at, disabled_reason, workspace_id;
 
 -- name: SlugExists :one
 SELECT EXISTS(SELECT 1 FROM urls WHERE short_url = $1);
@@ -26,27 +16,55 @@ SET
     short_url = COALESCE(NULLIF($2, ''), short_url), 
     updated_at = now()
 WHERE id = $3
-RETURNING id, user_id, url, short_url, total_clicks, daily_clicks, last_clicked, created_at, updated_at;
+RETURNING id, user_id, url, short_url, total_clicks, last_clicked, created_at, updated_at, stats_public, stats_share_version, conversion_tracking, conversion_secret, disabled_at, disabled_reason, workspace_id;
+
+-- name: MoveURLToWorkspace :exec
+UPDATE urls SET workspace_id = $2, updated_at = now() WHERE id = $1;
 
 -- name: DeleteURL :exec
 DELETE FROM urls WHERE short_url = $1;
 
 -- name: GetURLAnalytics :one
-SELECT total_clicks, daily_clicks, last_clicked 
+SELECT total_clicks, last_clicked 
 FROM urls 
 WHERE short_url = $1;
 
--- name: IncrementURLClicks :exec
+-- name: GetURLForRedirect :one
+SELECT urls.id, urls.user_id, urls.workspace_id, urls.url, urls.conversion_tracking, workspaces.no_personal_data,
+       (urls.disabled_at IS NOT NULL OR users.suspended_at IS NOT NULL)::bool AS disabled
+FROM urls
+JOIN users ON users.id = urls.user_id
+JOIN workspaces ON workspaces.id = urls.workspace_id
+WHERE urls.short_url = $1;
+
+-- name: AddURLClicks :exec
 UPDATE urls
-SET total_clicks = total_clicks + 1,
-    daily_clicks = daily_clicks + 1, 
-    last_clicked = now()
-WHERE short_url = $1;
+SET total_clicks = COALESCE(urls.total_clicks, 0) + v.clicks,
+    last_clicked = GREATEST(urls.last_clicked, v.last_clicked)
+FROM (
+    SELECT unnest(sqlc.arg(url_ids)::uuid[]) AS id,
+           unnest(sqlc.arg(clicks)::int[]) AS clicks,
+           unnest(sqlc.arg(last_clicked)::timestamptz[]) AS last_clicked
+) AS v
+WHERE urls.id = v.id;
 
--- name: ResetDailyClicks :exec
-UPDATE urls 
-SET daily_clicks = 0;
+-- name: GetURLStatsByShortURL :one
+SELECT id, user_id, url, short_url, total_clicks, last_clicked, created_at, stats_public, stats_share_version
+FROM urls
+WHERE short_url = $1;
 
+-- name: SetURLStatsSharing :one
+-- a null stats_public leaves it as it is
+UPDATE urls
+SET stats_public = COALESCE(sqlc.narg(stats_public)::bool, stats_public),
+    stats_share_version = stats_share_version + CASE WHEN sqlc.arg(revoke_tokens)::bool THEN 1 ELSE 0 END
+WHERE id = sqlc.arg(id)
+RETURNING stats_public, stats_share_version;
 
--- name: GetUserIDByShortURL :one
-SELECT user_id FROM urls WHERE short_url = $1;
\ No newline at end of file
+-- name: GetURLsForComparison :many
+-- the links with these slugs in any of the user's workspaces
+SELECT urls.id, urls.url, urls.short_url, urls.total_clicks, urls.created_at
+FROM urls
+JOIN workspace_members m ON m.workspace_id = urls.workspace_id AND m.user_id = sqlc.arg(user_id)
+WHERE urls.short_url = ANY(sqlc.arg(short_urls)::text[])
+ORDER BY urls.created_at;
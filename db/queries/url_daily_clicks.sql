@@ -0,0 +1,24 @@
+-- name: AddDailyClicks :exec
+-- links deleted since their clicks were buffered are skipped; the key
+-- share lock keeps one from going away before the foreign key is checked
+INSERT INTO url_daily_clicks (url_id, day, clicks)
+SELECT b.url_id, b.day, b.clicks
+FROM unnest(sqlc.arg(url_ids)::uuid[], sqlc.arg(days)::date[], sqlc.arg(clicks)::int[]) AS b(url_id, day, clicks)
+JOIN urls ON urls.id = b.url_id
+FOR KEY SHARE OF urls
+ON CONFLICT (url_id, day) DO UPDATE
+SET clicks = url_daily_clicks.clicks + EXCLUDED.clicks;
+
+-- name: GetDailyClicksForURLs :many
+-- the links' daily buckets from since on, to compare them over one range
+SELECT url_id, day, clicks
+FROM url_daily_clicks
+WHERE url_id = ANY(sqlc.arg(url_ids)::uuid[]) AND day >= sqlc.arg(since)
+ORDER BY url_id, day;
+
+-- name: GetURLDailyClicks :many
+SELECT d.day, d.clicks
+FROM url_daily_clicks d
+JOIN urls u ON u.id = d.url_id
+WHERE u.short_url = $1 AND d.day >= $2
+ORDER BY d.day;
@@ -0,0 +1,40 @@
+-- name: AddHourlyClicks :exec
+-- links deleted since their clicks were buffered are skipped; the key
+-- share lock keeps one from going away before the foreign key is checked
+INSERT INTO url_hourly_clicks (url_id, hour, clicks)
+SELECT b.url_id, b.hour, b.clicks
+FROM unnest(sqlc.arg(url_ids)::uuid[], sqlc.arg(hours)::timestamptz[], sqlc.arg(clicks)::int[]) AS b(url_id, hour, clicks)
+JOIN urls ON urls.id = b.url_id
+FOR KEY SHARE OF urls
+ON CONFLICT (url_id, hour) DO UPDATE
+SET clicks = url_hourly_clicks.clicks + EXCLUDED.clicks;
+
+-- name: CountHourlyClicks :one
+-- clicks on the links in the user's workspaces, or on just one of them
+SELECT COALESCE(SUM(h.clicks), 0)::int AS clicks
+FROM url_hourly_clicks h
+JOIN urls u ON u.id = h.url_id
+WHERE u.workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = sqlc.arg(user_id))
+  AND (sqlc.narg(url_id)::uuid IS NULL OR h.url_id = sqlc.narg(url_id)::uuid)
+  AND h.hour >= sqlc.arg(since)
+  AND h.hour < sqlc.arg(until);
+
+-- name: GetHourOfWeekClicks :many
+-- clicks on the links in the user's workspaces, or on just one of them
+SELECT EXTRACT(ISODOW FROM h.hour AT TIME ZONE sqlc.arg(tz)::text)::int AS weekday,
+       EXTRACT(HOUR FROM h.hour AT TIME ZONE sqlc.arg(tz)::text)::int AS hour_of_day,
+       SUM(h.clicks)::int AS clicks
+FROM url_hourly_clicks h
+JOIN urls u ON u.id = h.url_id
+JOIN workspace_members m ON m.workspace_id = u.workspace_id AND m.user_id = sqlc.arg(user_id)
+WHERE (sqlc.narg(url_id)::uuid IS NULL OR h.url_id = sqlc.narg(url_id)::uuid)
+  AND h.hour >= sqlc.arg(since)
+GROUP BY 1, 2;
+
+-- name: GetURLClicksSince :one
+-- the link's clicks in the hourly buckets from hour on, for "today" in
+-- timezones whose day doesn't start at UTC midnight
+SELECT COALESCE(SUM(h.clicks), 0)::int AS clicks
+FROM url_hourly_clicks h
+JOIN urls u ON u.id = h.url_id
+WHERE u.short_url = $1 AND h.hour >= $2;
@@ -10,4 +10,38 @@ SELECT * FROM users WHERE email = $1;
 SELECT * FROM users WHERE username = $1;
 
 -- name: GetUserById :one
-SELECT * FROM users WHERE id = $1;
\ No newline at end of file
+SELECT * FROM users WHERE id = $1;
+
+-- name: IsUserEmailVerified :one
+SELECT email_verified_at IS NOT NULL FROM users WHERE id = $1;
+
+-- name: ClaimVerificationEmail :one
+-- at most one verification mail a minute per account; no row means it's
+-- verified already or the last mail is too recent
+UPDATE users
+SET verification_sent_at = now()
+WHERE id = $1
+  AND email_verified_at IS NULL
+  AND (verification_sent_at IS NULL OR verification_sent_at < now() - interval '1 minute')
+RETURNING email;
+
+-- name: VerifyUserEmail :execrows
+-- the token names the address it was sent to, so it's void once the email changes
+UPDATE users
+SET email_verified_at = now()
+WHERE id = $1 AND email = $2 AND email_verified_at IS NULL;
+
+-- name: UpdateUserProfile :one
+-- NULL leaves a field as it is
+UPDATE users
+SET username = COALESCE(sqlc.narg(username), username),
+    pfp_url = COALESCE(sqlc.narg(pfp_url), pfp_url),
+    updated_at = now()
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: UpdateUserEmail :exec
+-- only after both addresses confirmed, so the new one counts as verified
+UPDATE users
+SET email = $2, email_verified_at = now(), updated_at = now()
+WHERE id = $1;
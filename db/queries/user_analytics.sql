@@ -3,17 +3,46 @@ INSERT INTO user_analytics (id, user_id, total_urls, total_total_clicks, avg_dai
 VALUES ($1, $2, 0, 0, 0, NOW(), NOW())
 RETURNING id, user_id, total_urls, total_total_clicks, avg_daily_clicks, created_at, updated_at;
 
-
--- name: UpdateAnalytics :one
-UPDATE user_analytics
-SET 
-    total_urls = total_urls + $1, 
-    total_total_clicks = total_total_clicks + $2, 
-    avg_daily_clicks = total_total_clicks + $2 / GREATEST(EXTRACT(EPOCH FROM NOW() - created_at) / 86400, 1), 
+-- name: RecomputeUserAnalytics :one
+INSERT INTO user_analytics (user_id, total_urls, total_total_clicks, avg_daily_clicks, created_at, updated_at)
+SELECT
+    usr.id,
+    COUNT(l.id)::int,
+    COALESCE(SUM(l.total_clicks), 0)::int,
+    COALESCE(SUM(l.total_clicks), 0)::double precision
+        / GREATEST(EXTRACT(EPOCH FROM now() - usr.created_at) / 86400, 1)::double precision,
+    now(),
+    now()
+FROM users usr
+LEFT JOIN urls l ON l.user_id = usr.id
+WHERE usr.id = $1
+GROUP BY usr.id, usr.created_at
+ON CONFLICT (user_id) DO UPDATE
+SET total_urls = EXCLUDED.total_urls,
+    total_total_clicks = EXCLUDED.total_total_clicks,
+    avg_daily_clicks = EXCLUDED.avg_daily_clicks,
     updated_at = now()
-WHERE user_id = $3
 RETURNING id, user_id, total_urls, total_total_clicks, avg_daily_clicks, created_at, updated_at;
 
+-- name: RecomputeAllUserAnalytics :execrows
+INSERT INTO user_analytics (user_id, total_urls, total_total_clicks, avg_daily_clicks, created_at, updated_at)
+SELECT
+    usr.id,
+    COUNT(l.id)::int,
+    COALESCE(SUM(l.total_clicks), 0)::int,
+    COALESCE(SUM(l.total_clicks), 0)::double precision
+        / GREATEST(EXTRACT(EPOCH FROM now() - usr.created_at) / 86400, 1)::double precision,
+    now(),
+    now()
+FROM users usr
+LEFT JOIN urls l ON l.user_id = usr.id
+GROUP BY usr.id, usr.created_at
+ON CONFLICT (user_id) DO UPDATE
+SET total_urls = EXCLUDED.total_urls,
+    total_total_clicks = EXCLUDED.total_total_clicks,
+    avg_daily_clicks = EXCLUDED.avg_daily_clicks,
+    updated_at = now();
+
 -- name: GetAnalyticsByUserId :one
 SELECT id, user_id, total_urls, total_total_clicks, avg_daily_clicks, created_at, updated_at
 FROM user_analytics 
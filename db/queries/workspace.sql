@@ -0,0 +1,151 @@
+-- name: EnsurePersonalWorkspace :one
+-- the user's personal workspace, created with them as its owner on first use
+WITH created AS (
+    INSERT INTO workspaces (name, personal_user_id)
+    VALUES ('Personal', $1)
+    ON CONFLICT (personal_user_id) DO NOTHING
+    RETURNING id
+), owner AS (
+    INSERT INTO workspace_members (workspace_id, user_id, role)
+    SELECT id, $1, 'owner' FROM created
+)
+SELECT id FROM created
+UNION ALL
+SELECT id FROM workspaces WHERE personal_user_id = $1;
+
+-- name: CreateWorkspace :one
+INSERT INTO workspaces (name)
+VALUES ($1)
+RETURNING *;
+
+-- name: RenameWorkspace :exec
+UPDATE workspaces SET name = $2 WHERE id = $1;
+
+-- name: DeleteWorkspace :execrows
+-- personal workspaces only go with their user
+DELETE FROM workspaces WHERE id = $1 AND personal_user_id IS NULL;
+
+-- name: GetMemberWorkspace :one
+-- one of the user's workspaces and their role in it
+SELECT w.id, w.name, (w.personal_user_id IS NOT NULL)::bool AS personal, w.created_at, w.no_personal_data, m.role
+FROM workspaces w
+JOIN workspace_members m ON m.workspace_id = w.id
+WHERE w.id = $1 AND m.user_id = $2;
+
+-- name: ListMemberWorkspaces :many
+-- personal workspace first
+SELECT w.id, w.name, (w.personal_user_id IS NOT NULL)::bool AS personal, w.created_at, w.no_personal_data, m.role,
+       (SELECT COUNT(*) FROM workspace_members wm WHERE wm.workspace_id = w.id)::int AS member_count,
+       (SELECT COUNT(*) FROM urls WHERE urls.workspace_id = w.id)::int AS url_count
+FROM workspaces w
+JOIN workspace_members m ON m.workspace_id = w.id
+WHERE m.user_id = $1
+ORDER BY (w.personal_user_id IS NULL), w.created_at;
+
+-- name: ListMemberWorkspaceIDs :many
+SELECT workspace_id FROM workspace_members WHERE user_id = $1;
+
+-- name: AddWorkspaceMember :execrows
+-- no row means they were already a member, their role is left alone
+INSERT INTO workspace_members (workspace_id, user_id, role)
+VALUES ($1, $2, $3)
+ON CONFLICT (workspace_id, user_id) DO NOTHING;
+
+-- name: ListWorkspaceMembers :many
+SELECT m.user_id, u.username, u.email, u.pfp_url, m.role, m.created_at
+FROM workspace_members m
+JOIN users u ON u.id = m.user_id
+WHERE m.workspace_id = $1
+ORDER BY m.created_at;
+
+-- name: GetWorkspaceMemberRole :one
+SELECT role FROM workspace_members WHERE workspace_id = $1 AND user_id = $2;
+
+-- name: SetWorkspaceMemberRole :execrows
+-- never takes away the last owner; no row means that's what was asked
+UPDATE workspace_members
+SET role = sqlc.arg(role)
+WHERE workspace_id = sqlc.arg(workspace_id) AND user_id = sqlc.arg(user_id)
+  AND (role <> 'owner' OR sqlc.arg(role) = 'owner' OR EXISTS (
+      SELECT 1 FROM workspace_members o
+      WHERE o.workspace_id = sqlc.arg(workspace_id) AND o.role = 'owner' AND o.user_id <> sqlc.arg(user_id)
+  ));
+
+-- name: RemoveWorkspaceMember :execrows
+-- never removes the last owner; no row means that's what was asked
+DELETE FROM workspace_members
+WHERE workspace_id = sqlc.arg(workspace_id) AND user_id = sqlc.arg(user_id)
+  AND (role <> 'owner' OR EXISTS (
+      SELECT 1 FROM workspace_members o
+      WHERE o.workspace_id = sqlc.arg(workspace_id) AND o.role = 'owner' AND o.user_id <> sqlc.arg(user_id)
+  ));
+
+-- name: CreateWorkspaceInvitation :one
+-- replaces a pending invitation to the same address
+INSERT INTO workspace_invitations (workspace_id, email, role, token_hash, invited_by, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (workspace_id, email) DO UPDATE
+SET role = EXCLUDED.role,
+    token_hash = EXCLUDED.token_hash,
+    invited_by = EXCLUDED.invited_by,
+    expires_at = EXCLUDED.expires_at,
+    created_at = now()
+RETURNING *;
+
+-- name: ListWorkspaceInvitations :many
+SELECT id, email, role, invited_by, expires_at, created_at
+FROM workspace_invitations
+WHERE workspace_id = $1 AND expires_at > now()
+ORDER BY created_at;
+
+-- name: DeleteWorkspaceInvitation :execrows
+DELETE FROM workspace_invitations WHERE id = $1 AND workspace_id = $2;
+
+-- name: ClaimWorkspaceInvitation :one
+-- an invitation is used up by accepting it; expired ones don't match
+DELETE FROM workspace_invitations
+WHERE token_hash = $1 AND expires_at > now()
+RETURNING workspace_id, email, role;
+
+-- name: GetLinkAccess :one
+-- a link and the user's role in the workspace that owns it, empty when they
+-- aren't a member
+SELECT urls.id, urls.user_id, urls.workspace_id, urls.short_url, COALESCE(m.role, '')::text AS role
+FROM urls
+LEFT JOIN workspace_members m ON m.workspace_id = urls.workspace_id AND m.user_id = $2
+WHERE urls.short_url = $1;
+
+-- name: GetLinkAccessByID :one
+SELECT urls.id, urls.user_id, urls.workspace_id, urls.short_url, COALESCE(m.role, '')::text AS role
+FROM urls
+LEFT JOIN workspace_members m ON m.workspace_id = urls.workspace_id AND m.user_id = $2
+WHERE urls.id = $1;
+
+-- name: GetMemberURLs :many
+-- links in all of the user's workspaces, or in just one of them
+SELECT urls.id, urls.workspace_id, urls.user_id, urls.url, urls.short_url, urls.created_at, urls.updated_at
+FROM urls
+JOIN workspace_members m ON m.workspace_id = urls.workspace_id
+WHERE m.user_id = sqlc.arg(user_id)
+  AND (sqlc.narg(workspace_id)::uuid IS NULL OR urls.workspace_id = sqlc.narg(workspace_id))
+ORDER BY urls.created_at;
+
+-- name: GetWorkspaceAnalytics :one
+SELECT COUNT(*)::int AS total_urls,
+       COALESCE(SUM(total_clicks), 0)::int AS total_clicks
+FROM urls
+WHERE workspace_id = $1;
+
+-- name: GetWorkspaceClicksSince :one
+SELECT COALESCE(SUM(h.clicks), 0)::int AS clicks
+FROM url_hourly_clicks h
+JOIN urls u ON u.id = h.url_id
+WHERE u.workspace_id = $1 AND h.hour >= $2;
+
+-- name: GetWorkspaceDailyClicks :many
+SELECT d.day, SUM(d.clicks)::int AS clicks
+FROM url_daily_clicks d
+JOIN urls u ON u.id = d.url_id
+WHERE u.workspace_id = $1 AND d.day >= $2
+GROUP BY d.day
+ORDER BY d.day;
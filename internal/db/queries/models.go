@@ -11,6 +11,123 @@ import (
 	"github.com/google/uuid"
 )
 
+type AccessToken struct {
+	Jti       uuid.UUID
+	SessionID uuid.UUID
+	Expiry    time.Time
+}
+
+type AccountDeletion struct {
+	UserID      uuid.UUID
+	TokenHash   string
+	RequestedAt time.Time
+	ExpiresAt   time.Time
+	ConfirmedAt sql.NullTime
+	DeleteAfter sql.NullTime
+}
+
+type AlertRule struct {
+	ID              uuid.UUID
+	UserID          uuid.UUID
+	UrlID           uuid.NullUUID
+	Kind            string
+	Threshold       float64
+	WindowHours     int32
+	CooldownMinutes int32
+	NotifyEmail     bool
+	WebhookUrl      sql.NullString
+	WebhookSecret   string
+	Enabled         bool
+	LastTriggeredAt sql.NullTime
+	CreatedAt       time.Time
+}
+
+type ApiKey struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	Prefix     string
+	KeyHash    string
+	Scopes     []string
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	CreatedAt  time.Time
+	RevokedAt  sql.NullTime
+}
+
+type AuthThrottle struct {
+	Scope         string
+	Key           string
+	UserID        uuid.NullUUID
+	Failures      int32
+	LastFailureAt time.Time
+	LastIp        string
+	BlockedUntil  sql.NullTime
+	LockedAt      sql.NullTime
+}
+
+type Conversion struct {
+	ID        uuid.UUID
+	ClickID   uuid.UUID
+	UrlID     uuid.UUID
+	Goal      string
+	Value     float64
+	Source    string
+	CreatedAt time.Time
+}
+
+type DigestSubscription struct {
+	ID                    uuid.UUID
+	UserID                uuid.UUID
+	Email                 string
+	Frequency             string
+	Timezone              string
+	UnsubscribeToken      string
+	LastSentAt            sql.NullTime
+	CreatedAt             time.Time
+	ConfirmedAt           sql.NullTime
+	ConfirmationTokenHash sql.NullString
+	ConfirmationSentAt    sql.NullTime
+}
+
+type EmailChange struct {
+	UserID         uuid.UUID
+	NewEmail       string
+	OldTokenHash   string
+	NewTokenHash   string
+	OldConfirmedAt sql.NullTime
+	NewConfirmedAt sql.NullTime
+	ExpiresAt      time.Time
+	CreatedAt      time.Time
+}
+
+type LoginChallenge struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	TokenHash string
+	ExpiresAt time.Time
+	Attempts  int32
+	CreatedAt time.Time
+}
+
+type MagicLink struct {
+	TokenHash string
+	UserID    uuid.UUID
+	Email     string
+	NonceHash string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+type OidcLoginState struct {
+	StateHash    string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+}
+
 type PasswordResetToken struct {
 	ID        uuid.UUID
 	UserID    uuid.UUID
@@ -21,32 +138,116 @@ type PasswordResetToken struct {
 
 type RefreshToken struct {
 	ID        uuid.UUID
-	UserID    uuid.NullUUID
-	Token     string
+	UserID    uuid.UUID
+	FamilyID  uuid.UUID
+	TokenHash string
 	Expiry    time.Time
-	CreatedAt sql.NullTime
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
+	RevokedAt sql.NullTime
+}
+
+type RetentionRun struct {
+	ID                 uuid.UUID
+	RanAt              time.Time
+	Cutoff             time.Time
+	ClicksDeleted      int64
+	ConversionsDeleted int64
+	RollupRows         int64
+	DurationMs         int64
+	Error              sql.NullString
+}
+
+type RevokedAccessToken struct {
+	Jti    uuid.UUID
+	Expiry time.Time
+}
+
+type Session struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Device     string
+	Ip         string
+	UserAgent  string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+}
+
+type TotpRecoveryCode struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CodeHash  string
+	UsedAt    sql.NullTime
+	CreatedAt time.Time
 }
 
 type Url struct {
-	ID          uuid.UUID
-	UserID      uuid.UUID
-	Url         string
-	ShortUrl    string
-	TotalClicks sql.NullInt32
-	DailyClicks sql.NullInt32
-	LastClicked sql.NullTime
-	CreatedAt   sql.NullTime
-	UpdatedAt   sql.NullTime
+	ID                 uuid.UUID
+	UserID             uuid.UUID
+	Url                string
+	ShortUrl           string
+	TotalClicks        sql.NullInt32
+	LastClicked        sql.NullTime
+	CreatedAt          sql.NullTime
+	UpdatedAt          sql.NullTime
+	StatsPublic        bool
+	StatsShareVersion  int32
+	ConversionTracking bool
+	ConversionSecret   sql.NullString
+	DisabledAt         sql.NullTime
+	DisabledReason     string
+	WorkspaceID        uuid.UUID
+}
+
+type UrlClick struct {
+	ID        uuid.UUID
+	UrlID     uuid.UUID
+	ClickedAt time.Time
+	Referrer  string
+	Variant   string
+	Country   string
+	Device    string
+	Ip        string
+}
+
+type UrlClickRollup struct {
+	UrlID           uuid.UUID
+	Day             time.Time
+	Referrer        string
+	Variant         string
+	Clicks          int32
+	ConvertedClicks int32
+	Conversions     int32
+	Value           float64
+}
+
+type UrlDailyClick struct {
+	UrlID  uuid.UUID
+	Day    time.Time
+	Clicks int32
+}
+
+type UrlHourlyClick struct {
+	UrlID  uuid.UUID
+	Hour   time.Time
+	Clicks int32
 }
 
 type User struct {
-	ID             uuid.UUID
-	Username       string
-	Email          string
-	HashedPassword string
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	PfpUrl         string
+	ID                 uuid.UUID
+	Username           string
+	Email              string
+	HashedPassword     string
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	PfpUrl             string
+	EmailVerifiedAt    sql.NullTime
+	VerificationSentAt sql.NullTime
+	Role               string
+	SuspendedAt        sql.NullTime
+	SuspensionReason   string
 }
 
 type UserAnalytic struct {
@@ -58,3 +259,47 @@ type UserAnalytic struct {
 	CreatedAt        sql.NullTime
 	UpdatedAt        sql.NullTime
 }
+
+type UserIdentity struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	Issuer      string
+	Subject     string
+	Email       string
+	CreatedAt   time.Time
+	LastLoginAt time.Time
+}
+
+type UserTotp struct {
+	UserID       uuid.UUID
+	Secret       string
+	ConfirmedAt  sql.NullTime
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
+
+type Workspace struct {
+	ID             uuid.UUID
+	Name           string
+	PersonalUserID uuid.NullUUID
+	CreatedAt      time.Time
+	NoPersonalData bool
+}
+
+type WorkspaceInvitation struct {
+	ID          uuid.UUID
+	WorkspaceID uuid.UUID
+	Email       string
+	Role        string
+	TokenHash   string
+	InvitedBy   uuid.NullUUID
+	ExpiresAt   time.Time
+	CreatedAt   time.Time
+}
+
+type WorkspaceMember struct {
+	WorkspaceID uuid.UUID
+	UserID      uuid.UUID
+	Role        string
+	CreatedAt   time.Time
+}
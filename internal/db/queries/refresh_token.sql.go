@@ -7,23 +7,82 @@ package queries
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const claimRefreshToken = `-- name: ClaimRefreshToken :one
+UPDATE refresh_tokens
+SET used_at = now()
+WHERE token_hash = $1
+  AND used_at IS NULL
+  AND revoked_at IS NULL
+  AND expiry > now()
+RETURNING id, user_id, family_id
+`
+
+type ClaimRefreshTokenRow struct {
+	ID       uuid.UUID
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+}
+
+func (q *Queries) ClaimRefreshToken(ctx context.Context, tokenHash string) (ClaimRefreshTokenRow, error) {
+	row := q.db.QueryRowContext(ctx, claimRefreshToken, tokenHash)
+	var i ClaimRefreshTokenRow
+	err := row.Scan(&i.ID, &i.UserID, &i.FamilyID)
+	return i, err
+}
+
+const getRefreshTokenByHash = `-- name: GetRefreshTokenByHash :one
+SELECT id, user_id, family_id, expiry, used_at, revoked_at
+FROM refresh_tokens
+WHERE token_hash = $1
+`
+
+type GetRefreshTokenByHashRow struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	FamilyID  uuid.UUID
+	Expiry    time.Time
+	UsedAt    sql.NullTime
+	RevokedAt sql.NullTime
+}
+
+func (q *Queries) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (GetRefreshTokenByHashRow, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshTokenByHash, tokenHash)
+	var i GetRefreshTokenByHashRow
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.FamilyID,
+		&i.Expiry,
+		&i.UsedAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
 const storeRefreshToken = `-- name: StoreRefreshToken :exec
-INSERT INTO refresh_tokens (user_id, token, expiry)
-VALUES ($1, $2, $3)
+INSERT INTO refresh_tokens (user_id, family_id, token_hash, expiry)
+VALUES ($1, $2, $3, $4)
 `
 
 type StoreRefreshTokenParams struct {
-	UserID uuid.NullUUID
-	Token  string
-	Expiry time.Time
+	UserID    uuid.UUID
+	FamilyID  uuid.UUID
+	TokenHash string
+	Expiry    time.Time
 }
 
 func (q *Queries) StoreRefreshToken(ctx context.Context, arg StoreRefreshTokenParams) error {
-	_, err := q.db.ExecContext(ctx, storeRefreshToken, arg.UserID, arg.Token, arg.Expiry)
+	_, err := q.db.ExecContext(ctx, storeRefreshToken,
+		arg.UserID,
+		arg.FamilyID,
+		arg.TokenHash,
+		arg.Expiry,
+	)
 	return err
 }
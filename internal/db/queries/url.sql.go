@@ -8,24 +8,55 @@ package queries
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const addURLClicks = `-- name: AddURLClicks :exec
+UPDATE urls
+SET total_clicks = COALESCE(urls.total_clicks, 0) + v.clicks,
+    last_clicked = GREATEST(urls.last_clicked, v.last_clicked)
+FROM (
+    SELECT unnest($1::uuid[]) AS id,
+           unnest($2::int[]) AS clicks,
+           unnest($3::timestamptz[]) AS last_clicked
+) AS v
+WHERE urls.id = v.id
+`
+
+type AddURLClicksParams struct {
+	UrlIds      []uuid.UUID
+	Clicks      []int32
+	LastClicked []time.Time
+}
+
+func (q *Queries) AddURLClicks(ctx context.Context, arg AddURLClicksParams) error {
+	_, err := q.db.ExecContext(ctx, addURLClicks, pq.Array(arg.UrlIds), pq.Array(arg.Clicks), pq.Array(arg.LastClicked))
+	return err
+}
+
 const createURL = `-- name: CreateURL :one
-INSERT INTO urls (user_id, url, short_url)
-VALUES ($1, $2, $3)
-RETURNING id, user_id, url, short_url, total_clicks, daily_clicks, last_clicked, created_at, updated_at
+INSERT INTO urls (user_id, url, short_url, workspace_id)
+VALUES ($1, $2, $3, $4)
+RETURNING id, user_id, url, short_url, total_clicks, last_clicked, created_at, updated_at, stats_public, stats_share_version, conversion_tracking, conversion_secret, disabled_at, disabled_reason, workspace_id
 `
 
 type CreateURLParams struct {
-	UserID   uuid.UUID
-	Url      string
-	ShortUrl string
+	UserID      uuid.UUID
+	Url         string
+	ShortUrl    string
+	WorkspaceID uuid.UUID
 }
 
 func (q *Queries) CreateURL(ctx context.Context, arg CreateURLParams) (Url, error) {
-	row := q.db.QueryRowContext(ctx, createURL, arg.UserID, arg.Url, arg.ShortUrl)
+	row := q.db.QueryRowContext(ctx, createURL,
+		arg.UserID,
+		arg.Url,
+		arg.ShortUrl,
+		arg.WorkspaceID,
+	)
 	var i Url
 	err := row.Scan(
 		&i.ID,
@@ -33,10 +64,16 @@ func (q *Queries) CreateURL(ctx context.Context, arg CreateURLParams) (Url, erro
 		&i.Url,
 		&i.ShortUrl,
 		&i.TotalClicks,
-		&i.DailyClicks,
 		&i.LastClicked,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.StatsPublic,
+		&i.StatsShareVersion,
+		&i.ConversionTracking,
+		&i.ConversionSecret,
+		&i.DisabledAt,
+		&i.DisabledReason,
+		&i.WorkspaceID,
 	)
 	return i, err
 }
@@ -51,91 +88,140 @@ func (q *Queries) DeleteURL(ctx context.Context, shortUrl string) error {
 }
 
 const getURLAnalytics = `-- name: GetURLAnalytics :one
-SELECT total_clicks, daily_clicks, last_clicked 
+SELECT total_clicks, last_clicked 
 FROM urls 
 WHERE short_url = $1
 `
 
 type GetURLAnalyticsRow struct {
 	TotalClicks sql.NullInt32
-	DailyClicks sql.NullInt32
 	LastClicked sql.NullTime
 }
 
 func (q *Queries) GetURLAnalytics(ctx context.Context, shortUrl string) (GetURLAnalyticsRow, error) {
 	row := q.db.QueryRowContext(ctx, getURLAnalytics, shortUrl)
 	var i GetURLAnalyticsRow
-	err := row.Scan(&i.TotalClicks, &i.DailyClicks, &i.LastClicked)
+	err := row.Scan(&i.TotalClicks, &i.LastClicked)
 	return i, err
 }
 
-const getURLByID = `-- name: GetURLByID :one
-SELECT id, url, short_url, created_at, updated_at
+const getURLByShortURL = `-- name: GetURLByShortURL :one
+SELECT url FROM urls WHERE short_url = $1
+`
+
+func (q *Queries) GetURLByShortURL(ctx context.Context, shortUrl string) (string, error) {
+	row := q.db.QueryRowContext(ctx, getURLByShortURL, shortUrl)
+	var url string
+	err := row.Scan(&url)
+	return url, err
+}
+
+const getURLForRedirect = `-- name: GetURLForRedirect :one
+SELECT urls.id, urls.user_id, urls.workspace_id, urls.url, urls.conversion_tracking, workspaces.no_personal_data,
+       (urls.disabled_at IS NOT NULL OR users.suspended_at IS NOT NULL)::bool AS disabled
 FROM urls
-WHERE id = $1
+JOIN users ON users.id = urls.user_id
+JOIN workspaces ON workspaces.id = urls.workspace_id
+WHERE urls.short_url = $1
 `
 
-type GetURLByIDRow struct {
-	ID        uuid.UUID
-	Url       string
-	ShortUrl  string
-	CreatedAt sql.NullTime
-	UpdatedAt sql.NullTime
+type GetURLForRedirectRow struct {
+	ID                 uuid.UUID
+	UserID             uuid.UUID
+	WorkspaceID        uuid.UUID
+	Url                string
+	ConversionTracking bool
+	NoPersonalData     bool
+	Disabled           bool
 }
 
-func (q *Queries) GetURLByID(ctx context.Context, id uuid.UUID) (GetURLByIDRow, error) {
-	row := q.db.QueryRowContext(ctx, getURLByID, id)
-	var i GetURLByIDRow
+func (q *Queries) GetURLForRedirect(ctx context.Context, shortUrl string) (GetURLForRedirectRow, error) {
+	row := q.db.QueryRowContext(ctx, getURLForRedirect, shortUrl)
+	var i GetURLForRedirectRow
 	err := row.Scan(
 		&i.ID,
+		&i.UserID,
+		&i.WorkspaceID,
 		&i.Url,
-		&i.ShortUrl,
-		&i.CreatedAt,
-		&i.UpdatedAt,
+		&i.ConversionTracking,
+		&i.NoPersonalData,
+		&i.Disabled,
 	)
 	return i, err
 }
 
-const getURLByShortURL = `-- name: GetURLByShortURL :one
-SELECT url FROM urls WHERE short_url = $1
+const getURLStatsByShortURL = `-- name: GetURLStatsByShortURL :one
+SELECT id, user_id, url, short_url, total_clicks, last_clicked, created_at, stats_public, stats_share_version
+FROM urls
+WHERE short_url = $1
 `
 
-func (q *Queries) GetURLByShortURL(ctx context.Context, shortUrl string) (string, error) {
-	row := q.db.QueryRowContext(ctx, getURLByShortURL, shortUrl)
-	var url string
-	err := row.Scan(&url)
-	return url, err
+type GetURLStatsByShortURLRow struct {
+	ID                uuid.UUID
+	UserID            uuid.UUID
+	Url               string
+	ShortUrl          string
+	TotalClicks       sql.NullInt32
+	LastClicked       sql.NullTime
+	CreatedAt         sql.NullTime
+	StatsPublic       bool
+	StatsShareVersion int32
 }
 
-const getURLsByUserID = `-- name: GetURLsByUserID :many
-SELECT id, url, short_url, created_at, updated_at 
-FROM urls 
-WHERE user_id = $1
+func (q *Queries) GetURLStatsByShortURL(ctx context.Context, shortUrl string) (GetURLStatsByShortURLRow, error) {
+	row := q.db.QueryRowContext(ctx, getURLStatsByShortURL, shortUrl)
+	var i GetURLStatsByShortURLRow
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Url,
+		&i.ShortUrl,
+		&i.TotalClicks,
+		&i.LastClicked,
+		&i.CreatedAt,
+		&i.StatsPublic,
+		&i.StatsShareVersion,
+	)
+	return i, err
+}
+
+const getURLsForComparison = `-- name: GetURLsForComparison :many
+SELECT urls.id, urls.url, urls.short_url, urls.total_clicks, urls.created_at
+FROM urls
+JOIN workspace_members m ON m.workspace_id = urls.workspace_id AND m.user_id = $1
+WHERE urls.short_url = ANY($2::text[])
+ORDER BY urls.created_at
 `
 
-type GetURLsByUserIDRow struct {
-	ID        uuid.UUID
-	Url       string
-	ShortUrl  string
-	CreatedAt sql.NullTime
-	UpdatedAt sql.NullTime
+type GetURLsForComparisonParams struct {
+	UserID    uuid.UUID
+	ShortUrls []string
+}
+
+type GetURLsForComparisonRow struct {
+	ID          uuid.UUID
+	Url         string
+	ShortUrl    string
+	TotalClicks sql.NullInt32
+	CreatedAt   sql.NullTime
 }
 
-func (q *Queries) GetURLsByUserID(ctx context.Context, userID uuid.UUID) ([]GetURLsByUserIDRow, error) {
-	rows, err := q.db.QueryContext(ctx, getURLsByUserID, userID)
+// the links with these slugs in any of the user's workspaces
+func (q *Queries) GetURLsForComparison(ctx context.Context, arg GetURLsForComparisonParams) ([]GetURLsForComparisonRow, error) {
+	rows, err := q.db.QueryContext(ctx, getURLsForComparison, arg.UserID, pq.Array(arg.ShortUrls))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetURLsByUserIDRow
+	var items []GetURLsForComparisonRow
 	for rows.Next() {
-		var i GetURLsByUserIDRow
+		var i GetURLsForComparisonRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.Url,
 			&i.ShortUrl,
+			&i.TotalClicks,
 			&i.CreatedAt,
-			&i.UpdatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -150,38 +236,45 @@ func (q *Queries) GetURLsByUserID(ctx context.Context, userID uuid.UUID) ([]GetU
 	return items, nil
 }
 
-const getUserIDByShortURL = `-- name: GetUserIDByShortURL :one
-SELECT user_id FROM urls WHERE short_url = $1
+const moveURLToWorkspace = `-- name: MoveURLToWorkspace :exec
+UPDATE urls SET workspace_id = $2, updated_at = now() WHERE id = $1
 `
 
-func (q *Queries) GetUserIDByShortURL(ctx context.Context, shortUrl string) (uuid.UUID, error) {
-	row := q.db.QueryRowContext(ctx, getUserIDByShortURL, shortUrl)
-	var user_id uuid.UUID
-	err := row.Scan(&user_id)
-	return user_id, err
+type MoveURLToWorkspaceParams struct {
+	ID          uuid.UUID
+	WorkspaceID uuid.UUID
 }
 
-const incrementURLClicks = `-- name: IncrementURLClicks :exec
+func (q *Queries) MoveURLToWorkspace(ctx context.Context, arg MoveURLToWorkspaceParams) error {
+	_, err := q.db.ExecContext(ctx, moveURLToWorkspace, arg.ID, arg.WorkspaceID)
+	return err
+}
+
+const setURLStatsSharing = `-- name: SetURLStatsSharing :one
 UPDATE urls
-SET total_clicks = total_clicks + 1,
-    daily_clicks = daily_clicks + 1, 
-    last_clicked = now()
-WHERE short_url = $1
+SET stats_public = COALESCE($1::bool, stats_public),
+    stats_share_version = stats_share_version + CASE WHEN $2::bool THEN 1 ELSE 0 END
+WHERE id = $3
+RETURNING stats_public, stats_share_version
 `
 
-func (q *Queries) IncrementURLClicks(ctx context.Context, shortUrl string) error {
-	_, err := q.db.ExecContext(ctx, incrementURLClicks, shortUrl)
-	return err
+type SetURLStatsSharingParams struct {
+	StatsPublic  sql.NullBool
+	RevokeTokens bool
+	ID           uuid.UUID
 }
 
-const resetDailyClicks = `-- name: ResetDailyClicks :exec
-UPDATE urls 
-SET daily_clicks = 0
-`
+type SetURLStatsSharingRow struct {
+	StatsPublic       bool
+	StatsShareVersion int32
+}
 
-func (q *Queries) ResetDailyClicks(ctx context.Context) error {
-	_, err := q.db.ExecContext(ctx, resetDailyClicks)
-	return err
+// a null stats_public leaves it as it is
+func (q *Queries) SetURLStatsSharing(ctx context.Context, arg SetURLStatsSharingParams) (SetURLStatsSharingRow, error) {
+	row := q.db.QueryRowContext(ctx, setURLStatsSharing, arg.StatsPublic, arg.RevokeTokens, arg.ID)
+	var i SetURLStatsSharingRow
+	err := row.Scan(&i.StatsPublic, &i.StatsShareVersion)
+	return i, err
 }
 
 const slugExists = `-- name: SlugExists :one
@@ -202,7 +295,7 @@ SET
     short_url = COALESCE(NULLIF($2, ''), short_url), 
     updated_at = now()
 WHERE id = $3
-RETURNING id, user_id, url, short_url, total_clicks, daily_clicks, last_clicked, created_at, updated_at
+RETURNING id, user_id, url, short_url, total_clicks, last_clicked, created_at, updated_at, stats_public, stats_share_version, conversion_tracking, conversion_secret, disabled_at, disabled_reason, workspace_id
 `
 
 type UpdateShortURLParams struct {
@@ -220,10 +313,16 @@ func (q *Queries) UpdateShortURL(ctx context.Context, arg UpdateShortURLParams)
 		&i.Url,
 		&i.ShortUrl,
 		&i.TotalClicks,
-		&i.DailyClicks,
 		&i.LastClicked,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.StatsPublic,
+		&i.StatsShareVersion,
+		&i.ConversionTracking,
+		&i.ConversionSecret,
+		&i.DisabledAt,
+		&i.DisabledReason,
+		&i.WorkspaceID,
 	)
 	return i, err
 }
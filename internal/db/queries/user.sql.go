@@ -7,11 +7,30 @@ package queries
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const claimVerificationEmail = `-- name: ClaimVerificationEmail :one
+UPDATE users
+SET verification_sent_at = now()
+WHERE id = $1
+  AND email_verified_at IS NULL
+  AND (verification_sent_at IS NULL OR verification_sent_at < now() - interval '1 minute')
+RETURNING email
+`
+
+// at most one verification mail a minute per account; no row means it's
+// verified already or the last mail is too recent
+func (q *Queries) ClaimVerificationEmail(ctx context.Context, id uuid.UUID) (string, error) {
+	row := q.db.QueryRowContext(ctx, claimVerificationEmail, id)
+	var email string
+	err := row.Scan(&email)
+	return email, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, username, email, hashed_password, pfp_url)
 VALUES ($1, $2, $3, $4, $5)
@@ -56,7 +75,7 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateU
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, username, email, hashed_password, created_at, updated_at, pfp_url FROM users WHERE email = $1
+SELECT id, username, email, hashed_password, created_at, updated_at, pfp_url, email_verified_at, verification_sent_at, role, suspended_at, suspension_reason FROM users WHERE email = $1
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
@@ -70,12 +89,17 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.PfpUrl,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.SuspensionReason,
 	)
 	return i, err
 }
 
 const getUserById = `-- name: GetUserById :one
-SELECT id, username, email, hashed_password, created_at, updated_at, pfp_url FROM users WHERE id = $1
+SELECT id, username, email, hashed_password, created_at, updated_at, pfp_url, email_verified_at, verification_sent_at, role, suspended_at, suspension_reason FROM users WHERE id = $1
 `
 
 func (q *Queries) GetUserById(ctx context.Context, id uuid.UUID) (User, error) {
@@ -89,12 +113,17 @@ func (q *Queries) GetUserById(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.PfpUrl,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.SuspensionReason,
 	)
 	return i, err
 }
 
 const getUserByUserName = `-- name: GetUserByUserName :one
-SELECT id, username, email, hashed_password, created_at, updated_at, pfp_url FROM users WHERE username = $1
+SELECT id, username, email, hashed_password, created_at, updated_at, pfp_url, email_verified_at, verification_sent_at, role, suspended_at, suspension_reason FROM users WHERE username = $1
 `
 
 func (q *Queries) GetUserByUserName(ctx context.Context, username string) (User, error) {
@@ -108,6 +137,95 @@ func (q *Queries) GetUserByUserName(ctx context.Context, username string) (User,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.PfpUrl,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.SuspensionReason,
 	)
 	return i, err
 }
+
+const isUserEmailVerified = `-- name: IsUserEmailVerified :one
+SELECT email_verified_at IS NOT NULL FROM users WHERE id = $1
+`
+
+func (q *Queries) IsUserEmailVerified(ctx context.Context, id uuid.UUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isUserEmailVerified, id)
+	var column_1 bool
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
+const updateUserEmail = `-- name: UpdateUserEmail :exec
+UPDATE users
+SET email = $2, email_verified_at = now(), updated_at = now()
+WHERE id = $1
+`
+
+type UpdateUserEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+// only after both addresses confirmed, so the new one counts as verified
+func (q *Queries) UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserEmail, arg.ID, arg.Email)
+	return err
+}
+
+const updateUserProfile = `-- name: UpdateUserProfile :one
+UPDATE users
+SET username = COALESCE($1, username),
+    pfp_url = COALESCE($2, pfp_url),
+    updated_at = now()
+WHERE id = $3
+RETURNING id, username, email, hashed_password, created_at, updated_at, pfp_url, email_verified_at, verification_sent_at, role, suspended_at, suspension_reason
+`
+
+type UpdateUserProfileParams struct {
+	Username sql.NullString
+	PfpUrl   sql.NullString
+	ID       uuid.UUID
+}
+
+// NULL leaves a field as it is
+func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserProfile, arg.Username, arg.PfpUrl, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.Email,
+		&i.HashedPassword,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.PfpUrl,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.SuspensionReason,
+	)
+	return i, err
+}
+
+const verifyUserEmail = `-- name: VerifyUserEmail :execrows
+UPDATE users
+SET email_verified_at = now()
+WHERE id = $1 AND email = $2 AND email_verified_at IS NULL
+`
+
+type VerifyUserEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+// the token names the address it was sent to, so it's void once the email changes
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, verifyUserEmail, arg.ID, arg.Email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
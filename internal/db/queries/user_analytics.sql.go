@@ -58,25 +58,58 @@ func (q *Queries) GetAnalyticsByUserId(ctx context.Context, userID uuid.UUID) (U
 	return i, err
 }
 
-const updateAnalytics = `-- name: UpdateAnalytics :one
-UPDATE user_analytics
-SET 
-    total_urls = total_urls + $1, 
-    total_total_clicks = total_total_clicks + $2, 
-    avg_daily_clicks = total_total_clicks + $2 / GREATEST(EXTRACT(EPOCH FROM NOW() - created_at) / 86400, 1), 
+const recomputeAllUserAnalytics = `-- name: RecomputeAllUserAnalytics :execrows
+INSERT INTO user_analytics (user_id, total_urls, total_total_clicks, avg_daily_clicks, created_at, updated_at)
+SELECT
+    usr.id,
+    COUNT(l.id)::int,
+    COALESCE(SUM(l.total_clicks), 0)::int,
+    COALESCE(SUM(l.total_clicks), 0)::double precision
+        / GREATEST(EXTRACT(EPOCH FROM now() - usr.created_at) / 86400, 1)::double precision,
+    now(),
+    now()
+FROM users usr
+LEFT JOIN urls l ON l.user_id = usr.id
+GROUP BY usr.id, usr.created_at
+ON CONFLICT (user_id) DO UPDATE
+SET total_urls = EXCLUDED.total_urls,
+    total_total_clicks = EXCLUDED.total_total_clicks,
+    avg_daily_clicks = EXCLUDED.avg_daily_clicks,
     updated_at = now()
-WHERE user_id = $3
-RETURNING id, user_id, total_urls, total_total_clicks, avg_daily_clicks, created_at, updated_at
 `
 
-type UpdateAnalyticsParams struct {
-	TotalUrls        int32
-	TotalTotalClicks int32
-	UserID           uuid.UUID
+func (q *Queries) RecomputeAllUserAnalytics(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, recomputeAllUserAnalytics)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
-func (q *Queries) UpdateAnalytics(ctx context.Context, arg UpdateAnalyticsParams) (UserAnalytic, error) {
-	row := q.db.QueryRowContext(ctx, updateAnalytics, arg.TotalUrls, arg.TotalTotalClicks, arg.UserID)
+const recomputeUserAnalytics = `-- name: RecomputeUserAnalytics :one
+INSERT INTO user_analytics (user_id, total_urls, total_total_clicks, avg_daily_clicks, created_at, updated_at)
+SELECT
+    usr.id,
+    COUNT(l.id)::int,
+    COALESCE(SUM(l.total_clicks), 0)::int,
+    COALESCE(SUM(l.total_clicks), 0)::double precision
+        / GREATEST(EXTRACT(EPOCH FROM now() - usr.created_at) / 86400, 1)::double precision,
+    now(),
+    now()
+FROM users usr
+LEFT JOIN urls l ON l.user_id = usr.id
+WHERE usr.id = $1
+GROUP BY usr.id, usr.created_at
+ON CONFLICT (user_id) DO UPDATE
+SET total_urls = EXCLUDED.total_urls,
+    total_total_clicks = EXCLUDED.total_total_clicks,
+    avg_daily_clicks = EXCLUDED.avg_daily_clicks,
+    updated_at = now()
+RETURNING id, user_id, total_urls, total_total_clicks, avg_daily_clicks, created_at, updated_at
+`
+
+func (q *Queries) RecomputeUserAnalytics(ctx context.Context, id uuid.UUID) (UserAnalytic, error) {
+	row := q.db.QueryRowContext(ctx, recomputeUserAnalytics, id)
 	var i UserAnalytic
 	err := row.Scan(
 		&i.ID,
@@ -0,0 +1,525 @@
+package handlers
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+	"github.com/rvif/nano-url/internal/services"
+)
+
+// how long the link confirming an account deletion works
+const accountDeletionLinkTTL = 24 * time.Hour
+
+var accountDeleter *services.AccountDeleter
+
+func InitAccountDeleter(deleter *services.AccountDeleter) {
+	accountDeleter = deleter
+}
+
+// exportFile is one file of a personal data export
+type exportFile struct {
+	name string
+	data any
+}
+
+// ExportAccountHandler answers with a zip of everything nano holds about the
+// caller: profile, links, workspaces, click data, sessions, API keys, linked
+// accounts, digests, alerts and recorded sign-in failures, one JSON file each,
+// plus the uploaded profile picture. Password, token and key hashes and
+// secrets are left out. nano keeps no audit log, so there are no audit events
+// to export and exporting isn't recorded as one.
+func ExportAccountHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	user, err := q.GetUserById(c, userUUID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Could not find user"})
+		return
+	}
+
+	files, err := collectAccountExport(c, q, user)
+	if err != nil {
+		fmt.Printf("Error exporting data of user %s: %v\n", userUUID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not export account data"})
+		return
+	}
+
+	filename := fmt.Sprintf("nano-export-%s-%s.zip", user.Username, time.Now().UTC().Format("2006-01-02"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	zw := zip.NewWriter(c.Writer)
+	for _, file := range files {
+		w, err := zw.Create(file.name)
+		if err != nil {
+			fmt.Printf("Error writing %s to export: %v\n", file.name, err)
+			return
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			fmt.Printf("Error writing %s to export: %v\n", file.name, err)
+			return
+		}
+	}
+	if err := addExportPicture(zw, user.PfpUrl); err != nil {
+		fmt.Printf("Error adding profile picture to export: %v\n", err)
+	}
+	if err := zw.Close(); err != nil {
+		fmt.Printf("Error finishing export: %v\n", err)
+	}
+}
+
+// collectAccountExport reads everything before any of the archive is sent,
+// so a failed query can still be answered with an error
+func collectAccountExport(c *gin.Context, q *queries.Queries, user queries.User) ([]exportFile, error) {
+	profile := profileJSON(user)
+	profile["created_at"] = user.CreatedAt
+	profile["updated_at"] = user.UpdatedAt
+	profile["has_password"] = user.HashedPassword != noPassword
+
+	twoFactor, err := q.GetUserTOTP(c, user.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	profile["two_factor_enabled"] = err == nil && twoFactor.ConfirmedAt.Valid
+
+	if change, err := q.GetPendingEmailChange(c, user.ID); err == nil {
+		profile["pending_email"] = change.NewEmail
+	}
+	if deletion, err := q.GetAccountDeletion(c, user.ID); err == nil && deletion.DeleteAfter.Valid {
+		profile["deletion_scheduled_at"] = deletion.DeleteAfter.Time
+	}
+
+	analytics, err := q.GetAnalyticsByUserId(c, user.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if err == nil {
+		profile["analytics"] = gin.H{
+			"total_urls":         analytics.TotalUrls,
+			"total_total_clicks": analytics.TotalTotalClicks,
+			"avg_daily_clicks":   analytics.AvgDailyClicks,
+			"updated_at":         analytics.UpdatedAt,
+		}
+	}
+
+	links, err := q.ExportUserURLs(c, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	linksJSON := make([]gin.H, 0, len(links))
+	for _, link := range links {
+		linksJSON = append(linksJSON, gin.H{
+			"id":                  link.ID,
+			"url":                 link.Url,
+			"short_url":           link.ShortUrl,
+			"total_clicks":        link.TotalClicks.Int32,
+			"last_clicked":        link.LastClicked,
+			"created_at":          link.CreatedAt,
+			"updated_at":          link.UpdatedAt,
+			"stats_public":        link.StatsPublic,
+			"conversion_tracking": link.ConversionTracking,
+		})
+	}
+
+	daily, err := q.ExportUserDailyClicks(c, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	dailyJSON := make([]gin.H, 0, len(daily))
+	for _, d := range daily {
+		dailyJSON = append(dailyJSON, gin.H{
+			"short_url": d.ShortUrl,
+			"day":       d.Day.Format("2006-01-02"),
+			"clicks":    d.Clicks,
+		})
+	}
+
+	hourly, err := q.ExportUserHourlyClicks(c, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	hourlyJSON := make([]gin.H, 0, len(hourly))
+	for _, h := range hourly {
+		hourlyJSON = append(hourlyJSON, gin.H{
+			"short_url": h.ShortUrl,
+			"hour":      h.Hour,
+			"clicks":    h.Clicks,
+		})
+	}
+
+	clicks, err := q.ExportUserClicks(c, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	clicksJSON := make([]gin.H, 0, len(clicks))
+	for _, click := range clicks {
+		clicksJSON = append(clicksJSON, gin.H{
+			"id":         click.ID,
+			"short_url":  click.ShortUrl,
+			"clicked_at": click.ClickedAt,
+			"referrer":   click.Referrer,
+			"variant":    click.Variant,
+			"country":    click.Country,
+			"device":     click.Device,
+			"ip":         click.Ip,
+		})
+	}
+
+	rollups, err := q.ExportUserClickRollups(c, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	rollupsJSON := make([]gin.H, 0, len(rollups))
+	for _, r := range rollups {
+		rollupsJSON = append(rollupsJSON, gin.H{
+			"short_url":        r.ShortUrl,
+			"day":              r.Day.Format("2006-01-02"),
+			"referrer":         r.Referrer,
+			"variant":          r.Variant,
+			"clicks":           r.Clicks,
+			"converted_clicks": r.ConvertedClicks,
+			"conversions":      r.Conversions,
+			"value":            r.Value,
+		})
+	}
+
+	conversions, err := q.ExportUserConversions(c, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	conversionsJSON := make([]gin.H, 0, len(conversions))
+	for _, cv := range conversions {
+		conversionsJSON = append(conversionsJSON, gin.H{
+			"id":         cv.ID,
+			"click_id":   cv.ClickID,
+			"short_url":  cv.ShortUrl,
+			"goal":       cv.Goal,
+			"value":      cv.Value,
+			"source":     cv.Source,
+			"created_at": cv.CreatedAt,
+		})
+	}
+
+	sessions, err := q.ExportUserSessions(c, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	sessionsJSON := make([]gin.H, 0, len(sessions))
+	for _, s := range sessions {
+		sessionsJSON = append(sessionsJSON, gin.H{
+			"id":           s.ID,
+			"device":       s.Device,
+			"ip":           s.Ip,
+			"user_agent":   s.UserAgent,
+			"created_at":   s.CreatedAt,
+			"last_used_at": s.LastUsedAt,
+			"expires_at":   s.ExpiresAt,
+			"revoked_at":   s.RevokedAt,
+		})
+	}
+
+	apiKeys, err := q.ExportUserAPIKeys(c, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	apiKeysJSON := make([]gin.H, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		response := apiKeyResponse(apiKey)
+		response["revoked_at"] = apiKey.RevokedAt
+		apiKeysJSON = append(apiKeysJSON, response)
+	}
+
+	identities, err := q.ListUserIdentities(c, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	identitiesJSON := make([]gin.H, 0, len(identities))
+	for _, identity := range identities {
+		identitiesJSON = append(identitiesJSON, gin.H{
+			"issuer":        identity.Issuer,
+			"subject":       identity.Subject,
+			"email":         identity.Email,
+			"created_at":    identity.CreatedAt,
+			"last_login_at": identity.LastLoginAt,
+		})
+	}
+
+	digests, err := q.ListDigestSubscriptionsByUser(c, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	digestsJSON := make([]gin.H, 0, len(digests))
+	for _, d := range digests {
+		digestsJSON = append(digestsJSON, gin.H{
+			"email":        d.Email,
+			"frequency":    d.Frequency,
+			"timezone":     d.Timezone,
+			"confirmed_at": d.ConfirmedAt,
+			"last_sent_at": d.LastSentAt,
+			"created_at":   d.CreatedAt,
+		})
+	}
+
+	rules, err := q.ListAlertRulesByUser(c, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	alertsJSON := make([]gin.H, 0, len(rules))
+	for _, rule := range rules {
+		alertsJSON = append(alertsJSON, gin.H{
+			"short_url":         rule.ShortUrl,
+			"kind":              rule.Kind,
+			"threshold":         rule.Threshold,
+			"window_hours":      rule.WindowHours,
+			"cooldown_minutes":  rule.CooldownMinutes,
+			"notify_email":      rule.NotifyEmail,
+			"webhook_url":       rule.WebhookUrl,
+			"enabled":           rule.Enabled,
+			"last_triggered_at": rule.LastTriggeredAt,
+			"created_at":        rule.CreatedAt,
+		})
+	}
+
+	failures, err := q.ExportUserAuthFailures(c, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	failuresJSON := make([]gin.H, 0, len(failures))
+	for _, f := range failures {
+		failuresJSON = append(failuresJSON, gin.H{
+			"scope":           f.Scope,
+			"failures":        f.Failures,
+			"last_failure_at": f.LastFailureAt,
+			"last_ip":         f.LastIp,
+			"blocked_until":   f.BlockedUntil,
+			"locked_at":       f.LockedAt,
+		})
+	}
+
+	workspaces, err := q.ListMemberWorkspaces(c, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	workspacesJSON := make([]gin.H, 0, len(workspaces))
+	for _, w := range workspaces {
+		workspacesJSON = append(workspacesJSON, gin.H{
+			"id":               w.ID,
+			"name":             w.Name,
+			"personal":         w.Personal,
+			"role":             w.Role,
+			"no_personal_data": w.NoPersonalData,
+			"created_at":       w.CreatedAt,
+		})
+	}
+
+	return []exportFile{
+		{"profile.json", profile},
+		{"links.json", linksJSON},
+		{"workspaces.json", workspacesJSON},
+		{"clicks/daily.json", dailyJSON},
+		{"clicks/hourly.json", hourlyJSON},
+		{"clicks/clicks.json", clicksJSON},
+		{"clicks/rollups.json", rollupsJSON},
+		{"clicks/conversions.json", conversionsJSON},
+		{"security/sessions.json", sessionsJSON},
+		{"security/api_keys.json", apiKeysJSON},
+		{"security/linked_accounts.json", identitiesJSON},
+		{"security/sign_in_failures.json", failuresJSON},
+		{"notifications/digests.json", digestsJSON},
+		{"notifications/alerts.json", alertsJSON},
+	}, nil
+}
+
+func addExportPicture(zw *zip.Writer, pfpURL string) error {
+	path, ok := services.UploadedPfpPath(pfpUploadDir, pfpURL)
+	if !ok {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w, err := zw.Create("profile_picture" + filepath.Ext(pfpURL))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// RequestAccountDeletionHandler mails the caller a link to confirm deleting
+// their account. Nothing is deleted until it's followed, and then only after
+// the grace period.
+func RequestAccountDeletionHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if accountDeleter == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Account deletion is not configured"})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	user, err := q.GetUserById(c, userUUID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Could not find user"})
+		return
+	}
+
+	// shared workspaces can't be left without an owner
+	soleOwned, err := q.ListSoleOwnedWorkspaces(c, userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not request account deletion"})
+		return
+	}
+	if len(soleOwned) > 0 {
+		workspaces := make([]gin.H, 0, len(soleOwned))
+		for _, w := range soleOwned {
+			workspaces = append(workspaces, gin.H{"id": w.ID, "name": w.Name})
+		}
+		c.JSON(http.StatusConflict, gin.H{
+			"error":      "Make someone else an owner of your shared workspaces first",
+			"workspaces": workspaces,
+		})
+		return
+	}
+
+	token, err := randomHex(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	requested, err := q.RequestAccountDeletion(c, queries.RequestAccountDeletionParams{
+		UserID:    userUUID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(accountDeletionLinkTTL),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not request account deletion"})
+		return
+	}
+	if requested == 0 {
+		deletion, err := q.GetAccountDeletion(c, userUUID)
+		if err == nil && deletion.DeleteAfter.Valid {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":                 "Your account is already scheduled for deletion",
+				"deletion_scheduled_at": deletion.DeleteAfter.Time,
+			})
+			return
+		}
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "A deletion was just requested, check your email or try again in a minute"})
+		return
+	}
+
+	apiURL := os.Getenv("API_URL")
+	if apiURL == "" {
+		apiURL = "http://localhost:8080/api/v1"
+	}
+	link := fmt.Sprintf("%s/auth/confirm-account-deletion?token=%s", apiURL, url.QueryEscape(token))
+	graceDays := int(accountDeleter.GracePeriod().Hours() / 24)
+
+	emailBody := fmt.Sprintf("Someone asked to delete your nano account. To confirm, follow this link: %s<br><br>Your account, links and click data will then be deleted after %d days, and you can cancel any time before that from your profile. The link works for 24 hours. If this wasn't you, ignore this email and change your password.", link, graceDays)
+	if err := mailClient.SendEmail(user.Email, "Confirm deleting your account", emailBody); err != nil {
+		fmt.Printf("Error sending account deletion email: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not send confirmation email"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Check your email to confirm deleting your account"})
+}
+
+// ConfirmAccountDeletionHandler is where the link from the deletion email
+// lands. It schedules the deletion for the end of the grace period.
+func ConfirmAccountDeletionHandler(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" || accountDeleter == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	deletion, err := q.ConfirmAccountDeletion(c, queries.ConfirmAccountDeletionParams{
+		TokenHash:   hashToken(token),
+		DeleteAfter: sql.NullTime{Time: time.Now().Add(accountDeleter.GracePeriod()), Valid: true},
+	})
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not confirm account deletion"})
+		return
+	}
+
+	if user, err := q.GetUserById(c, deletion.UserID); err == nil {
+		go func(email string, deleteAfter time.Time) {
+			emailBody := fmt.Sprintf("Your nano account is scheduled for deletion on %s UTC. Until then you can still sign in and cancel it from your profile.", deleteAfter.UTC().Format("January 2, 2006 15:04"))
+			if err := mailClient.SendEmail(email, "Your account will be deleted", emailBody); err != nil {
+				fmt.Printf("Error sending deletion scheduled notice: %v\n", err)
+			}
+		}(user.Email, deletion.DeleteAfter)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":               "Your account is scheduled for deletion",
+		"deletion_scheduled_at": deletion.DeleteAfter,
+	})
+}
+
+// CancelAccountDeletionHandler keeps the caller's account, whether the
+// deletion was confirmed yet or not
+func CancelAccountDeletionHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	cancelled, err := q.CancelAccountDeletion(c, userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not cancel account deletion"})
+		return
+	}
+	if cancelled == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Your account is not scheduled for deletion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deletion cancelled"})
+}
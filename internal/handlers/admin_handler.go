@@ -0,0 +1,482 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+	"github.com/rvif/nano-url/internal/middleware"
+)
+
+// adminActor names who made an admin change, for the log
+func adminActor(c *gin.Context) string {
+	if userID, ok := c.Get("user_id"); ok {
+		return fmt.Sprintf("%s %v", c.GetString("role"), userID)
+	}
+	return "operator"
+}
+
+// adminPage reads ?limit= (default 50, at most 200) and ?offset=
+func adminPage(c *gin.Context) (int32, int32, bool) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 200"})
+		return 0, 0, false
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be 0 or more"})
+		return 0, 0, false
+	}
+	return int32(limit), int32(offset), true
+}
+
+// optionalBool reads a true/false query parameter; absent matches both
+func optionalBool(c *gin.Context, name string) (sql.NullBool, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return sql.NullBool{}, true
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be true or false"})
+		return sql.NullBool{}, false
+	}
+	return sql.NullBool{Bool: b, Valid: true}, true
+}
+
+// AdminListUsersHandler lists accounts, newest first. ?q= matches part of
+// the email or username; ?role= and ?suspended= filter.
+func AdminListUsersHandler(c *gin.Context) {
+	limit, offset, ok := adminPage(c)
+	if !ok {
+		return
+	}
+	suspended, ok := optionalBool(c, "suspended")
+	if !ok {
+		return
+	}
+
+	var role sql.NullString
+	if r := c.Query("role"); r != "" {
+		if !slices.Contains(middleware.Roles, r) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role must be one of " + strings.Join(middleware.Roles, ", ")})
+			return
+		}
+		role = sql.NullString{String: r, Valid: true}
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	users, err := q.SearchUsers(c, queries.SearchUsersParams{
+		Search:    strings.TrimSpace(c.Query("q")),
+		Role:      role,
+		Suspended: suspended,
+		RowLimit:  limit,
+		RowOffset: offset,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not list users"})
+		return
+	}
+
+	response := make([]gin.H, 0, len(users))
+	for _, user := range users {
+		response = append(response, gin.H{
+			"id":                user.ID,
+			"username":          user.Username,
+			"email":             user.Email,
+			"role":              user.Role,
+			"created_at":        user.CreatedAt,
+			"email_verified":    user.EmailVerifiedAt.Valid,
+			"suspended_at":      user.SuspendedAt,
+			"suspension_reason": user.SuspensionReason,
+			"links":             user.Links,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": response, "limit": limit, "offset": offset})
+}
+
+// AdminGetUserHandler shows one account with its role, suspension and
+// analytics
+func AdminGetUserHandler(c *gin.Context) {
+	userUUID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	user, err := q.GetUserById(c, userUUID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	response := profileJSON(user)
+	response["role"] = user.Role
+	response["created_at"] = user.CreatedAt
+	response["suspended_at"] = user.SuspendedAt
+	response["suspension_reason"] = user.SuspensionReason
+	response["has_password"] = user.HashedPassword != noPassword
+
+	if analytics, err := q.GetAnalyticsByUserId(c, userUUID); err == nil {
+		response["total_urls"] = analytics.TotalUrls
+		response["total_clicks"] = analytics.TotalTotalClicks
+	}
+	if sessions, err := q.ListUserSessions(c, userUUID); err == nil {
+		response["active_sessions"] = len(sessions)
+	}
+	if deletion, err := q.GetAccountDeletion(c, userUUID); err == nil && deletion.DeleteAfter.Valid {
+		response["deletion_scheduled_at"] = deletion.DeleteAfter.Time
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+type AdminReasonRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// AdminSuspendUserHandler stops an account signing in and its links
+// redirecting, and signs it out everywhere
+func AdminSuspendUserHandler(c *gin.Context) {
+	userUUID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req AdminReasonRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if actorID, ok := c.Get("user_id"); ok && actorID == userUUID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't suspend yourself"})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	suspended, err := q.SuspendUser(c, queries.SuspendUserParams{
+		ID:               userUUID,
+		SuspensionReason: strings.TrimSpace(req.Reason),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not suspend user"})
+		return
+	}
+	if suspended == 0 {
+		if _, err := q.GetUserById(c, userUUID); err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already suspended"})
+		return
+	}
+
+	revoked, err := q.RevokeSessions(c, queries.RevokeSessionsParams{UserID: userUUID})
+	if err != nil {
+		fmt.Printf("Error revoking sessions of suspended user %s: %v\n", userUUID, err)
+	}
+
+	log.Printf("User %s suspended by %s: %s", userUUID, adminActor(c), req.Reason)
+	c.JSON(http.StatusOK, gin.H{"message": "User suspended", "sessions_revoked": len(revoked)})
+}
+
+// AdminUnsuspendUserHandler lets a suspended account sign in again
+func AdminUnsuspendUserHandler(c *gin.Context) {
+	userUUID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	unsuspended, err := q.UnsuspendUser(c, userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not unsuspend user"})
+		return
+	}
+	if unsuspended == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not suspended"})
+		return
+	}
+
+	log.Printf("User %s unsuspended by %s", userUUID, adminActor(c))
+	c.JSON(http.StatusOK, gin.H{"message": "User unsuspended"})
+}
+
+type AdminSetRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// AdminSetRoleHandler makes an account a user, support or admin
+func AdminSetRoleHandler(c *gin.Context) {
+	userUUID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req AdminSetRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !slices.Contains(middleware.Roles, req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be one of " + strings.Join(middleware.Roles, ", ")})
+		return
+	}
+
+	// so the last admin can't lock everyone out by accident
+	if actorID, ok := c.Get("user_id"); ok && actorID == userUUID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't change your own role"})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	updated, err := q.SetUserRole(c, queries.SetUserRoleParams{
+		ID:   userUUID,
+		Role: req.Role,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not change role"})
+		return
+	}
+	if updated == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	log.Printf("User %s made %s by %s", userUUID, req.Role, adminActor(c))
+	c.JSON(http.StatusOK, gin.H{"message": "Role changed", "role": req.Role})
+}
+
+// AdminListLinksHandler lists links of every user, newest first. ?q=
+// matches part of the slug or destination; ?user_id= and ?disabled= filter.
+func AdminListLinksHandler(c *gin.Context) {
+	limit, offset, ok := adminPage(c)
+	if !ok {
+		return
+	}
+	disabled, ok := optionalBool(c, "disabled")
+	if !ok {
+		return
+	}
+
+	var ownerID uuid.NullUUID
+	if id := c.Query("user_id"); id != "" {
+		parsed, err := uuid.Parse(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		ownerID = uuid.NullUUID{UUID: parsed, Valid: true}
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	links, err := q.SearchURLs(c, queries.SearchURLsParams{
+		Search:    strings.TrimSpace(c.Query("q")),
+		OwnerID:   ownerID,
+		Disabled:  disabled,
+		RowLimit:  limit,
+		RowOffset: offset,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not list links"})
+		return
+	}
+
+	response := make([]gin.H, 0, len(links))
+	for _, link := range links {
+		response = append(response, gin.H{
+			"id":              link.ID,
+			"url":             link.Url,
+			"short_url":       link.ShortUrl,
+			"total_clicks":    link.TotalClicks.Int32,
+			"last_clicked":    link.LastClicked,
+			"created_at":      link.CreatedAt,
+			"disabled_at":     link.DisabledAt,
+			"disabled_reason": link.DisabledReason,
+			"owner": gin.H{
+				"id":       link.OwnerID,
+				"username": link.OwnerUsername,
+				"email":    link.OwnerEmail,
+			},
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"links": response, "limit": limit, "offset": offset})
+}
+
+// AdminGetLinkHandler shows any link with its owner and the last 30 days of
+// clicks
+func AdminGetLinkHandler(c *gin.Context) {
+	shortURL := c.Param("short_url")
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	link, err := q.GetURLWithOwner(c, shortURL)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	response := gin.H{
+		"id":                  link.ID,
+		"url":                 link.Url,
+		"short_url":           link.ShortUrl,
+		"total_clicks":        link.TotalClicks.Int32,
+		"last_clicked":        link.LastClicked,
+		"created_at":          link.CreatedAt,
+		"updated_at":          link.UpdatedAt,
+		"stats_public":        link.StatsPublic,
+		"conversion_tracking": link.ConversionTracking,
+		"disabled_at":         link.DisabledAt,
+		"disabled_reason":     link.DisabledReason,
+		"owner": gin.H{
+			"id":           link.OwnerID,
+			"username":     link.OwnerUsername,
+			"email":        link.OwnerEmail,
+			"suspended_at": link.OwnerSuspendedAt,
+		},
+	}
+
+	if _, history, err := urlClickHistory(c, q, shortURL, time.UTC, 30); err == nil {
+		response["daily_clicks"] = history
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// AdminDisableLinkHandler takes down an abusive link: it answers 410 instead
+// of redirecting until it's enabled again
+func AdminDisableLinkHandler(c *gin.Context) {
+	var req AdminReasonRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	shortURL := c.Param("short_url")
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	disabled, err := q.DisableURL(c, queries.DisableURLParams{
+		ShortUrl:       shortURL,
+		DisabledReason: strings.TrimSpace(req.Reason),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not disable link"})
+		return
+	}
+	if disabled == 0 {
+		if exists, err := q.SlugExists(c, shortURL); err == nil && !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": "Link is already disabled"})
+		return
+	}
+
+	log.Printf("Link %s disabled by %s: %s", shortURL, adminActor(c), req.Reason)
+	c.JSON(http.StatusOK, gin.H{"message": "Link disabled"})
+}
+
+// AdminEnableLinkHandler lets a disabled link redirect again
+func AdminEnableLinkHandler(c *gin.Context) {
+	shortURL := c.Param("short_url")
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	enabled, err := q.EnableURL(c, shortURL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not enable link"})
+		return
+	}
+	if enabled == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link is not disabled"})
+		return
+	}
+
+	log.Printf("Link %s enabled by %s", shortURL, adminActor(c))
+	c.JSON(http.StatusOK, gin.H{"message": "Link enabled"})
+}
+
+// AdminStatsHandler gives system-wide totals and the background jobs' state
+func AdminStatsHandler(c *gin.Context) {
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	stats, err := q.GetSystemStats(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not get stats"})
+		return
+	}
+
+	response := gin.H{
+		"users": gin.H{
+			"total":             stats.Users,
+			"verified":          stats.VerifiedUsers,
+			"suspended":         stats.SuspendedUsers,
+			"signups_last_day":  stats.SignupsLastDay,
+			"signups_last_week": stats.SignupsLastWeek,
+			"scheduled_deletes": stats.ScheduledDeletions,
+		},
+		"links": gin.H{
+			"total":    stats.Links,
+			"disabled": stats.DisabledLinks,
+			"last_day": stats.LinksLastDay,
+		},
+		"clicks": gin.H{
+			"total": stats.TotalClicks,
+			"today": stats.ClicksToday,
+		},
+		"active_sessions": stats.ActiveSessions,
+		"active_api_keys": stats.ActiveApiKeys,
+	}
+	if clickAggregator != nil {
+		response["click_aggregator"] = clickAggregator.Stats()
+	}
+	if analyticsReconciler != nil {
+		response["analytics_reconciler"] = analyticsReconciler.LastRun()
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+	"github.com/rvif/nano-url/internal/services"
+)
+
+type CreateAlertRequest struct {
+	// leave empty to watch every link of the account
+	ShortURL string `json:"short_url"`
+	// threshold: more than Threshold clicks in WindowHours
+	// no_clicks: no clicks at all in WindowHours
+	// spike: clicks in WindowHours reach Threshold times the trailing 7-day average
+	Kind            string  `json:"kind" binding:"required,oneof=threshold no_clicks spike"`
+	Threshold       float64 `json:"threshold" binding:"gte=0"`
+	WindowHours     int32   `json:"window_hours" binding:"required,min=1,max=720"`
+	CooldownMinutes int32   `json:"cooldown_minutes" binding:"omitempty,min=1,max=43200"`
+	NotifyEmail     *bool   `json:"notify_email"`
+	WebhookURL      string  `json:"webhook_url"`
+}
+
+func ListAlertsHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	rules, err := q.ListAlertRulesByUser(c, userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not get alerts"})
+		return
+	}
+
+	response := make([]gin.H, 0, len(rules))
+	for _, rule := range rules {
+		response = append(response, gin.H{
+			"id":                rule.ID,
+			"short_url":         rule.ShortUrl,
+			"kind":              rule.Kind,
+			"threshold":         rule.Threshold,
+			"window_hours":      rule.WindowHours,
+			"cooldown_minutes":  rule.CooldownMinutes,
+			"notify_email":      rule.NotifyEmail,
+			"webhook_url":       rule.WebhookUrl,
+			"enabled":           rule.Enabled,
+			"last_triggered_at": rule.LastTriggeredAt,
+			"created_at":        rule.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func CreateAlertHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req CreateAlertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch {
+	case req.Kind == "threshold" && req.Threshold < 1:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "threshold must be at least 1 click"})
+		return
+	case req.Kind == "spike" && req.Threshold <= 1:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "spike threshold must be a factor above 1"})
+		return
+	}
+
+	if req.WebhookURL != "" {
+		err := services.CheckWebhookURL(c, req.WebhookURL)
+		if err == services.ErrWebhookNotPublic {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Webhook URL must point to a public address"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook URL"})
+			return
+		}
+	}
+
+	notifyEmail := req.NotifyEmail == nil || *req.NotifyEmail
+	if !notifyEmail && req.WebhookURL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An alert needs email or a webhook to notify"})
+		return
+	}
+
+	if req.CooldownMinutes == 0 {
+		req.CooldownMinutes = 60
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	var urlID uuid.NullUUID
+	if req.ShortURL != "" {
+		link, ok := authorizeLink(c, q, req.ShortURL, workspaceViewer)
+		if !ok {
+			return
+		}
+		urlID = uuid.NullUUID{UUID: link.ID, Valid: true}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create alert"})
+		return
+	}
+
+	rule, err := q.CreateAlertRule(c, queries.CreateAlertRuleParams{
+		UserID:          userUUID,
+		UrlID:           urlID,
+		Kind:            req.Kind,
+		Threshold:       req.Threshold,
+		WindowHours:     req.WindowHours,
+		CooldownMinutes: req.CooldownMinutes,
+		NotifyEmail:     notifyEmail,
+		WebhookUrl:      sql.NullString{String: req.WebhookURL, Valid: req.WebhookURL != ""},
+		WebhookSecret:   hex.EncodeToString(secret),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create alert"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":               rule.ID,
+		"short_url":        req.ShortURL,
+		"kind":             rule.Kind,
+		"threshold":        rule.Threshold,
+		"window_hours":     rule.WindowHours,
+		"cooldown_minutes": rule.CooldownMinutes,
+		"notify_email":     rule.NotifyEmail,
+		"webhook_url":      rule.WebhookUrl,
+		"enabled":          rule.Enabled,
+		"created_at":       rule.CreatedAt,
+		// only shown once, used to verify the X-Nano-Signature header on webhooks
+		"webhook_secret": rule.WebhookSecret,
+	})
+}
+
+func DeleteAlertHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	ruleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid alert ID"})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	deleted, err := q.DeleteAlertRule(c, queries.DeleteAlertRuleParams{
+		ID:     ruleID,
+		UserID: userUUID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete alert"})
+		return
+	}
+	if deleted == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Alert deleted"})
+}
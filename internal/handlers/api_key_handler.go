@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+	"github.com/rvif/nano-url/internal/middleware"
+)
+
+// most active keys an account can hold
+const maxAPIKeys = 25
+
+// characters of a key kept in the clear, prefix included
+const apiKeyDisplayLength = 12
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// CreateAPIKeyHandler mints a personal API key. The key is only ever in this
+// response, what's stored is its hash.
+func CreateAPIKeyHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must be between 1 and 100 characters"})
+		return
+	}
+
+	if len(req.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one scope is required"})
+		return
+	}
+	var scopes []string
+	for _, scope := range req.Scopes {
+		if !slices.Contains(middleware.APIKeyScopes, scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope: " + scope, "scopes": middleware.APIKeyScopes})
+			return
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > 365 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in_days must be between 1 and 365, or 0 for no expiry"})
+		return
+	}
+	var expiresAt sql.NullTime
+	if req.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().AddDate(0, 0, req.ExpiresInDays), Valid: true}
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	count, err := q.CountUserAPIKeys(c, userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create API key"})
+		return
+	}
+	if count >= maxAPIKeys {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "API key limit reached, revoke one first"})
+		return
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create API key"})
+		return
+	}
+	key := middleware.APIKeyPrefix + hex.EncodeToString(raw)
+
+	apiKey, err := q.CreateAPIKey(c, queries.CreateAPIKeyParams{
+		UserID:    userUUID,
+		Name:      req.Name,
+		Prefix:    key[:apiKeyDisplayLength],
+		KeyHash:   hashToken(key),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create API key"})
+		return
+	}
+
+	response := apiKeyResponse(apiKey)
+	response["key"] = key
+	c.JSON(http.StatusCreated, response)
+}
+
+// ListAPIKeysHandler lists the caller's active keys, without the keys themselves
+func ListAPIKeysHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	apiKeys, err := q.ListUserAPIKeys(c, userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not get API keys"})
+		return
+	}
+
+	response := make([]gin.H, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		response = append(response, apiKeyResponse(apiKey))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"api_keys": response, "scopes": middleware.APIKeyScopes})
+}
+
+// RevokeAPIKeyHandler stops one of the caller's keys working immediately
+func RevokeAPIKeyHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	keyID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	revoked, err := q.RevokeAPIKey(c, queries.RevokeAPIKeyParams{
+		ID:     keyID,
+		UserID: userUUID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke API key"})
+		return
+	}
+	if revoked == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
+
+func apiKeyResponse(apiKey queries.ApiKey) gin.H {
+	return gin.H{
+		"id":           apiKey.ID,
+		"name":         apiKey.Name,
+		"prefix":       apiKey.Prefix,
+		"scopes":       apiKey.Scopes,
+		"expires_at":   apiKey.ExpiresAt,
+		"last_used_at": apiKey.LastUsedAt,
+		"created_at":   apiKey.CreatedAt,
+	}
+}
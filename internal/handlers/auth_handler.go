@@ -1,30 +1,37 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/rvif/nano-url/db"
 	"github.com/rvif/nano-url/internal/db/queries"
 	"github.com/rvif/nano-url/internal/mailer"
+	"github.com/rvif/nano-url/internal/tokens"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
-var jwtSecret = os.Getenv("JWT_SECRET")
+var tokenService *tokens.Service
+
+func InitTokenService(service *tokens.Service) {
+	tokenService = service
+}
 
 var mailClient *mailer.Mailer
 
-func InitMailer(username, password string) {
-	mailClient = mailer.NewMailer(username, password)
+func InitMailer(m *mailer.Mailer) {
+	mailClient = m
 }
 
 type RegisterRequest struct {
@@ -47,7 +54,7 @@ func RegisterHandler(c *gin.Context) {
 	var pfpURL string
 
 	// default profile picture path
-	defaultPfpPath := "/images/default_pfp.jpg"
+	defaultPfpPath := defaultPfpURL
 
 	// check if public/images/default_pfp.jpg exists
 	if _, err := os.Stat("./public/images/default_pfp.jpg"); os.IsNotExist(err) {
@@ -57,27 +64,16 @@ func RegisterHandler(c *gin.Context) {
 	}
 
 	if err == nil && file != nil {
-		// ensure public/images directory exists
-		uploadDir := "./public/images"
-		if err := os.MkdirAll(uploadDir, 0755); err != nil {
-			fmt.Printf("Error creating directory %s: %v\n", uploadDir, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload directory"})
+		pfpURL, err = saveProfilePicture(c, fileHeader)
+		if err == errInvalidPfp {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-
-		// generate unique filename
-		filename := strings.ReplaceAll(uuid.New().String(), "-", "") + filepath.Ext(fileHeader.Filename)
-		uploadPath := filepath.Join(uploadDir, filename)
-
-		// save the file with proper error handling
-		if err := c.SaveUploadedFile(fileHeader, uploadPath); err != nil {
-			fmt.Printf("Error saving file to %s: %v\n", uploadPath, err)
+		if err != nil {
+			fmt.Printf("Error saving profile picture: %v\n", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save profile picture"})
 			return
 		}
-
-		pfpURL = "/images/" + filename
-		fmt.Printf("Successfully saved profile picture to %s\n", uploadPath)
 	} else {
 		pfpURL = defaultPfpPath
 		fmt.Printf("No profile picture uploaded, using default: %s\n", defaultPfpPath)
@@ -130,9 +126,25 @@ func RegisterHandler(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "User registered successfully", "user": user})
+	// the account stays unverified until the link is followed; a failed send
+	// can be retried from the resend endpoint
+	emailSent := true
+	if err := sendVerificationEmail(c, q, user.ID); err != nil {
+		fmt.Printf("Error sending verification email to user %s: %v\n", user.ID, err)
+		emailSent = false
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":                 "User registered successfully",
+		"user":                    user,
+		"email_verified":          false,
+		"verification_email_sent": emailSent,
+	})
 }
 
+// compared against when there's no account, see LoginHandler
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("nano-dummy-password"), bcrypt.DefaultCost)
+
 type LoginRequest struct {
 	Email    string `json:"email"      binding:"required,email"`
 	Password string `json:"password"   binding:"required"`
@@ -153,41 +165,49 @@ func LoginHandler(c *gin.Context) {
 	DB := db.GetDB()
 	q := queries.New(DB)
 
+	if !allowAttempt(c, q, loginIPThrottle, c.ClientIP()) ||
+		!allowAttempt(c, q, loginAccountThrottle, throttleEmailKey(req.Email)) {
+		return
+	}
+
 	user, err := q.GetUserByEmail(c, req.Email)
 	if err != nil {
+		// as slow as a wrong password, so timing doesn't reveal the account
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+		recordLoginFailure(c, q, req.Email, uuid.NullUUID{})
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(req.Password)); err != nil {
+		recordLoginFailure(c, q, req.Email, uuid.NullUUID{UUID: user.ID, Valid: true})
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID.String(),
-		"expiry":  time.Now().Add(time.Hour * 72).Unix(),
-	})
-
-	// sign the token with the secret
-	accessTokenStr, err := accessToken.SignedString([]byte(jwtSecret))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failure in creating token"})
+	// only told to whoever knows the password
+	if user.SuspendedAt.Valid {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This account has been suspended", "reason": user.SuspensionReason})
 		return
 	}
 
-	refreshToken := uuid.New().String()
-	expiry := time.Now().Add(time.Hour * 24 * 7) // 7 days
-	err = q.StoreResetToken(c, queries.StoreResetTokenParams{
-		UserID: user.ID,
-		Token:  refreshToken,
-		Expiry: expiry,
-	})
+	// accounts with two-factor authentication finish signing in at
+	// /auth/2fa/verify with the challenge token
+	twoFactor, err := q.GetUserTOTP(c, user.ID)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if err == nil && twoFactor.ConfirmedAt.Valid {
+		startLoginChallenge(c, q, user.ID)
+		return
+	}
 
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failure in storing refresh token"})
+	accessTokenStr, refreshToken, ok := startSession(c, q, user.ID)
+	if !ok {
 		return
 	}
+	clearFailures(c, q, loginAccountThrottle, throttleEmailKey(req.Email))
 
 	// Check whether the request is an API request or a browser request
 	acceptHeader := c.Request.Header.Get("Accept")
@@ -202,6 +222,58 @@ func LoginHandler(c *gin.Context) {
 	}
 }
 
+// startSession signs the user in on this device: a new session with its
+// first access and refresh tokens. On failure it writes the error response.
+func startSession(c *gin.Context, q *queries.Queries, userID uuid.UUID) (string, string, bool) {
+	// suspended accounts can't sign in by any route
+	_, err := q.GetActiveUserRole(c, userID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This account has been suspended"})
+		return "", "", false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return "", "", false
+	}
+
+	// dead sessions are only kept around until then for reuse detection
+	if err := q.DeleteExpiredSessions(c, userID); err != nil {
+		fmt.Printf("Error deleting expired sessions for user %s: %v\n", userID, err)
+	}
+
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+
+	sessionID, err := q.CreateSession(c, queries.CreateSessionParams{
+		UserID:    userID,
+		Device:    deviceType(userAgent),
+		Ip:        anonymizedIP(c),
+		UserAgent: userAgent,
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failure in creating session"})
+		return "", "", false
+	}
+
+	accessTokenStr, err := issueAccessToken(c, q, userID, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failure in creating token"})
+		return "", "", false
+	}
+
+	// the session's refresh tokens are its token family
+	refreshToken, err := issueRefreshToken(c, q, userID, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failure in storing refresh token"})
+		return "", "", false
+	}
+
+	return accessTokenStr, refreshToken, true
+}
+
 func MeHandler(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -224,12 +296,15 @@ func MeHandler(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"id":       user.ID,
-		"username": user.Username,
-		"email":    user.Email,
-		"pfpUrl":   user.PfpUrl,
-	})
+	response := profileJSON(user)
+	if change, err := q.GetPendingEmailChange(c, userUUID); err == nil {
+		response["pending_email"] = change.NewEmail
+	}
+	if deletion, err := q.GetAccountDeletion(c, userUUID); err == nil && deletion.DeleteAfter.Valid {
+		response["deletion_scheduled_at"] = deletion.DeleteAfter.Time
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 type ForgotPasswordRequest struct {
@@ -246,11 +321,32 @@ func ForgotPasswordHandler(c *gin.Context) {
 	DB := db.GetDB()
 	q := queries.New(DB)
 
+	if !allowAttempt(c, q, resetRequestIPThrottle, c.ClientIP()) {
+		return
+	}
+	recordFailure(c, q, resetRequestIPThrottle, c.ClientIP(), uuid.NullUUID{})
+
+	// the response is the same whether or not the email has an account, and
+	// whether or not its mails are being throttled
+	const sentMessage = "If an account exists for this email, a password reset link has been sent"
+
+	emailKey := throttleEmailKey(req.Email)
+	_, err := q.GetAuthThrottleBlock(c, queries.GetAuthThrottleBlockParams{
+		Scope: resetRequestAccountThrottle.scope,
+		Key:   emailKey,
+	})
+	if err == nil {
+		c.JSON(http.StatusOK, gin.H{"message": sentMessage})
+		return
+	}
+
 	user, err := q.GetUserByEmail(c, req.Email)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		recordFailure(c, q, resetRequestAccountThrottle, emailKey, uuid.NullUUID{})
+		c.JSON(http.StatusOK, gin.H{"message": sentMessage})
 		return
 	}
+	recordFailure(c, q, resetRequestAccountThrottle, emailKey, uuid.NullUUID{UUID: user.ID, Valid: true})
 
 	userID := user.ID
 	resetToken := uuid.New().String()
@@ -276,14 +372,15 @@ func ForgotPasswordHandler(c *gin.Context) {
 	resetURL := fmt.Sprintf("%s/auth/reset-password?token=%s", frontendURL, resetToken)
 	emailBody := fmt.Sprintf("Click here to reset your password: %s", resetURL)
 
-	err = mailClient.SendEmail(req.Email, "Password Reset", emailBody)
-	if err != nil {
-
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failure in sending email"})
-		return
-	}
+	// sent in the background so the response takes as long as for an
+	// unknown email
+	go func(email string) {
+		if err := mailClient.SendEmail(email, "Password Reset", emailBody); err != nil {
+			fmt.Printf("Error sending password reset email: %v\n", err)
+		}
+	}(user.Email)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Password reset email sent"})
+	c.JSON(http.StatusOK, gin.H{"message": sentMessage})
 }
 
 type ResetPasswordRequest struct {
@@ -301,8 +398,13 @@ func ResetPasswordHandler(c *gin.Context) {
 	DB := db.GetDB()
 	q := queries.New(DB)
 
+	if !allowAttempt(c, q, resetTokenIPThrottle, c.ClientIP()) {
+		return
+	}
+
 	resetTokenDetails, err := q.GetUserByResetToken(c, req.Token)
 	if err != nil {
+		recordFailure(c, q, resetTokenIPThrottle, c.ClientIP(), uuid.NullUUID{})
 		c.JSON(http.StatusNotFound, gin.H{"error": "Invalid or expired reset token"})
 		return
 	}
@@ -334,45 +436,165 @@ func ResetPasswordHandler(c *gin.Context) {
 		return
 	}
 
+	// a new password signs every existing session out
+	if _, err := q.RevokeSessions(c, queries.RevokeSessionsParams{UserID: resetTokenDetails.UserID}); err != nil {
+		fmt.Printf("Error revoking sessions for user %s: %v\n", resetTokenDetails.UserID, err)
+	}
+
+	// and proves ownership, so it lifts a lockout
+	if _, err := q.ClearUserAuthThrottles(c, uuid.NullUUID{UUID: resetTokenDetails.UserID, Valid: true}); err != nil {
+		fmt.Printf("Error clearing throttles for user %s: %v\n", resetTokenDetails.UserID, err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Password updated successfully"})
 }
 
+// access tokens can't be renewed, only replaced through a refresh
+const accessTokenTTL = 72 * time.Hour
+
+// refresh tokens (and so sessions) live for a week from their last rotation
+const refreshTokenTTL = 7 * 24 * time.Hour
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueAccessToken signs an access token for the session and records its jti,
+// so revoking the session can denylist it
+func issueAccessToken(c *gin.Context, q *queries.Queries, userID, sessionID uuid.UUID) (string, error) {
+	jti := uuid.New()
+	expiry := time.Now().Add(accessTokenTTL)
+
+	err := q.StoreAccessToken(c, queries.StoreAccessTokenParams{
+		Jti:       jti,
+		SessionID: sessionID,
+		Expiry:    expiry,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return tokenService.IssueAccessToken(userID, sessionID, jti, expiry)
+}
+
+// issueRefreshToken stores a new refresh token in the given family and
+// returns it. Only its hash is kept.
+func issueRefreshToken(c *gin.Context, q *queries.Queries, userID, familyID uuid.UUID) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(raw)
+
+	err := q.StoreRefreshToken(c, queries.StoreRefreshTokenParams{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(token),
+		Expiry:    time.Now().Add(refreshTokenTTL),
+	})
+	return token, err
+}
+
 // Ts refreshes the access token
 // so if a person has checked the remember me option, we store refresh token in the localstorage
 // we can hit this refresh token endpoint periodically or whenever the access token expires
 // we'll send a new access, refresh token in the header again
+//
+// Refresh tokens are single use: each call rotates it and returns the
+// replacement. Presenting a rotated token again revokes its whole family
+// (the session, access tokens included), since either the client or an attacker is holding a stolen copy.
+// There's no allowance for two tabs refreshing at once: the replacement is
+// only stored hashed, so it can't be handed out twice, and clients have to
+// share one refresh between tabs.
 func RefreshTokenHandler(c *gin.Context) {
-	refreshToken := c.GetHeader("Authorization")
+	refreshToken := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
 	if refreshToken == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing refresh token"})
 		return
 	}
+	tokenHash := hashToken(refreshToken)
 
 	DB := db.GetDB()
-	q := queries.New(DB)
+	if !allowAttempt(c, queries.New(DB), refreshIPThrottle, c.ClientIP()) {
+		return
+	}
 
-	resetTokenDetails, err := q.GetUserByResetToken(c, refreshToken)
+	tx, err := DB.BeginTx(c, nil)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Invalid or expired refresh token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
+	defer tx.Rollback()
 
-	if time.Now().After(resetTokenDetails.Expiry) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Invalid or expired refresh token"})
+	q := queries.New(DB).WithTx(tx)
+
+	claimed, err := q.ClaimRefreshToken(c, tokenHash)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		rejectRefreshToken(c, queries.New(DB), tokenHash)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
-	newAccessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": resetTokenDetails.UserID.String(),
-		"expiry":  time.Now().Add(time.Hour * 72).Unix(),
+	err = q.TouchSession(c, queries.TouchSessionParams{
+		ID:        claimed.FamilyID,
+		Ip:        anonymizedIP(c),
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
 	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
 
-	// Sign the token with the secret
-	newAccessTokenStr, err := newAccessToken.SignedString([]byte(jwtSecret))
+	newRefreshToken, err := issueRefreshToken(c, q, claimed.UserID, claimed.FamilyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failure in storing refresh token"})
+		return
+	}
+
+	newAccessTokenStr, err := issueAccessToken(c, q, claimed.UserID, claimed.FamilyID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failure in creating token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"access_token": newAccessTokenStr})
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failure in storing refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"access_token": newAccessTokenStr, "refresh_token": newRefreshToken})
+}
+
+// rejectRefreshToken explains why a token couldn't be exchanged, revoking
+// its session when it's a rotated token being replayed
+func rejectRefreshToken(c *gin.Context, q *queries.Queries, tokenHash string) {
+	token, err := q.GetRefreshTokenByHash(c, tokenHash)
+	if err != nil || time.Now().After(token.Expiry) {
+		recordFailure(c, q, refreshIPThrottle, c.ClientIP(), uuid.NullUUID{})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	}
+
+	recordFailure(c, q, refreshIPThrottle, c.ClientIP(), uuid.NullUUID{})
+
+	if token.RevokedAt.Valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token revoked"})
+		return
+	}
+
+	_, err = q.RevokeSessions(c, queries.RevokeSessionsParams{
+		UserID: token.UserID,
+		ID:     uuid.NullUUID{UUID: token.FamilyID, Valid: true},
+	})
+	if err != nil {
+		fmt.Printf("Error revoking session %s: %v\n", token.FamilyID, err)
+	}
+	log.Printf("Refresh token reuse for user %s, revoked session %s", token.UserID, token.FamilyID)
+
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected, please log in again"})
 }
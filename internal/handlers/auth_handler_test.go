@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+)
+
+type tokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func refresh(t *testing.T, router *gin.Engine, refreshToken string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/refresh-token", nil)
+	req.Header.Set("Authorization", refreshToken)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+// a rotated refresh token is never accepted again, not even straight away
+// from a second tab: the whole session goes
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	q := testDB(t)
+	user := createTestUser(t, q)
+
+	router := gin.New()
+	router.POST("/auth/login", func(c *gin.Context) {
+		accessToken, refreshToken, ok := startSession(c, queries.New(db.GetDB()), user.ID)
+		if ok {
+			c.JSON(http.StatusOK, gin.H{"access_token": accessToken, "refresh_token": refreshToken})
+		}
+	})
+	router.POST("/auth/refresh-token", RefreshTokenHandler)
+
+	rec := serveJSON(t, router, http.MethodPost, "/auth/login", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login answered %d: %s", rec.Code, rec.Body.String())
+	}
+	var first tokenPair
+	if err := json.Unmarshal(rec.Body.Bytes(), &first); err != nil {
+		t.Fatalf("decoding tokens: %v", err)
+	}
+
+	rec = refresh(t, router, first.RefreshToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("refresh answered %d: %s", rec.Code, rec.Body.String())
+	}
+	var second tokenPair
+	if err := json.Unmarshal(rec.Body.Bytes(), &second); err != nil {
+		t.Fatalf("decoding tokens: %v", err)
+	}
+
+	if rec := refresh(t, router, first.RefreshToken); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("reusing the rotated token answered %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := refresh(t, router, second.RefreshToken); rec.Code != http.StatusUnauthorized {
+		t.Errorf("its replacement answered %d after the reuse: %s", rec.Code, rec.Body.String())
+	}
+
+	sessions, err := q.ListUserSessions(t.Context(), user.ID)
+	if err != nil {
+		t.Fatalf("listing sessions: %v", err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("%d sessions still active after the reuse", len(sessions))
+	}
+}
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+	"github.com/rvif/nano-url/internal/metrics"
+)
+
+// query param the click ID is appended to the destination URL as, the
+// destination hands it back to the pixel or postback
+const clickIDParam = "nano_cid"
+
+const defaultConversionGoal = "default"
+
+// 1x1 transparent GIF
+var trackingPixel = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// trackClick records a click on a conversion-tracked link and returns the
+// destination with its click ID appended. The click row is buffered with the
+// click counts and written with the aggregator's next batch. If the buffer is
+// full the plain destination is returned, the visitor still gets redirected.
+func trackClick(c *gin.Context, link queries.GetURLForRedirectRow, at time.Time) (string, bool) {
+	clickID := uuid.New()
+	click := queries.CreateURLClickParams{
+		ID:        clickID,
+		UrlID:     link.ID,
+		ClickedAt: at,
+		Variant:   clickVariant(c),
+	}
+	// workspaces in no-personal-data mode keep only what attribution needs
+	if !link.NoPersonalData {
+		click.Referrer = clickReferrer(c)
+		click.Country = clientCountry(c)
+		click.Device = deviceType(c.Request.UserAgent())
+		click.Ip = anonymizedIP(c)
+	}
+
+	if !clickAggregator.RecordTracked(link.UserID, click) {
+		return link.Url, false
+	}
+
+	destination, err := url.Parse(link.Url)
+	if err != nil {
+		return link.Url, true
+	}
+	query := destination.Query()
+	query.Set(clickIDParam, clickID.String())
+	destination.RawQuery = query.Encode()
+
+	return destination.String(), true
+}
+
+// getClickForConversion looks up a click ID on the given link. A conversion
+// can come in before the click's row has been flushed, so a click still in
+// the aggregator's buffer is written first.
+func getClickForConversion(c *gin.Context, q *queries.Queries, clickID uuid.UUID, slug string) (queries.GetClickForConversionRow, error) {
+	params := queries.GetClickForConversionParams{ID: clickID, ShortUrl: slug}
+
+	click, err := q.GetClickForConversion(c, params)
+	if err != sql.ErrNoRows || clickAggregator == nil {
+		return click, err
+	}
+
+	pending, ok := clickAggregator.PendingClick(clickID)
+	if !ok {
+		return click, err
+	}
+	if err := q.CreateURLClick(c, pending); err != nil {
+		metrics.ClickWriteErrors.WithLabelValues("click_log").Inc()
+		return click, err
+	}
+
+	return q.GetClickForConversion(c, params)
+}
+
+type SetConversionTrackingRequest struct {
+	Enabled      bool `json:"enabled"`
+	RotateSecret bool `json:"rotate_secret"`
+}
+
+// SetConversionTrackingHandler turns conversion tracking on or off for a
+// link the caller can edit and returns its pixel and postback endpoints
+func SetConversionTrackingHandler(c *gin.Context) {
+	var req SetConversionTrackingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	link, ok := authorizeLink(c, q, c.Param("short_url"), workspaceEditor)
+	if !ok {
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update conversion tracking"})
+		return
+	}
+
+	tracking, err := q.SetURLConversionTracking(c, queries.SetURLConversionTrackingParams{
+		ConversionTracking: req.Enabled,
+		RotateSecret:       req.RotateSecret,
+		NewSecret:          hex.EncodeToString(secret),
+		ID:                 link.ID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update conversion tracking"})
+		return
+	}
+
+	slug := c.Param("short_url")
+	c.JSON(http.StatusOK, gin.H{
+		"short_url":       slug,
+		"enabled":         tracking.ConversionTracking,
+		"click_id_param":  clickIDParam,
+		"pixel_url":       fmt.Sprintf("/api/v1/convert/%s/pixel.gif?cid={%s}", slug, clickIDParam),
+		"postback_url":    fmt.Sprintf("/api/v1/convert/%s/postback?cid={%s}", slug, clickIDParam),
+		"postback_secret": tracking.ConversionSecret.String,
+	})
+}
+
+// ConversionPixelHandler records a conversion from a browser loading the
+// tracking pixel. It always answers with the GIF so the page never shows a
+// broken image, whether or not the click ID checked out.
+func ConversionPixelHandler(c *gin.Context) {
+	conversion, ok := parseConversion(c)
+	if ok {
+		DB := db.GetDB()
+		q := queries.New(DB)
+
+		click, err := getClickForConversion(c, q, conversion.ClickID, c.Param("slug"))
+		if err == nil && click.ConversionTracking {
+			conversion.UrlID = click.UrlID
+			conversion.Source = "pixel"
+			if _, err := q.RecordConversion(c, conversion); err != nil {
+				fmt.Printf("Error recording conversion for click %s: %v\n", click.ID, err)
+			}
+		}
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "image/gif", trackingPixel)
+}
+
+// ConversionPostbackHandler records a server-to-server conversion. Callers
+// authenticate with the link's postback secret, in the
+// X-Nano-Conversion-Secret header or ?secret=.
+func ConversionPostbackHandler(c *gin.Context) {
+	conversion, ok := parseConversion(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cid must be a click ID and value a number"})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	click, err := getClickForConversion(c, q, conversion.ClickID, c.Param("slug"))
+	if err == sql.ErrNoRows || (err == nil && !click.ConversionTracking) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Click not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	secret := c.GetHeader("X-Nano-Conversion-Secret")
+	if secret == "" {
+		secret = c.Query("secret")
+	}
+	if !click.ConversionSecret.Valid || subtle.ConstantTimeCompare([]byte(secret), []byte(click.ConversionSecret.String)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid postback secret"})
+		return
+	}
+
+	conversion.UrlID = click.UrlID
+	conversion.Source = "postback"
+	recorded, err := q.RecordConversion(c, conversion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not record conversion"})
+		return
+	}
+
+	// a repeat for the same click and goal is accepted but not counted twice
+	c.JSON(http.StatusOK, gin.H{
+		"click_id":  conversion.ClickID,
+		"goal":      conversion.Goal,
+		"duplicate": recorded == 0,
+	})
+}
+
+// parseConversion reads cid, goal and value from the query string
+func parseConversion(c *gin.Context) (queries.RecordConversionParams, bool) {
+	clickID, err := uuid.Parse(c.Query("cid"))
+	if err != nil {
+		return queries.RecordConversionParams{}, false
+	}
+
+	goal := strings.TrimSpace(c.Query("goal"))
+	if goal == "" {
+		goal = defaultConversionGoal
+	}
+	if len(goal) > 64 {
+		goal = goal[:64]
+	}
+
+	var value float64
+	if raw := c.Query("value"); raw != "" {
+		value, err = strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return queries.RecordConversionParams{}, false
+		}
+	}
+
+	return queries.RecordConversionParams{
+		ClickID: clickID,
+		Goal:    goal,
+		Value:   value,
+	}, true
+}
+
+// urlConversionStats reports tracked clicks against conversions since the
+// given time. The rate only counts clicks that carried a click ID, clicks
+// from before tracking was turned on can't convert.
+func urlConversionStats(c *gin.Context, q *queries.Queries, shortURL string, since time.Time) (gin.H, error) {
+	stats, err := q.GetURLConversionStats(c, queries.GetURLConversionStatsParams{
+		ShortUrl:  shortURL,
+		ClickedAt: since,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	byReferrer, err := q.GetURLConversionsByReferrer(c, queries.GetURLConversionsByReferrerParams{
+		ShortUrl:  shortURL,
+		ClickedAt: since,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	byVariant, err := q.GetURLConversionsByVariant(c, queries.GetURLConversionsByVariantParams{
+		ShortUrl:  shortURL,
+		ClickedAt: since,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	referrers := make([]gin.H, 0, len(byReferrer))
+	for _, r := range byReferrer {
+		referrers = append(referrers, gin.H{
+			"referrer":         r.Referrer,
+			"tracked_clicks":   r.TrackedClicks,
+			"converted_clicks": r.ConvertedClicks,
+			"conversion_rate":  conversionRate(r.ConvertedClicks, r.TrackedClicks),
+		})
+	}
+
+	variants := make([]gin.H, 0, len(byVariant))
+	for _, v := range byVariant {
+		variants = append(variants, gin.H{
+			"variant":          v.Variant,
+			"tracked_clicks":   v.TrackedClicks,
+			"converted_clicks": v.ConvertedClicks,
+			"conversion_rate":  conversionRate(v.ConvertedClicks, v.TrackedClicks),
+		})
+	}
+
+	return gin.H{
+		"tracked_clicks":   stats.TrackedClicks,
+		"converted_clicks": stats.ConvertedClicks,
+		"conversions":      stats.Conversions,
+		"value":            stats.Value,
+		"conversion_rate":  conversionRate(stats.ConvertedClicks, stats.TrackedClicks),
+		"by_referrer":      referrers,
+		"by_variant":       variants,
+	}, nil
+}
+
+func conversionRate(converted, clicks int32) float64 {
+	if clicks == 0 {
+		return 0
+	}
+	return float64(converted) / float64(clicks)
+}
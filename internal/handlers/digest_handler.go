@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+)
+
+// how many addresses other than the account's own can wait on confirmation
+const maxPendingDigests = 5
+
+type DigestSubscriptionRequest struct {
+	// defaults to the account's own address, set it to send the digest to someone else
+	Email     string `json:"email" binding:"omitempty,email"`
+	Frequency string `json:"frequency" binding:"required,oneof=daily weekly"`
+	Timezone  string `json:"timezone"`
+}
+
+func digestResponse(sub queries.DigestSubscription) gin.H {
+	return gin.H{
+		"id":           sub.ID,
+		"email":        sub.Email,
+		"frequency":    sub.Frequency,
+		"timezone":     sub.Timezone,
+		"confirmed":    sub.ConfirmedAt.Valid,
+		"last_sent_at": sub.LastSentAt,
+		"created_at":   sub.CreatedAt,
+	}
+}
+
+func ListDigestsHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	subs, err := q.ListDigestSubscriptionsByUser(c, userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not get digests"})
+		return
+	}
+
+	response := make([]gin.H, 0, len(subs))
+	for _, sub := range subs {
+		response = append(response, digestResponse(sub))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// SubscribeDigestHandler creates a digest subscription, or updates the
+// frequency/timezone if the address is already subscribed. Only the
+// account's verified address is subscribed straight away; any other address
+// gets a confirmation link and receives nothing until it's followed.
+func SubscribeDigestHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req DigestSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(req.Timezone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	user, err := q.GetUserById(c, userUUID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Could not find user"})
+		return
+	}
+	if req.Email == "" {
+		req.Email = user.Email
+	}
+	confirmed := strings.EqualFold(req.Email, user.Email) && user.EmailVerifiedAt.Valid
+
+	if !confirmed {
+		pending, err := q.CountPendingDigestSubscriptions(c, queries.CountPendingDigestSubscriptionsParams{
+			UserID: userUUID,
+			Email:  req.Email,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save digest"})
+			return
+		}
+		if pending >= maxPendingDigests {
+			c.JSON(http.StatusConflict, gin.H{"error": "Too many digest addresses are waiting on confirmation"})
+			return
+		}
+	}
+
+	sub, err := q.UpsertDigestSubscription(c, queries.UpsertDigestSubscriptionParams{
+		UserID:           userUUID,
+		Email:            req.Email,
+		Frequency:        req.Frequency,
+		Timezone:         req.Timezone,
+		UnsubscribeToken: uuid.New().String(),
+		Confirmed:        confirmed,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save digest"})
+		return
+	}
+
+	if !sub.ConfirmedAt.Valid {
+		if err := sendDigestConfirmation(c, q, sub, user.Username); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not send confirmation email"})
+			return
+		}
+		c.JSON(http.StatusAccepted, digestResponse(sub))
+		return
+	}
+
+	c.JSON(http.StatusOK, digestResponse(sub))
+}
+
+// sendDigestConfirmation mails the address a link to opt in, at most once an
+// hour so the endpoint can't be used to flood someone's inbox
+func sendDigestConfirmation(c *gin.Context, q *queries.Queries, sub queries.DigestSubscription, username string) error {
+	token, err := randomHex(32)
+	if err != nil {
+		return err
+	}
+
+	claimed, err := q.ClaimDigestConfirmation(c, queries.ClaimDigestConfirmationParams{
+		ID:                    sub.ID,
+		ConfirmationTokenHash: sql.NullString{String: hashToken(token), Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+	if claimed == 0 {
+		return nil
+	}
+
+	apiURL := os.Getenv("API_URL")
+	if apiURL == "" {
+		apiURL = "http://localhost:8080/api/v1"
+	}
+
+	link := fmt.Sprintf("%s/digests/confirm?token=%s", apiURL, url.QueryEscape(token))
+	emailBody := fmt.Sprintf("%s wants to send a %s nano analytics digest to this address. To start receiving it, follow this link: %s<br><br>The link works for 7 days. If you don't want these emails, ignore this one and you won't hear from us again.",
+		username, sub.Frequency, link)
+
+	go func(email string) {
+		if err := mailClient.SendEmail(email, "Confirm your nano digest", emailBody); err != nil {
+			fmt.Printf("Error sending digest confirmation: %v\n", err)
+		}
+	}(sub.Email)
+
+	return nil
+}
+
+func DeleteDigestHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	digestID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid digest ID"})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	deleted, err := q.DeleteDigestSubscription(c, queries.DeleteDigestSubscriptionParams{
+		ID:     digestID,
+		UserID: userUUID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete digest"})
+		return
+	}
+	if deleted == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Digest not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Digest deleted"})
+}
+
+// UnsubscribeDigestHandler is the unauthenticated link at the bottom of every digest
+func UnsubscribeDigestHandler(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing unsubscribe token"})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	removed, err := q.UnsubscribeDigest(c, token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not unsubscribe"})
+		return
+	}
+	if removed == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invalid or already used unsubscribe link"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "You have been unsubscribed from this digest"})
+}
+
+// ConfirmDigestHandler is the unauthenticated link in the confirmation email
+func ConfirmDigestHandler(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing confirmation token"})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	sub, err := q.ConfirmDigestSubscription(c, sql.NullString{String: hashToken(token), Valid: true})
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invalid, expired or already used confirmation link"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not confirm digest"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("%s will now receive the %s digest", sub.Email, sub.Frequency)})
+}
@@ -44,16 +44,20 @@ func HealthCheckHandler(c *gin.Context) {
 	}
 
 	// auth configuration
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" || jwtSecret == "ur-kept-secret" {
+	if tokenService == nil {
+		healthStatus["auth"] = ServiceStatus{
+			Status:  "unhealthy",
+			Message: "Token service not configured",
+		}
+	} else if tokenService.WeakSecret() {
 		healthStatus["auth"] = ServiceStatus{
 			Status:  "warning",
-			Message: "JWT_SECRET using default value or not set",
+			Message: "JWT_SECRET is a placeholder or shorter than 32 bytes",
 		}
 	} else {
 		healthStatus["auth"] = ServiceStatus{
 			Status:  "healthy",
-			Message: "Authentication configured",
+			Message: "Authentication configured (" + tokenService.Algorithm() + ")",
 		}
 	}
 
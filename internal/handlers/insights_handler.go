@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+	"github.com/rvif/nano-url/internal/services"
+)
+
+// most links a comparison can hold
+const maxCompareLinks = 10
+
+var heatmapWeekdays = []string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+
+// HeatmapHandler returns a 7x24 hour-of-week click matrix (Monday first) for
+// a link (?short_url=) or all links in the caller's workspaces, in the
+// viewer's ?tz= over the last ?days= days. Buckets are UTC hours, so zones
+// with a half-hour offset land each hour in the local hour it starts in.
+func HeatmapHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	loc, err := viewerLocation(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
+		return
+	}
+
+	days, ok := historyDays(c)
+	if !ok {
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	var urlID uuid.NullUUID
+	if shortURL := c.Query("short_url"); shortURL != "" {
+		link, ok := authorizeLink(c, q, shortURL, workspaceViewer)
+		if !ok {
+			return
+		}
+		urlID = uuid.NullUUID{UUID: link.ID, Valid: true}
+	}
+
+	cells, err := q.GetHourOfWeekClicks(c, queries.GetHourOfWeekClicksParams{
+		Tz:     loc.String(),
+		UserID: userUUID,
+		UrlID:  urlID,
+		Since:  time.Now().UTC().Truncate(time.Hour).Add(-time.Duration(days) * 24 * time.Hour),
+	})
+	// Go and Postgres ship their own zone databases, a name only Go knows
+	// is still the caller's mistake
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "22023" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not get heatmap"})
+		return
+	}
+
+	matrix := make([][]int32, 7)
+	for i := range matrix {
+		matrix[i] = make([]int32, 24)
+	}
+
+	var total int32
+	var peak gin.H
+	var peakClicks int32
+	for _, cell := range cells {
+		// ISO weekday: 1 = Monday ... 7 = Sunday
+		day, hour := int(cell.Weekday)-1, int(cell.HourOfDay)
+		if day < 0 || day > 6 || hour < 0 || hour > 23 {
+			continue
+		}
+		matrix[day][hour] += cell.Clicks
+		total += cell.Clicks
+	}
+	for day, hours := range matrix {
+		for hour, clicks := range hours {
+			if clicks > peakClicks {
+				peakClicks = clicks
+				peak = gin.H{"weekday": heatmapWeekdays[day], "hour": hour, "clicks": clicks}
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"timezone": loc.String(),
+		"days":     days,
+		"weekdays": heatmapWeekdays,
+		"matrix":   matrix,
+		"total":    total,
+		"peak":     peak,
+	})
+}
+
+// CompareLinksHandler lines up to 10 links from the caller's workspaces (?short_urls=a,b,c)
+// over the same last ?days= days (default 7). Averages divide by the days of
+// that range each link has existed, so one created midway isn't dragged down
+// by the days before it.
+func CompareLinksHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var shortURLs []string
+	seen := make(map[string]bool)
+	for _, shortURL := range strings.Split(c.Query("short_urls"), ",") {
+		shortURL = strings.TrimSpace(shortURL)
+		if shortURL != "" && !seen[shortURL] {
+			seen[shortURL] = true
+			shortURLs = append(shortURLs, shortURL)
+		}
+	}
+	if len(shortURLs) == 0 || len(shortURLs) > maxCompareLinks {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "short_urls must list between 1 and 10 links"})
+		return
+	}
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if err != nil || days < 1 || days > 365 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 365"})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	links, err := q.GetURLsForComparison(c, queries.GetURLsForComparisonParams{
+		UserID:    userUUID,
+		ShortUrls: shortURLs,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not compare links"})
+		return
+	}
+	// links outside the caller's workspaces are treated as missing
+	if len(links) != len(shortURLs) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+		return
+	}
+
+	urlIDs := make([]uuid.UUID, 0, len(links))
+	for _, link := range links {
+		urlIDs = append(urlIDs, link.ID)
+	}
+
+	today := services.UTCDay(time.Now())
+	since := today.AddDate(0, 0, -(days - 1))
+	buckets, err := q.GetDailyClicksForURLs(c, queries.GetDailyClicksForURLsParams{
+		UrlIds: urlIDs,
+		Since:  since,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not compare links"})
+		return
+	}
+
+	byLink := make(map[uuid.UUID][]queries.UrlDailyClick)
+	for _, b := range buckets {
+		byLink[b.UrlID] = append(byLink[b.UrlID], b)
+	}
+
+	response := make([]gin.H, 0, len(links))
+	for _, link := range links {
+		age := int(today.Sub(services.UTCDay(link.CreatedAt.Time)).Hours()/24) + 1
+
+		// only days of the range the link has lived through count towards its average
+		observed := min(age, days)
+		series := make([]int32, days)
+		var windowClicks int32
+		for _, b := range byLink[link.ID] {
+			offset := int(b.Day.Sub(since).Hours() / 24)
+			if offset >= 0 && offset < days {
+				series[offset] += b.Clicks
+				windowClicks += b.Clicks
+			}
+		}
+
+		response = append(response, gin.H{
+			"short_url":           link.ShortUrl,
+			"url":                 link.Url,
+			"created_at":          link.CreatedAt,
+			"days_since_creation": age,
+			"days_observed":       observed,
+			"series":              series,
+			"window_clicks":       windowClicks,
+			"window_daily_avg":    float64(windowClicks) / float64(observed),
+			"total_clicks":        link.TotalClicks.Int32,
+			"lifetime_daily_avg":  float64(link.TotalClicks.Int32) / float64(age),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"days":  days,
+		"since": since.Format("2006-01-02"),
+		"links": response,
+	})
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/internal/db/queries"
+)
+
+// Every handler that acts on a single link goes through authorizeLink or
+// authorizeLinkByID. The caller is always the user_id AuthMiddleware put on
+// the context, never an ID from the request, and the link is named by the
+// route's path.
+
+// authorizeLink loads the link with this slug and the caller's role in the
+// workspace that owns it. It writes the response itself when they can't
+// have it.
+func authorizeLink(c *gin.Context, q *queries.Queries, shortURL string, min string) (queries.GetLinkAccessRow, bool) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return queries.GetLinkAccessRow{}, false
+	}
+
+	link, err := q.GetLinkAccess(c, queries.GetLinkAccessParams{
+		ShortUrl: shortURL,
+		UserID:   userUUID,
+	})
+	return checkLinkAccess(c, link, err, min)
+}
+
+// authorizeLinkByID is authorizeLink for routes that name the link by its ID
+func authorizeLinkByID(c *gin.Context, q *queries.Queries, urlID uuid.UUID, min string) (queries.GetLinkAccessRow, bool) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return queries.GetLinkAccessRow{}, false
+	}
+
+	link, err := q.GetLinkAccessByID(c, queries.GetLinkAccessByIDParams{
+		ID:     urlID,
+		UserID: userUUID,
+	})
+	return checkLinkAccess(c, queries.GetLinkAccessRow(link), err, min)
+}
+
+// checkLinkAccess lets a link lookup through if the caller's role is at
+// least min. Links in workspaces they aren't in are a 404, the same as links
+// that don't exist, so other people's slugs can't be probed; a member whose
+// role is too low gets a 403.
+func checkLinkAccess(c *gin.Context, link queries.GetLinkAccessRow, err error, min string) (queries.GetLinkAccessRow, bool) {
+	if err == sql.ErrNoRows || (err == nil && link.Role == "") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+		return queries.GetLinkAccessRow{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return queries.GetLinkAccessRow{}, false
+	}
+
+	if !workspaceRoleAtLeast(link.Role, min) {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("You need to be a workspace %s or above to do this", min)})
+		return queries.GetLinkAccessRow{}, false
+	}
+
+	return link, true
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/internal/db/queries"
+)
+
+// newLinkRouter serves the /url routes as userID, the way AuthMiddleware
+// would after checking their token
+func newLinkRouter(userID uuid.UUID) *gin.Engine {
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Next()
+	})
+
+	url := router.Group("/url")
+	url.POST("/shorten", CreateURLHandler)
+	url.POST("/get-urls", GetURLSByUserIDHandler)
+	url.POST("/update/:url_id", UpdateShortURLHandler)
+	url.POST("/delete/:short_url", DeleteURLHandler)
+	url.POST("/analytics/:short_url", GetURLAnalyticsHandler)
+	url.GET("/:slug/live", LiveURLClicksHandler)
+	url.POST("/share/:short_url", ShareURLStatsHandler)
+	url.POST("/conversions/:short_url", SetConversionTrackingHandler)
+	return router
+}
+
+func serveJSON(t *testing.T, router *gin.Engine, method, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatalf("encoding body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+type createdLink struct {
+	ID       uuid.UUID `json:"id"`
+	UserID   uuid.UUID `json:"user_id"`
+	ShortURL string    `json:"short_url"`
+}
+
+func shorten(t *testing.T, router *gin.Engine, body gin.H) createdLink {
+	t.Helper()
+
+	rec := serveJSON(t, router, http.MethodPost, "/url/shorten", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("shorten answered %d: %s", rec.Code, rec.Body.String())
+	}
+	var link createdLink
+	if err := json.Unmarshal(rec.Body.Bytes(), &link); err != nil {
+		t.Fatalf("decoding link: %v", err)
+	}
+	return link
+}
+
+// Someone else's link answers exactly like a slug that doesn't exist, even
+// when the request body names its owner
+func TestOtherUsersLinksAreNotFound(t *testing.T) {
+	q := testDB(t)
+	alice := createTestUser(t, q)
+	bob := createTestUser(t, q)
+
+	link := shorten(t, newLinkRouter(alice.ID), gin.H{"url": "https://example.com/alice"})
+	missing := "missing-" + uuid.NewString()[:8]
+	asBob := newLinkRouter(bob.ID)
+	claimAlice := gin.H{"user_id": alice.ID}
+
+	tests := []struct {
+		name          string
+		method        string
+		path, missing string
+		body          gin.H
+	}{
+		{"update", http.MethodPost, "/url/update/" + link.ID.String(), "/url/update/" + uuid.NewString(),
+			gin.H{"user_id": alice.ID, "new_url": "https://example.com/bob"}},
+		{"delete", http.MethodPost, "/url/delete/" + link.ShortURL, "/url/delete/" + missing, claimAlice},
+		{"analytics", http.MethodPost, "/url/analytics/" + link.ShortURL, "/url/analytics/" + missing, claimAlice},
+		{"share", http.MethodPost, "/url/share/" + link.ShortURL, "/url/share/" + missing,
+			gin.H{"user_id": alice.ID, "public": true, "expires_in_hours": 24}},
+		{"conversions", http.MethodPost, "/url/conversions/" + link.ShortURL, "/url/conversions/" + missing,
+			gin.H{"user_id": alice.ID, "enabled": true}},
+		{"live", http.MethodGet, "/url/" + link.ShortURL + "/live", "/url/" + missing + "/live", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveJSON(t, asBob, tt.method, tt.path, tt.body)
+			if rec.Code != http.StatusNotFound {
+				t.Fatalf("answered %d: %s", rec.Code, rec.Body.String())
+			}
+
+			unknown := serveJSON(t, asBob, tt.method, tt.missing, tt.body)
+			if unknown.Code != http.StatusNotFound || unknown.Body.String() != rec.Body.String() {
+				t.Errorf("other user's link answered %q, missing one %d %q", rec.Body.String(), unknown.Code, unknown.Body.String())
+			}
+		})
+	}
+
+	// and nothing about the link changed
+	stats, err := q.GetURLStatsByShortURL(t.Context(), link.ShortURL)
+	if err != nil {
+		t.Fatalf("loading link: %v", err)
+	}
+	if stats.UserID != alice.ID || stats.Url != "https://example.com/alice" || stats.StatsPublic {
+		t.Errorf("link changed: %+v", stats)
+	}
+	redirect, err := q.GetURLForRedirect(t.Context(), link.ShortURL)
+	if err != nil {
+		t.Fatalf("loading link: %v", err)
+	}
+	if redirect.ConversionTracking {
+		t.Error("conversion tracking was turned on")
+	}
+}
+
+func TestBodyUserIDIsIgnored(t *testing.T) {
+	q := testDB(t)
+	alice := createTestUser(t, q)
+	bob := createTestUser(t, q)
+	asBob := newLinkRouter(bob.ID)
+
+	shorten(t, newLinkRouter(alice.ID), gin.H{"url": "https://example.com/alice"})
+
+	t.Run("shorten", func(t *testing.T) {
+		link := shorten(t, asBob, gin.H{"user_id": alice.ID, "url": "https://example.com/bob"})
+		if link.UserID != bob.ID {
+			t.Errorf("link created for %s, want the caller %s", link.UserID, bob.ID)
+		}
+
+		access, err := q.GetLinkAccess(t.Context(), queries.GetLinkAccessParams{
+			ShortUrl: link.ShortURL,
+			UserID:   alice.ID,
+		})
+		if err != nil {
+			t.Fatalf("loading link: %v", err)
+		}
+		if access.Role != "" {
+			t.Error("link landed in a workspace of the user named in the body")
+		}
+	})
+
+	t.Run("get-urls", func(t *testing.T) {
+		rec := serveJSON(t, asBob, http.MethodPost, "/url/get-urls", gin.H{"user_id": alice.ID})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("answered %d: %s", rec.Code, rec.Body.String())
+		}
+		var links []createdLink
+		if err := json.Unmarshal(rec.Body.Bytes(), &links); err != nil {
+			t.Fatalf("decoding links: %v", err)
+		}
+		for _, link := range links {
+			if link.UserID == alice.ID {
+				t.Errorf("listed %s, a link of the user named in the body", link.ShortURL)
+			}
+		}
+	})
+}
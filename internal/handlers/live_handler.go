@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+)
+
+// keeps proxies from closing idle streams
+const liveHeartbeatInterval = 15 * time.Second
+
+// the caller can no longer see what the stream is about
+var errLiveAccessLost = errors.New("live stream access lost")
+
+// LiveURLClicksHandler streams click events for a link in one of the
+// caller's workspaces over SSE
+func LiveURLClicksHandler(c *gin.Context) {
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	link, ok := authorizeLink(c, q, c.Param("slug"), workspaceViewer)
+	if !ok {
+		return
+	}
+	userUUID, _ := currentUserID(c)
+
+	// the link may move to another workspace or the caller may leave this one
+	scope := func() ([]uuid.UUID, error) {
+		access, err := q.GetLinkAccessByID(c, queries.GetLinkAccessByIDParams{
+			ID:     link.ID,
+			UserID: userUUID,
+		})
+		if err == sql.ErrNoRows || (err == nil && access.Role == "") {
+			return nil, errLiveAccessLost
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []uuid.UUID{access.WorkspaceID}, nil
+	}
+
+	streamClicks(c, []uuid.UUID{link.WorkspaceID}, scope, uuid.NullUUID{UUID: link.ID, Valid: true})
+}
+
+// LiveAccountClicksHandler streams click events for the links in all of the
+// caller's workspaces over SSE
+func LiveAccountClicksHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	scope := func() ([]uuid.UUID, error) {
+		return q.ListMemberWorkspaceIDs(c, userUUID)
+	}
+	workspaceIDs, err := scope()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	streamClicks(c, workspaceIDs, scope, uuid.NullUUID{})
+}
+
+// streamClicks sends the clicks in workspaceIDs until the client goes away.
+// scope is asked again on every heartbeat, so joining or leaving a workspace
+// takes effect within one interval; errLiveAccessLost from it ends the stream.
+func streamClicks(c *gin.Context, workspaceIDs []uuid.UUID, scope func() ([]uuid.UUID, error), urlID uuid.NullUUID) {
+	if clickHub == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Live stream unavailable"})
+		return
+	}
+
+	sub := clickHub.Subscribe(workspaceIDs, urlID)
+	defer clickHub.Unsubscribe(sub)
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(liveHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	var reportedDrops uint64
+
+	c.SSEvent("ready", gin.H{"connected_at": time.Now()})
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event, open := <-sub.C:
+			if !open {
+				return false
+			}
+			c.SSEvent("click", event)
+
+			// tell the client it fell behind instead of silently skipping events
+			if dropped := sub.Dropped(); dropped > reportedDrops {
+				c.SSEvent("dropped", gin.H{"count": dropped - reportedDrops})
+				reportedDrops = dropped
+			}
+			return true
+		case <-heartbeat.C:
+			workspaceIDs, err := scope()
+			if err == errLiveAccessLost {
+				return false
+			}
+			if err != nil {
+				fmt.Printf("Error refreshing live stream access: %v\n", err)
+			} else {
+				clickHub.Rescope(sub, workspaceIDs)
+			}
+			c.SSEvent("ping", gin.H{"time": time.Now()})
+			return true
+		}
+	})
+}
+
+// currentUserID reads the user_id AuthMiddleware put on the context and
+// writes the 401 itself when it's missing
+func currentUserID(c *gin.Context) (uuid.UUID, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return uuid.Nil, false
+	}
+
+	userUUID, ok := userID.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user-ID format"})
+		return uuid.Nil, false
+	}
+
+	return userUUID, true
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+)
+
+const (
+	// how long an emailed sign-in link works for
+	magicLinkTTL = 15 * time.Minute
+	// ties a sign-in link to the browser that asked for it
+	magicLinkNonceCookie = "nano_magic_link_nonce"
+)
+
+// setMagicLinkNonceCookie sets (or with a negative maxAge, clears) the nonce
+// cookie. In production the dashboard calls the API cross-site, and only
+// SameSite=None cookies, which have to be Secure, come along on those calls.
+func setMagicLinkNonceCookie(c *gin.Context, nonce string, maxAge int) {
+	production := os.Getenv("ENV") == "production"
+	if production {
+		c.SetSameSite(http.SameSiteNoneMode)
+	} else {
+		c.SetSameSite(http.SameSiteLaxMode)
+	}
+	c.SetCookie(magicLinkNonceCookie, nonce, maxAge, "/", "", production, true)
+}
+
+type RequestMagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// RequestMagicLinkHandler emails a single-use sign-in link. Like
+// forgot-password, the response doesn't say whether the email has an account.
+func RequestMagicLinkHandler(c *gin.Context) {
+	var req RequestMagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	if !allowAttempt(c, q, magicLinkRequestIPThrottle, c.ClientIP()) {
+		return
+	}
+	recordFailure(c, q, magicLinkRequestIPThrottle, c.ClientIP(), uuid.NullUUID{})
+
+	const sentMessage = "If an account exists for this email, a sign-in link has been sent"
+
+	// set whether or not a link goes out, so the response is the same. A
+	// browser keeps its nonce across requests, so asking twice doesn't void
+	// the first link.
+	nonce, _ := c.Cookie(magicLinkNonceCookie)
+	if len(nonce) != 64 {
+		var err error
+		nonce, err = randomHex(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+	}
+	setMagicLinkNonceCookie(c, nonce, int(magicLinkTTL.Seconds()))
+
+	emailKey := throttleEmailKey(req.Email)
+	_, err := q.GetAuthThrottleBlock(c, queries.GetAuthThrottleBlockParams{
+		Scope: magicLinkRequestAccountThrottle.scope,
+		Key:   emailKey,
+	})
+	if err == nil {
+		c.JSON(http.StatusOK, gin.H{"message": sentMessage})
+		return
+	}
+
+	user, err := q.GetUserByEmail(c, req.Email)
+	if err != nil {
+		recordFailure(c, q, magicLinkRequestAccountThrottle, emailKey, uuid.NullUUID{})
+		c.JSON(http.StatusOK, gin.H{"message": sentMessage})
+		return
+	}
+	recordFailure(c, q, magicLinkRequestAccountThrottle, emailKey, uuid.NullUUID{UUID: user.ID, Valid: true})
+
+	if err := q.DeleteExpiredMagicLinks(c); err != nil {
+		fmt.Printf("Error deleting expired sign-in links: %v\n", err)
+	}
+
+	token, err := randomHex(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	err = q.CreateMagicLink(c, queries.CreateMagicLinkParams{
+		TokenHash: hashToken(token),
+		UserID:    user.ID,
+		Email:     user.Email,
+		NonceHash: hashToken(nonce),
+		ExpiresAt: time.Now().Add(magicLinkTTL),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failure in storing sign-in link"})
+		return
+	}
+
+	frontendURL := os.Getenv("FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = "https://rvif.me"
+	}
+
+	loginURL := fmt.Sprintf("%s/auth/magic-link?token=%s", frontendURL, token)
+	emailBody := fmt.Sprintf("Click here to sign in to nano: %s<br><br>The link works once, for %d minutes, and only in the browser you asked for it from. If you didn't ask for it, you can ignore this email.",
+		loginURL, int(magicLinkTTL.Minutes()))
+
+	// sent in the background so the response takes as long as for an
+	// unknown email
+	go func(email string) {
+		if err := mailClient.SendEmail(email, "Your sign-in link", emailBody); err != nil {
+			fmt.Printf("Error sending sign-in link: %v\n", err)
+		}
+	}(user.Email)
+
+	c.JSON(http.StatusOK, gin.H{"message": sentMessage})
+}
+
+type VerifyMagicLinkRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// VerifyMagicLinkHandler exchanges a sign-in link's token for the usual
+// access and refresh tokens, or a 2FA challenge if the account has 2FA on
+func VerifyMagicLinkHandler(c *gin.Context) {
+	var req VerifyMagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	if !allowAttempt(c, q, magicLinkTokenIPThrottle, c.ClientIP()) {
+		return
+	}
+
+	nonce, _ := c.Cookie(magicLinkNonceCookie)
+	if nonce == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Open the sign-in link in the browser you requested it from"})
+		return
+	}
+
+	link, ok := consumeMagicLink(c, req.Token, nonce)
+	if !ok {
+		return
+	}
+	setMagicLinkNonceCookie(c, "", -1)
+
+	// the link stands in for the password, not for the second factor
+	twoFactor, err := q.GetUserTOTP(c, link.UserID)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if err == nil && twoFactor.ConfirmedAt.Valid {
+		startLoginChallenge(c, q, link.UserID)
+		return
+	}
+
+	accessTokenStr, refreshToken, ok := startSession(c, q, link.UserID)
+	if !ok {
+		return
+	}
+	clearFailures(c, q, loginAccountThrottle, throttleEmailKey(link.Email))
+
+	c.JSON(http.StatusOK, gin.H{"access_token": accessTokenStr, "refresh_token": refreshToken})
+}
+
+// consumeMagicLink uses up the link and verifies the address it was sent
+// to. On failure it writes the error response.
+func consumeMagicLink(c *gin.Context, token, nonce string) (queries.ConsumeMagicLinkRow, bool) {
+	DB := db.GetDB()
+	tx, err := DB.BeginTx(c, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return queries.ConsumeMagicLinkRow{}, false
+	}
+	defer tx.Rollback()
+
+	q := queries.New(DB).WithTx(tx)
+
+	link, err := q.ConsumeMagicLink(c, queries.ConsumeMagicLinkParams{
+		TokenHash: hashToken(token),
+		NonceHash: hashToken(nonce),
+	})
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		recordFailure(c, queries.New(DB), magicLinkTokenIPThrottle, c.ClientIP(), uuid.NullUUID{})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invalid or expired sign-in link, or it was requested from another browser"})
+		return queries.ConsumeMagicLinkRow{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return queries.ConsumeMagicLinkRow{}, false
+	}
+
+	// following the link proves the address. If it wasn't verified yet the
+	// account may have been registered by someone else to squat it, so
+	// whoever set the password loses it along with their sessions, as with
+	// single sign-on.
+	verified, err := q.VerifyUserEmail(c, queries.VerifyUserEmailParams{ID: link.UserID, Email: link.Email})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return queries.ConsumeMagicLinkRow{}, false
+	}
+	if verified > 0 {
+		err := q.UpdateUserPassword(c, queries.UpdateUserPasswordParams{
+			HashedPassword: noPassword,
+			ID:             link.UserID,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return queries.ConsumeMagicLinkRow{}, false
+		}
+		if _, err := q.RevokeSessions(c, queries.RevokeSessionsParams{UserID: link.UserID}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return queries.ConsumeMagicLinkRow{}, false
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return queries.ConsumeMagicLinkRow{}, false
+	}
+
+	return link, true
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"database/sql"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pressly/goose/v3"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+	"github.com/rvif/nano-url/internal/tokens"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+
+	service, err := tokens.NewService(tokens.Config{
+		Issuer:   "nano-url",
+		Audience: "nano-url",
+		Secret:   "handler-tests-secret-handler-tests-secret",
+	})
+	if err != nil {
+		panic(err)
+	}
+	InitTokenService(service)
+
+	os.Exit(m.Run())
+}
+
+var (
+	testDBOnce sync.Once
+	testDBConn *sql.DB
+	testDBErr  error
+)
+
+// testDB points the handlers at TEST_DATABASE_URL, a scratch database the
+// migrations are applied to. Tests that need one are skipped without it;
+// each test makes its own users, so they can share the database.
+func testDB(t *testing.T) *queries.Queries {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	testDBOnce.Do(func() {
+		testDBConn, testDBErr = sql.Open("postgres", dsn)
+		if testDBErr != nil {
+			return
+		}
+		if testDBErr = goose.SetDialect("postgres"); testDBErr != nil {
+			return
+		}
+		testDBErr = goose.Up(testDBConn, "../../db/migrations")
+	})
+	if testDBErr != nil {
+		t.Fatalf("setting up test database: %v", testDBErr)
+	}
+
+	db.DB = testDBConn
+	return queries.New(testDBConn)
+}
+
+// createTestUser signs up a verified user with a unique name and email
+func createTestUser(t *testing.T, q *queries.Queries) queries.User {
+	t.Helper()
+	ctx := t.Context()
+
+	id := uuid.New()
+	suffix := id.String()[:8]
+	_, err := q.CreateUser(ctx, queries.CreateUserParams{
+		ID:             id,
+		Username:       "test_" + suffix,
+		Email:          "test-" + suffix + "@example.com",
+		HashedPassword: "not-a-real-hash",
+		PfpUrl:         defaultPfpURL,
+	})
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	if _, err := q.CreateAnalytics(ctx, queries.CreateAnalyticsParams{ID: uuid.New(), UserID: id}); err != nil {
+		t.Fatalf("creating analytics: %v", err)
+	}
+	if _, err := q.VerifyUserEmail(ctx, queries.VerifyUserEmailParams{ID: id, Email: "test-" + suffix + "@example.com"}); err != nil {
+		t.Fatalf("verifying email: %v", err)
+	}
+
+	user, err := q.GetUserById(ctx, id)
+	if err != nil {
+		t.Fatalf("loading user: %v", err)
+	}
+	return user
+}
@@ -0,0 +1,392 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	mathrand "math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+	"github.com/rvif/nano-url/internal/sso"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// how long a sign-in may take at the provider
+	oidcLoginTTL = 10 * time.Minute
+	// ties the callback to the browser that started the sign-in
+	oidcStateCookie = "nano_oidc_state"
+)
+
+var ssoProviders *sso.Registry
+
+func InitSSOProviders(registry *sso.Registry) {
+	ssoProviders = registry
+}
+
+// accounts created through a provider have no password until one is set
+// with forgot-password; an empty hash never matches
+const noPassword = ""
+
+var errOIDCEmailNotVerified = errors.New("provider did not report a verified email")
+
+// oidcRedirect sends the browser back to the dashboard. Results ride in the
+// fragment so tokens never reach server logs or Referer headers.
+func oidcRedirect(c *gin.Context, path string, values url.Values) {
+	frontendURL := os.Getenv("FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = "https://rvif.me"
+	}
+	c.Redirect(http.StatusFound, fmt.Sprintf("%s%s#%s", frontendURL, path, values.Encode()))
+}
+
+func oidcLoginError(c *gin.Context, message string) {
+	oidcRedirect(c, "/auth/login", url.Values{"error": {message}})
+}
+
+func randomHex(n int) (string, error) {
+	raw := make([]byte, n)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// ListSSOProvidersHandler lists the providers the login page offers
+func ListSSOProvidersHandler(c *gin.Context) {
+	providers := []gin.H{}
+	for _, p := range ssoProviders.List() {
+		providers = append(providers, gin.H{
+			"name":         p.Name(),
+			"display_name": p.DisplayName(),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"providers": providers})
+}
+
+// OIDCLoginHandler starts a sign-in: the browser is sent to the provider
+// with a fresh state, nonce and PKCE challenge
+func OIDCLoginHandler(c *gin.Context) {
+	provider, ok := ssoProviders.Get(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown sign-in provider"})
+		return
+	}
+
+	state, err := randomHex(32)
+	if err != nil {
+		oidcLoginError(c, "Could not start sign-in, please try again")
+		return
+	}
+	nonce, err := randomHex(32)
+	if err != nil {
+		oidcLoginError(c, "Could not start sign-in, please try again")
+		return
+	}
+	codeVerifier := oauth2.GenerateVerifier()
+
+	authURL, err := provider.AuthCodeURL(state, nonce, codeVerifier)
+	if err != nil {
+		fmt.Printf("Error reaching sign-in provider %s: %v\n", provider.Name(), err)
+		oidcLoginError(c, fmt.Sprintf("%s is unavailable, please try again later", provider.DisplayName()))
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	if err := q.DeleteExpiredOIDCLoginStates(c); err != nil {
+		fmt.Printf("Error deleting expired sign-in states: %v\n", err)
+	}
+
+	err = q.CreateOIDCLoginState(c, queries.CreateOIDCLoginStateParams{
+		StateHash:    hashToken(state),
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().Add(oidcLoginTTL),
+	})
+	if err != nil {
+		oidcLoginError(c, "Could not start sign-in, please try again")
+		return
+	}
+
+	// Lax so the cookie comes back on the provider's top-level redirect
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, int(oidcLoginTTL.Seconds()), "/", "", os.Getenv("ENV") == "production", true)
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallbackHandler is where the provider sends the browser back. The code
+// is exchanged for a verified ID token, the identity is matched to an account
+// and the browser is handed tokens (or a 2FA challenge) on the dashboard.
+func OIDCCallbackHandler(c *gin.Context) {
+	provider, ok := ssoProviders.Get(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown sign-in provider"})
+		return
+	}
+
+	cookieState, _ := c.Cookie(oidcStateCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, "", -1, "/", "", os.Getenv("ENV") == "production", true)
+
+	if c.Query("error") != "" {
+		oidcLoginError(c, fmt.Sprintf("Sign-in with %s was cancelled", provider.DisplayName()))
+		return
+	}
+
+	state := c.Query("state")
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookieState)) != 1 {
+		oidcLoginError(c, "Sign-in expired, please try again")
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	loginState, err := q.ConsumeOIDCLoginState(c, hashToken(state))
+	if err == sql.ErrNoRows || (err == nil && loginState.Provider != provider.Name()) {
+		oidcLoginError(c, "Sign-in expired, please try again")
+		return
+	}
+	if err != nil {
+		oidcLoginError(c, "Could not sign in, please try again")
+		return
+	}
+
+	identity, err := provider.Exchange(c, c.Query("code"), loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		fmt.Printf("Error completing sign-in with %s: %v\n", provider.Name(), err)
+		oidcLoginError(c, fmt.Sprintf("Could not sign in with %s", provider.DisplayName()))
+		return
+	}
+
+	userID, err := resolveOIDCUser(c, provider, identity)
+	if err == errOIDCEmailNotVerified {
+		oidcLoginError(c, fmt.Sprintf("Your %s account needs a verified email address", provider.DisplayName()))
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error signing in %s user %s: %v\n", provider.Name(), identity.Subject, err)
+		oidcLoginError(c, "Could not sign in, please try again")
+		return
+	}
+
+	// the provider stands in for the password, not for our second factor
+	twoFactor, err := q.GetUserTOTP(c, userID)
+	if err != nil && err != sql.ErrNoRows {
+		oidcLoginError(c, "Could not sign in, please try again")
+		return
+	}
+	if err == nil && twoFactor.ConfirmedAt.Valid {
+		challengeToken, err := createLoginChallenge(c, q, userID)
+		if err != nil {
+			oidcLoginError(c, "Could not sign in, please try again")
+			return
+		}
+		oidcRedirect(c, "/auth/login", url.Values{"challenge_token": {challengeToken}})
+		return
+	}
+
+	accessTokenStr, refreshToken, ok := startSession(c, q, userID)
+	if !ok {
+		return
+	}
+
+	oidcRedirect(c, "/auth/oidc/callback", url.Values{
+		"access_token":  {accessTokenStr},
+		"refresh_token": {refreshToken},
+	})
+}
+
+// resolveOIDCUser finds the account for an external identity: the one it's
+// linked to, else the account with the same (provider-verified) email, else a
+// new account. Linking only ever happens on an email the provider verified.
+func resolveOIDCUser(c *gin.Context, provider *sso.Provider, identity *sso.Identity) (uuid.UUID, error) {
+	DB := db.GetDB()
+	tx, err := DB.BeginTx(c, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+
+	q := queries.New(DB).WithTx(tx)
+
+	userID, err := q.LoginUserIdentity(c, queries.LoginUserIdentityParams{
+		Issuer:  provider.Issuer(),
+		Subject: identity.Subject,
+		Email:   identity.Email,
+	})
+	if err == nil {
+		return userID, tx.Commit()
+	}
+	if err != sql.ErrNoRows {
+		return uuid.Nil, err
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return uuid.Nil, errOIDCEmailNotVerified
+	}
+
+	user, err := q.GetUserByEmail(c, identity.Email)
+	switch {
+	case err == nil:
+		userID = user.ID
+		// an unverified account may have been registered by someone else to
+		// squat the address; the provider proved who owns it, so whoever set
+		// the password loses it along with their sessions
+		if !user.EmailVerifiedAt.Valid {
+			if _, err := q.VerifyUserEmail(c, queries.VerifyUserEmailParams{ID: user.ID, Email: user.Email}); err != nil {
+				return uuid.Nil, err
+			}
+			err := q.UpdateUserPassword(c, queries.UpdateUserPasswordParams{
+				HashedPassword: noPassword,
+				ID:             user.ID,
+			})
+			if err != nil {
+				return uuid.Nil, err
+			}
+			if _, err := q.RevokeSessions(c, queries.RevokeSessionsParams{UserID: user.ID}); err != nil {
+				return uuid.Nil, err
+			}
+		}
+	case err == sql.ErrNoRows:
+		userID, err = createOIDCUser(c, q, identity)
+		if err != nil {
+			return uuid.Nil, err
+		}
+	default:
+		return uuid.Nil, err
+	}
+
+	err = q.LinkUserIdentity(c, queries.LinkUserIdentityParams{
+		UserID:  userID,
+		Issuer:  provider.Issuer(),
+		Subject: identity.Subject,
+		Email:   identity.Email,
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// createOIDCUser signs up a new, already verified, passwordless account
+func createOIDCUser(c *gin.Context, q *queries.Queries, identity *sso.Identity) (uuid.UUID, error) {
+	username, err := oidcUsername(c, q, identity)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	user, err := q.CreateUser(c, queries.CreateUserParams{
+		ID:             uuid.New(),
+		Username:       username,
+		Email:          identity.Email,
+		HashedPassword: noPassword,
+		PfpUrl:         defaultPfpURL,
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	_, err = q.CreateAnalytics(c, queries.CreateAnalyticsParams{
+		ID:     uuid.New(),
+		UserID: user.ID,
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if _, err := q.VerifyUserEmail(c, queries.VerifyUserEmailParams{ID: user.ID, Email: user.Email}); err != nil {
+		return uuid.Nil, err
+	}
+
+	return user.ID, nil
+}
+
+// oidcUsername picks a free username (16 characters at most) from the
+// provider's preferred username or the email's local part
+func oidcUsername(c *gin.Context, q *queries.Queries, identity *sso.Identity) (string, error) {
+	source := identity.Username
+	if source == "" {
+		source, _, _ = strings.Cut(identity.Email, "@")
+	}
+
+	var b strings.Builder
+	for _, r := range source {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '-' || r == '.' {
+			b.WriteRune(r)
+		}
+	}
+	base := b.String()
+	if base == "" {
+		base = "user"
+	}
+	if len(base) > 16 {
+		base = base[:16]
+	}
+
+	candidate := base
+	for range 5 {
+		_, err := q.GetUserByUserName(c, candidate)
+		if err == sql.ErrNoRows {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s%04d", base[:min(len(base), 12)], mathrand.IntN(10000))
+	}
+	return "", errors.New("no free username")
+}
+
+// ListIdentitiesHandler lists the caller's linked sign-in providers
+func ListIdentitiesHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	identities, err := q.ListUserIdentities(c, userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not list linked accounts"})
+		return
+	}
+
+	// providers are configured by name, identities remember the issuer
+	names := make(map[string]string)
+	for _, p := range ssoProviders.List() {
+		names[p.Issuer()] = p.DisplayName()
+	}
+
+	response := make([]gin.H, 0, len(identities))
+	for _, identity := range identities {
+		response = append(response, gin.H{
+			"id":            identity.ID,
+			"provider":      names[identity.Issuer],
+			"issuer":        identity.Issuer,
+			"email":         identity.Email,
+			"created_at":    identity.CreatedAt,
+			"last_login_at": identity.LastLoginAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"identities": response})
+}
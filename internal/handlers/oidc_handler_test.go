@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/internal/sso"
+	"github.com/rvif/nano-url/internal/sso/ssotest"
+)
+
+// newOIDCTest registers a mock provider as "mock" and returns it with a
+// router serving the sign-in endpoints
+func newOIDCTest(t *testing.T) (*ssotest.Provider, *gin.Engine) {
+	t.Helper()
+	t.Setenv("FRONTEND_URL", "http://app.test")
+
+	mock := ssotest.NewProvider(t, "nano")
+	InitSSOProviders(sso.NewRegistry([]sso.ProviderConfig{{
+		Name:        "mock",
+		DisplayName: "Mock",
+		Issuer:      mock.URL,
+		ClientID:    "nano",
+		Scopes:      []string{"openid", "email", "profile"},
+		RedirectURL: "http://api.test/auth/oidc/mock/callback",
+	}}))
+	t.Cleanup(func() { InitSSOProviders(nil) })
+
+	router := gin.New()
+	router.GET("/auth/oidc/:provider/login", OIDCLoginHandler)
+	router.GET("/auth/oidc/:provider/callback", OIDCCallbackHandler)
+	return mock, router
+}
+
+// oidcSignIn goes through login, the provider and the callback like a
+// browser would and returns where the callback sent it
+func oidcSignIn(t *testing.T, mock *ssotest.Provider, router *gin.Engine) *url.URL {
+	t.Helper()
+
+	login := httptest.NewRecorder()
+	router.ServeHTTP(login, httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/login", nil))
+	if login.Code != http.StatusFound {
+		t.Fatalf("login answered %d: %s", login.Code, login.Body.String())
+	}
+
+	code, state, err := mock.Authorize(login.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("authorizing: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/callback?"+url.Values{
+		"code":  {code},
+		"state": {state},
+	}.Encode(), nil)
+	for _, cookie := range login.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	return callback(t, router, req)
+}
+
+func callback(t *testing.T, router *gin.Engine, req *http.Request) *url.URL {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("callback answered %d: %s", rec.Code, rec.Body.String())
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("parsing redirect: %v", err)
+	}
+	return location
+}
+
+func fragment(t *testing.T, location *url.URL) url.Values {
+	t.Helper()
+
+	values, err := url.ParseQuery(location.Fragment)
+	if err != nil {
+		t.Fatalf("parsing fragment %q: %v", location.Fragment, err)
+	}
+	return values
+}
+
+// the state check runs before the database is touched, so this needs none
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	_, router := newOIDCTest(t)
+
+	tests := []struct {
+		name   string
+		cookie string
+	}{
+		{"other browser's state", "b2b2b2"},
+		{"no cookie", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/callback?code=abc&state=a1a1a1", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: tt.cookie})
+			}
+
+			location := callback(t, router, req)
+			if location.Path != "/auth/login" {
+				t.Errorf("redirected to %s, want /auth/login", location.Path)
+			}
+			values := fragment(t, location)
+			if got := values.Get("error"); got != "Sign-in expired, please try again" {
+				t.Errorf("error = %q", got)
+			}
+			if values.Has("access_token") {
+				t.Error("tokens handed out on a mismatched state")
+			}
+		})
+	}
+}
+
+func TestOIDCSignInCreatesAccount(t *testing.T) {
+	q := testDB(t)
+	mock, router := newOIDCTest(t)
+	email := "oidc-" + uuid.NewString()[:8] + "@example.com"
+	mock.User = ssotest.Claims{Subject: uuid.NewString(), Email: email, EmailVerified: true}
+
+	location := oidcSignIn(t, mock, router)
+	if location.Path != "/auth/oidc/callback" || !fragment(t, location).Has("access_token") {
+		t.Fatalf("redirected to %s", location)
+	}
+
+	user, err := q.GetUserByEmail(t.Context(), email)
+	if err != nil {
+		t.Fatalf("loading new account: %v", err)
+	}
+	if !user.EmailVerifiedAt.Valid {
+		t.Error("new account's email isn't verified")
+	}
+	if user.HashedPassword != noPassword {
+		t.Error("new account has a password")
+	}
+}
+
+func TestOIDCSignInRejectsNonceMismatch(t *testing.T) {
+	testDB(t)
+	mock, router := newOIDCTest(t)
+	mock.User = ssotest.Claims{Subject: uuid.NewString(), Email: "nonce@example.com", EmailVerified: true}
+	mock.Nonce = "someone-elses-nonce"
+
+	location := oidcSignIn(t, mock, router)
+	values := fragment(t, location)
+	if location.Path != "/auth/login" || values.Has("access_token") {
+		t.Fatalf("redirected to %s", location)
+	}
+	if got := values.Get("error"); got != "Could not sign in with Mock" {
+		t.Errorf("error = %q", got)
+	}
+}
+
+func TestOIDCSignInRequiresVerifiedEmail(t *testing.T) {
+	q := testDB(t)
+	mock, router := newOIDCTest(t)
+	email := "unverified-" + uuid.NewString()[:8] + "@example.com"
+	mock.User = ssotest.Claims{Subject: uuid.NewString(), Email: email, EmailVerified: "false"}
+
+	location := oidcSignIn(t, mock, router)
+	values := fragment(t, location)
+	if location.Path != "/auth/login" || values.Has("access_token") {
+		t.Fatalf("redirected to %s", location)
+	}
+	if got := values.Get("error"); !strings.Contains(got, "needs a verified email") {
+		t.Errorf("error = %q", got)
+	}
+
+	if _, err := q.GetUserByEmail(t.Context(), email); err != sql.ErrNoRows {
+		t.Errorf("account lookup err = %v, want no account", err)
+	}
+}
+
+func TestOIDCSignInLinksVerifiedAccount(t *testing.T) {
+	q := testDB(t)
+	mock, router := newOIDCTest(t)
+	existing := createTestUser(t, q)
+	subject := uuid.NewString()
+	mock.User = ssotest.Claims{Subject: subject, Email: existing.Email, EmailVerified: true}
+
+	location := oidcSignIn(t, mock, router)
+	if location.Path != "/auth/oidc/callback" || !fragment(t, location).Has("access_token") {
+		t.Fatalf("redirected to %s", location)
+	}
+
+	identities, err := q.ListUserIdentities(t.Context(), existing.ID)
+	if err != nil {
+		t.Fatalf("listing identities: %v", err)
+	}
+	if len(identities) != 1 || identities[0].Issuer != mock.URL || identities[0].Subject != subject {
+		t.Fatalf("identities = %+v, want the mock identity", identities)
+	}
+
+	user, err := q.GetUserById(t.Context(), existing.ID)
+	if err != nil {
+		t.Fatalf("loading account: %v", err)
+	}
+	if user.HashedPassword != existing.HashedPassword {
+		t.Error("linking a verified account changed its password")
+	}
+
+	// the second sign-in goes through the link
+	mock.User.Email = "changed-" + existing.Email
+	location = oidcSignIn(t, mock, router)
+	if location.Path != "/auth/oidc/callback" || !fragment(t, location).Has("access_token") {
+		t.Fatalf("second sign-in redirected to %s", location)
+	}
+}
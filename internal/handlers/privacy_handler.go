@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+	"github.com/rvif/nano-url/internal/services"
+)
+
+var retentionPurger *services.RetentionPurger
+
+func InitRetentionPurger(purger *services.RetentionPurger) {
+	retentionPurger = purger
+}
+
+func privacyIPMode() string {
+	if clickIPMode == "none" || (clickIPMode == "hash" && ipHashKey != "") {
+		return clickIPMode
+	}
+	return "truncate"
+}
+
+// GetPrivacyHandler shows the personal-data setting of the caller's personal
+// workspace and how click data is kept
+func GetPrivacyHandler(c *gin.Context) {
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	workspace, ok := personalWorkspace(c, q)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, privacyJSON(workspace.NoPersonalData))
+}
+
+// GetWorkspacePrivacyHandler shows a workspace's personal-data setting and
+// how click data is kept, for any of its members
+func GetWorkspacePrivacyHandler(c *gin.Context) {
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	workspace, ok := memberWorkspace(c, q, workspaceViewer)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, privacyJSON(workspace.NoPersonalData))
+}
+
+// personalWorkspace loads the caller's personal workspace, making it first
+// for accounts that don't have one yet. It writes the error response itself.
+func personalWorkspace(c *gin.Context, q *queries.Queries) (queries.GetMemberWorkspaceRow, bool) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return queries.GetMemberWorkspaceRow{}, false
+	}
+
+	workspaceID, err := q.EnsurePersonalWorkspace(c, uuid.NullUUID{UUID: userUUID, Valid: true})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return queries.GetMemberWorkspaceRow{}, false
+	}
+
+	workspace, err := q.GetMemberWorkspace(c, queries.GetMemberWorkspaceParams{
+		ID:     workspaceID,
+		UserID: userUUID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return queries.GetMemberWorkspaceRow{}, false
+	}
+
+	return workspace, true
+}
+
+func privacyJSON(noPersonalData bool) gin.H {
+	response := gin.H{
+		"no_personal_data": noPersonalData,
+		"ip_mode":          privacyIPMode(),
+	}
+	if retentionPurger != nil {
+		response["retention_days"] = retentionPurger.RetentionDays()
+	}
+	return response
+}
+
+type UpdatePrivacyRequest struct {
+	NoPersonalData bool `json:"no_personal_data"`
+}
+
+// UpdatePrivacyHandler switches no-personal-data mode for the caller's
+// personal workspace
+func UpdatePrivacyHandler(c *gin.Context) {
+	var req UpdatePrivacyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	workspace, ok := personalWorkspace(c, q)
+	if !ok {
+		return
+	}
+
+	setNoPersonalData(c, q, workspace.ID, req.NoPersonalData)
+}
+
+// UpdateWorkspacePrivacyHandler switches no-personal-data mode for a
+// workspace, for its admins and owners
+func UpdateWorkspacePrivacyHandler(c *gin.Context) {
+	var req UpdatePrivacyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	workspace, ok := memberWorkspace(c, q, workspaceAdmin)
+	if !ok {
+		return
+	}
+
+	setNoPersonalData(c, q, workspace.ID, req.NoPersonalData)
+}
+
+// setNoPersonalData switches the setting and writes the response. Turning it
+// on also scrubs referrer, country, device and IP from the click data already
+// stored for every link in the workspace, whoever created it.
+func setNoPersonalData(c *gin.Context, q *queries.Queries, workspaceID uuid.UUID, noPersonalData bool) {
+	enabled, err := q.SetWorkspaceNoPersonalData(c, queries.SetWorkspaceNoPersonalDataParams{
+		ID:             workspaceID,
+		NoPersonalData: noPersonalData,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update privacy settings"})
+		return
+	}
+
+	var scrubbed int64
+	if enabled {
+		scrubbed, err = q.ScrubWorkspaceClickData(c, workspaceID)
+		if err != nil {
+			fmt.Printf("Error scrubbing click data for workspace %s: %v\n", workspaceID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not remove stored click data"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"no_personal_data": enabled,
+		"clicks_scrubbed":  scrubbed,
+	})
+}
+
+// PurgeRetentionHandler runs the retention purge now and returns its report
+func PurgeRetentionHandler(c *gin.Context) {
+	if retentionPurger == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Retention purger is not configured"})
+		return
+	}
+
+	run, err := retentionPurger.RunNow(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not purge click data", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, retentionRunJSON(run))
+}
+
+// ListRetentionRunsHandler is the deletion report: the most recent purges
+// and what each removed (?limit=, default 30)
+func ListRetentionRunsHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "30"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	runs, err := q.ListRetentionRuns(c, int32(limit))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not list retention runs"})
+		return
+	}
+
+	response := make([]gin.H, 0, len(runs))
+	for _, run := range runs {
+		response = append(response, retentionRunJSON(run))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func retentionRunJSON(run queries.RetentionRun) gin.H {
+	return gin.H{
+		"id":                  run.ID,
+		"ran_at":              run.RanAt,
+		"cutoff":              run.Cutoff,
+		"clicks_deleted":      run.ClicksDeleted,
+		"conversions_deleted": run.ConversionsDeleted,
+		"rollup_rows":         run.RollupRows,
+		"duration_ms":         run.DurationMs,
+		"error":               run.Error.String,
+	}
+}
@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+	"github.com/rvif/nano-url/internal/services"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// profile pictures are saved here and served under /api/v1/images
+	pfpUploadDir  = "./public/images"
+	defaultPfpURL = services.DefaultPfpURL
+	maxPfpSize    = 5 << 20
+
+	// how long the links of an email change work
+	emailChangeTTL = 24 * time.Hour
+)
+
+var pfpExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true}
+
+var errInvalidPfp = errors.New("profile picture must be a JPEG, PNG, GIF or WebP image of at most 5 MB")
+
+// saveProfilePicture stores an uploaded picture under a random name and
+// returns its URL path
+func saveProfilePicture(c *gin.Context, fileHeader *multipart.FileHeader) (string, error) {
+	ext := strings.ToLower(filepath.Ext(fileHeader.Filename))
+	if !pfpExtensions[ext] || fileHeader.Size > maxPfpSize {
+		return "", errInvalidPfp
+	}
+
+	if err := os.MkdirAll(pfpUploadDir, 0755); err != nil {
+		return "", fmt.Errorf("creating %s: %w", pfpUploadDir, err)
+	}
+
+	filename := strings.ReplaceAll(uuid.New().String(), "-", "") + ext
+	uploadPath := filepath.Join(pfpUploadDir, filename)
+	if err := c.SaveUploadedFile(fileHeader, uploadPath); err != nil {
+		return "", fmt.Errorf("saving %s: %w", uploadPath, err)
+	}
+
+	fmt.Printf("Successfully saved profile picture to %s\n", uploadPath)
+	return "/images/" + filename, nil
+}
+
+func profileJSON(user queries.User) gin.H {
+	return gin.H{
+		"id":                user.ID,
+		"username":          user.Username,
+		"email":             user.Email,
+		"pfpUrl":            user.PfpUrl,
+		"role":              user.Role,
+		"email_verified":    user.EmailVerifiedAt.Valid,
+		"email_verified_at": user.EmailVerifiedAt,
+	}
+}
+
+type UpdateProfileRequest struct {
+	Username string `form:"username" json:"username" binding:"omitempty,max=16"`
+	Email    string `form:"email" json:"email" binding:"omitempty,email"`
+}
+
+// UpdateProfileHandler changes the caller's username and profile picture
+// (multipart "pfp"), and starts an email change. The new email only takes
+// effect once links mailed to both the current and the new address are
+// followed.
+func UpdateProfileHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateProfileRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Username = strings.TrimSpace(req.Username)
+	req.Email = strings.TrimSpace(req.Email)
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	user, err := q.GetUserById(c, userUUID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Could not find user"})
+		return
+	}
+
+	var params queries.UpdateUserProfileParams
+	params.ID = userUUID
+
+	if req.Username != "" && req.Username != user.Username {
+		existing, err := q.GetUserByUserName(c, req.Username)
+		if err == nil && existing.ID != userUUID {
+			c.JSON(http.StatusConflict, gin.H{"error": "This username is taken"})
+			return
+		}
+		if err != nil && err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		params.Username = sql.NullString{String: req.Username, Valid: true}
+	}
+
+	changeEmail := req.Email != "" && !strings.EqualFold(req.Email, user.Email)
+	if changeEmail {
+		_, err := q.GetUserByEmail(c, req.Email)
+		if err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "A user with this email already exists"})
+			return
+		}
+		if err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+
+		err = startEmailChange(c, q, user, req.Email)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "An email change was just requested, try again in a minute"})
+			return
+		}
+		if err != nil {
+			fmt.Printf("Error starting email change for user %s: %v\n", userUUID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start email change"})
+			return
+		}
+	}
+
+	if fileHeader, err := c.FormFile("pfp"); err == nil {
+		pfpURL, err := saveProfilePicture(c, fileHeader)
+		if err == errInvalidPfp {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			fmt.Printf("Error saving profile picture: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save profile picture"})
+			return
+		}
+		params.PfpUrl = sql.NullString{String: pfpURL, Valid: true}
+	}
+
+	updated, err := q.UpdateUserProfile(c, params)
+	if err != nil {
+		if params.PfpUrl.Valid {
+			services.RemoveProfilePicture(pfpUploadDir, params.PfpUrl.String)
+		}
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			c.JSON(http.StatusConflict, gin.H{"error": "This username is taken"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update profile"})
+		return
+	}
+	if params.PfpUrl.Valid {
+		services.RemoveProfilePicture(pfpUploadDir, user.PfpUrl)
+	}
+
+	response := profileJSON(updated)
+	if changeEmail {
+		response["pending_email"] = req.Email
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// startEmailChange records the change and mails a confirmation link to each
+// address. It returns sql.ErrNoRows when a change was requested in the last
+// minute.
+func startEmailChange(c *gin.Context, q *queries.Queries, user queries.User, newEmail string) error {
+	oldToken, err := randomHex(32)
+	if err != nil {
+		return err
+	}
+	newToken, err := randomHex(32)
+	if err != nil {
+		return err
+	}
+
+	started, err := q.StartEmailChange(c, queries.StartEmailChangeParams{
+		UserID:       user.ID,
+		NewEmail:     newEmail,
+		OldTokenHash: hashToken(oldToken),
+		NewTokenHash: hashToken(newToken),
+		ExpiresAt:    time.Now().Add(emailChangeTTL),
+	})
+	if err != nil {
+		return err
+	}
+	if started == 0 {
+		return sql.ErrNoRows
+	}
+
+	apiURL := os.Getenv("API_URL")
+	if apiURL == "" {
+		apiURL = "http://localhost:8080/api/v1"
+	}
+	link := func(token string) string {
+		return fmt.Sprintf("%s/auth/confirm-email-change?token=%s", apiURL, url.QueryEscape(token))
+	}
+
+	oldBody := fmt.Sprintf("Someone asked to change your nano account's email address to %s. To allow it, follow this link: %s<br><br>The link works for 24 hours. If this wasn't you, ignore this email and change your password.", newEmail, link(oldToken))
+	if err := mailClient.SendEmail(user.Email, "Confirm your email address change", oldBody); err != nil {
+		return err
+	}
+
+	newBody := fmt.Sprintf("Confirm this is the new email address for your nano account %s: %s<br><br>The link works for 24 hours. The change also has to be confirmed from your current address.", user.Username, link(newToken))
+	return mailClient.SendEmail(newEmail, "Confirm your new email address", newBody)
+}
+
+// ConfirmEmailChangeHandler is where both links of an email change land. The
+// second one applies the change.
+func ConfirmEmailChangeHandler(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+
+	DB := db.GetDB()
+	tx, err := DB.BeginTx(c, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	defer tx.Rollback()
+
+	q := queries.New(DB).WithTx(tx)
+
+	change, err := q.ConfirmEmailChange(c, hashToken(token))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired link"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if !change.Complete {
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Confirmed. Your email changes once the link sent to the other address is followed too"})
+		return
+	}
+
+	err = q.UpdateUserEmail(c, queries.UpdateUserEmailParams{
+		ID:    change.UserID,
+		Email: change.NewEmail,
+	})
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		c.JSON(http.StatusConflict, gin.H{"error": "A user with this email already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not change email"})
+		return
+	}
+
+	if err := q.DeleteEmailChange(c, change.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not change email"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not change email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Your email address has been changed"})
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=6"`
+}
+
+// ChangePasswordHandler sets a new password given the current one. Every
+// other session is signed out.
+func ChangePasswordHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	user, err := q.GetUserById(c, userUUID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Could not find user"})
+		return
+	}
+	if user.HashedPassword == noPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This account has no password yet, set one with forgot password"})
+		return
+	}
+
+	// guesses with a stolen session count like guesses at the login form
+	if !allowAttempt(c, q, loginAccountThrottle, throttleEmailKey(user.Email)) {
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(req.CurrentPassword)); err != nil {
+		recordLoginFailure(c, q, user.Email, uuid.NullUUID{UUID: user.ID, Valid: true})
+		c.JSON(http.StatusForbidden, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failure in hashing password"})
+		return
+	}
+
+	err = q.UpdateUserPassword(c, queries.UpdateUserPasswordParams{
+		HashedPassword: string(hashedPassword),
+		ID:             userUUID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failure in updating password"})
+		return
+	}
+
+	sessions, err := q.ListUserSessions(c, userUUID)
+	if err != nil {
+		fmt.Printf("Error listing sessions for user %s: %v\n", userUUID, err)
+	}
+	revoked := 0
+	for _, session := range sessions {
+		if session.ID == currentSessionID(c) {
+			continue
+		}
+		_, err := q.RevokeSessions(c, queries.RevokeSessionsParams{
+			UserID: userUUID,
+			ID:     uuid.NullUUID{UUID: session.ID, Valid: true},
+		})
+		if err != nil {
+			fmt.Printf("Error revoking session %s: %v\n", session.ID, err)
+			continue
+		}
+		revoked++
+	}
+
+	go func(email string) {
+		emailBody := "The password of your nano account was just changed, and every other device was signed out.<br><br>If this wasn't you, reset your password right away."
+		if err := mailClient.SendEmail(email, "Your password was changed", emailBody); err != nil {
+			fmt.Printf("Error sending password change notice: %v\n", err)
+		}
+	}(user.Email)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed", "sessions_revoked": revoked})
+}
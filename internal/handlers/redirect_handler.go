@@ -1,14 +1,30 @@
 package handlers
 
 import (
+	"database/sql"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rvif/nano-url/db"
 	"github.com/rvif/nano-url/internal/db/queries"
+	"github.com/rvif/nano-url/internal/metrics"
+	"github.com/rvif/nano-url/internal/services"
 )
 
+var clickAggregator *services.ClickAggregator
+
+func InitClickAggregator(aggregator *services.ClickAggregator) {
+	clickAggregator = aggregator
+}
+
+var clickHub *services.ClickHub
+
+func InitClickHub(hub *services.ClickHub) {
+	clickHub = hub
+}
+
 func RedirectToURLHandler(c *gin.Context) {
 	shortURL := c.Param("slug")
 	fmt.Printf("Received request for slug: %s\n", shortURL)
@@ -16,66 +32,74 @@ func RedirectToURLHandler(c *gin.Context) {
 	DB := db.GetDB()
 	q := queries.New(DB)
 
-	slugExists, err := q.SlugExists(c, shortURL)
-	if err != nil {
-		fmt.Printf("Error checking if slug %s exists: %v\n", shortURL, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-		return
-	}
-
-	if !slugExists {
+	link, err := q.GetURLForRedirect(c, shortURL)
+	if err == sql.ErrNoRows {
+		metrics.Redirects.WithLabelValues("miss").Inc()
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": "URL not found",
 			"slug":  shortURL,
 		})
 		return
 	}
-
-	originalURL, err := q.GetURLByShortURL(c, shortURL)
 	if err != nil {
+		metrics.Redirects.WithLabelValues("error").Inc()
 		fmt.Printf("Error getting URL for slug %s: %v\n", shortURL, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
-	fmt.Printf("Found URL for slug %s: %s\n", shortURL, originalURL)
+	if link.Disabled {
+		metrics.Redirects.WithLabelValues("disabled").Inc()
+		c.JSON(http.StatusGone, gin.H{
+			"error": "This link has been disabled",
+			"slug":  shortURL,
+		})
+		return
+	}
+
+	metrics.Redirects.WithLabelValues("hit").Inc()
+	fmt.Printf("Found URL for slug %s: %s\n", shortURL, link.Url)
 
 	shouldIncrement := c.Query("increment") != "false"
 	isActualRedirect := c.Query("type") == "redirect"
 
+	destination := link.Url
 	if shouldIncrement && isActualRedirect {
-		// Increment click count in a separate goroutine
-		go func() {
-			ctx := c.Copy()
-			if err := q.IncrementURLClicks(ctx, shortURL); err != nil {
-				fmt.Printf("Error incrementing clicks for %s: %v\n", shortURL, err)
+		now := time.Now()
+
+		// buffered and written in batches by the aggregator, link/user
+		// analytics included. Tracked links cost a row per click, so only
+		// they get a click ID.
+		if clickAggregator != nil {
+			var recorded bool
+			if link.ConversionTracking {
+				destination, recorded = trackClick(c, link, now)
+			} else {
+				recorded = clickAggregator.Record(link.ID, link.UserID, now)
+			}
+			if !recorded {
+				fmt.Printf("Click buffer full, dropped click for %s\n", shortURL)
 			}
-		}()
-
-		/* Before redirecting, update user analytics */
-		userID, err := q.GetUserIDByShortURL(c, shortURL)
-		if err != nil {
-			fmt.Printf("Error getting user ID for slug %s: %v\n", shortURL, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-			return
 		}
 
-		_, err = q.UpdateAnalytics(c, queries.UpdateAnalyticsParams{
-			TotalUrls:        0,
-			TotalTotalClicks: 1,
-			UserID:           userID,
-		})
-
-		if err != nil {
-			fmt.Printf("Error updating analytics for user %s: %v\n", userID, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-			return
+		if clickHub != nil {
+			event := services.ClickEvent{
+				URLID:       link.ID,
+				WorkspaceID: link.WorkspaceID,
+				Slug:        shortURL,
+				Timestamp:   now,
+			}
+			// live viewers see no more than the stored click would keep
+			if !link.NoPersonalData {
+				event.Country = clientCountry(c)
+				event.Referrer = clickReferrer(c)
+				event.Device = deviceType(c.Request.UserAgent())
+			}
+			clickHub.Publish(event)
 		}
-
-		/* End of user analytics update */
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"originalURL": originalURL,
+		"originalURL": destination,
 	})
 }
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// how client IPs are kept in click-level data: "truncate" (default, IPv4 /24,
+// IPv6 /48), "hash" (HMAC-SHA256 keyed with IP_HASH_KEY) or "none"
+var clickIPMode = os.Getenv("CLICK_IP_MODE")
+var ipHashKey = os.Getenv("IP_HASH_KEY")
+
+// country headers set by the CDNs/edges we deploy behind, first match wins
+var countryHeaders = []string{
+	"CF-IPCountry",
+	"X-Vercel-IP-Country",
+	"X-Appengine-Country",
+	"X-Country-Code",
+}
+
+func clientCountry(c *gin.Context) string {
+	for _, header := range countryHeaders {
+		if country := strings.ToUpper(strings.TrimSpace(c.GetHeader(header))); country != "" && country != "XX" && country != "ZZ" {
+			return country
+		}
+	}
+	return ""
+}
+
+// clicks arrive as an XHR from the redirect page, so the page forwards its own
+// document.referrer as ?ref=; fall back to the Referer header for direct hits
+func clickReferrer(c *gin.Context) string {
+	if ref := c.Query("ref"); ref != "" {
+		return ref
+	}
+	return c.GetHeader("Referer")
+}
+
+// A/B variant label the link was shared under, forwarded by the redirect page
+// from its own ?variant= so each version of a campaign can be told apart
+func clickVariant(c *gin.Context) string {
+	variant := strings.TrimSpace(c.Query("variant"))
+	if len(variant) > 64 {
+		variant = variant[:64]
+	}
+	return variant
+}
+
+func deviceType(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case ua == "":
+		return "unknown"
+	case strings.Contains(ua, "bot") || strings.Contains(ua, "crawler") || strings.Contains(ua, "spider"):
+		return "bot"
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet") ||
+		(strings.Contains(ua, "android") && !strings.Contains(ua, "mobile")):
+		return "tablet"
+	case strings.Contains(ua, "mobi") || strings.Contains(ua, "iphone") || strings.Contains(ua, "android"):
+		return "mobile"
+	default:
+		return "desktop"
+	}
+}
+
+// anonymizedIP never returns the raw client address. Hash mode without a key
+// falls back to truncation rather than an unkeyed (reversible by brute force) hash.
+func anonymizedIP(c *gin.Context) string {
+	ip := net.ParseIP(c.ClientIP())
+	if ip == nil || clickIPMode == "none" {
+		return ""
+	}
+
+	if clickIPMode == "hash" && ipHashKey != "" {
+		mac := hmac.New(sha256.New, []byte(ipHashKey))
+		mac.Write(ip.To16())
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+)
+
+// currentSessionID is the session the request's access token belongs to,
+// set by AuthMiddleware from the sid claim
+func currentSessionID(c *gin.Context) uuid.UUID {
+	sessionID, _ := c.Get("session_id")
+	id, _ := sessionID.(uuid.UUID)
+	return id
+}
+
+// ListSessionsHandler lists the caller's signed-in devices, most recently
+// used first, flagging the one making the request
+func ListSessionsHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	sessions, err := q.ListUserSessions(c, userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not get sessions"})
+		return
+	}
+
+	current := currentSessionID(c)
+	response := make([]gin.H, 0, len(sessions))
+	for _, s := range sessions {
+		response = append(response, gin.H{
+			"id":           s.ID,
+			"device":       s.Device,
+			"ip":           s.Ip,
+			"user_agent":   s.UserAgent,
+			"created_at":   s.CreatedAt,
+			"last_used_at": s.LastUsedAt,
+			"expires_at":   s.ExpiresAt,
+			"current":      s.ID == current,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": response})
+}
+
+// RevokeSessionHandler signs one of the caller's sessions out: its refresh
+// token stops working and its access tokens are denylisted
+func RevokeSessionHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	revoked, err := q.RevokeSessions(c, queries.RevokeSessionsParams{
+		UserID: userUUID,
+		ID:     uuid.NullUUID{UUID: sessionID, Valid: true},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke session"})
+		return
+	}
+	if len(revoked) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeAllSessionsHandler logs the caller out everywhere, this device included
+func RevokeAllSessionsHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	revoked, err := q.RevokeSessions(c, queries.RevokeSessionsParams{UserID: userUUID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out everywhere", "revoked": len(revoked)})
+}
+
+// LogoutHandler ends the session the request's access token belongs to
+func LogoutHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	sessionID := currentSessionID(c)
+	if sessionID == uuid.Nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token has no session"})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	_, err := q.RevokeSessions(c, queries.RevokeSessionsParams{
+		UserID: userUUID,
+		ID:     uuid.NullUUID{UUID: sessionID, Valid: true},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
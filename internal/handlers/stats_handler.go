@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+)
+
+const maxShareTokenHours = 24 * 365
+
+type ShareURLStatsRequest struct {
+	// left out, the link stays as public or private as it was
+	Public         *bool `json:"public"`
+	ExpiresInHours int   `json:"expires_in_hours"`
+	RevokeTokens   bool  `json:"revoke_tokens"`
+}
+
+// ShareURLStatsHandler lets a workspace editor make a link's stats public
+// and/or mint an expiring share token for them. revoke_tokens invalidates
+// every token handed out so far.
+func ShareURLStatsHandler(c *gin.Context) {
+	var req ShareURLStatsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ExpiresInHours < 0 || req.ExpiresInHours > maxShareTokenHours {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("expires_in_hours must be between 1 and %d", maxShareTokenHours)})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	link, ok := authorizeLink(c, q, c.Param("short_url"), workspaceEditor)
+	if !ok {
+		return
+	}
+
+	var public sql.NullBool
+	if req.Public != nil {
+		public = sql.NullBool{Bool: *req.Public, Valid: true}
+	}
+
+	sharing, err := q.SetURLStatsSharing(c, queries.SetURLStatsSharingParams{
+		StatsPublic:  public,
+		RevokeTokens: req.RevokeTokens,
+		ID:           link.ID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update sharing"})
+		return
+	}
+
+	response := gin.H{
+		"short_url": link.ShortUrl,
+		"public":    sharing.StatsPublic,
+		"stats_url": "/api/v1/public/stats/" + link.ShortUrl,
+	}
+
+	if req.ExpiresInHours > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour)
+		// share tokens carry their own audience, they can't be used as access tokens
+		tokenStr, err := tokenService.IssueShareToken(link.ID, sharing.StatsShareVersion, expiresAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failure in creating token"})
+			return
+		}
+
+		response["share_token"] = tokenStr
+		response["expires_at"] = expiresAt
+		response["stats_url"] = "/api/v1/public/stats/" + link.ShortUrl + "?token=" + tokenStr
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// PublicURLStatsHandler serves one link's totals and daily series without
+// auth, if the owner made them public or the request carries a valid share
+// token. Anything else is a 404 so private links can't be probed.
+func PublicURLStatsHandler(c *gin.Context) {
+	loc, err := viewerLocation(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
+		return
+	}
+
+	days, ok := historyDays(c)
+	if !ok {
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	link, err := q.GetURLStatsByShortURL(c, c.Param("slug"))
+	if err == sql.ErrNoRows || (err == nil && !link.StatsPublic && !validShareToken(c.Query("token"), link.ID, link.StatsShareVersion)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stats not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	todayClicks, history, err := urlClickHistory(c, q, link.ShortUrl, loc, days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not get URL analytics"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"short_url":    link.ShortUrl,
+		"url":          link.Url,
+		"total_clicks": link.TotalClicks,
+		"daily_clicks": sql.NullInt32{Int32: todayClicks, Valid: true},
+		"last_clicked": link.LastClicked,
+		"created_at":   link.CreatedAt,
+		"timezone":     loc.String(),
+		"history":      history,
+	})
+}
+
+// validShareToken checks a share token was signed by us for this link and
+// hasn't been revoked by bumping the link's share version
+func validShareToken(tokenStr string, urlID uuid.UUID, version int32) bool {
+	if tokenStr == "" {
+		return false
+	}
+
+	claims, err := tokenService.ParseShareToken(tokenStr)
+	if err != nil {
+		return false
+	}
+
+	return claims.URLID == urlID.String() && claims.Version == version
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+	"github.com/rvif/nano-url/internal/metrics"
+)
+
+// throttlePolicy is how one kind of auth attempt backs off. Past the free
+// failures each one blocks the key for twice as long as the last.
+type throttlePolicy struct {
+	scope     string
+	free      int32
+	baseDelay time.Duration
+	maxDelay  time.Duration
+	// failures are forgotten after this long without one
+	window time.Duration
+	// failures that lock the account (0 for never) and for how long
+	lockoutAt int32
+	lockout   time.Duration
+}
+
+var (
+	loginIPThrottle = throttlePolicy{
+		scope: "login_ip", free: 20,
+		baseDelay: time.Second, maxDelay: 15 * time.Minute, window: time.Hour,
+	}
+	// wrong passwords and wrong 2FA codes both count against the account
+	loginAccountThrottle = throttlePolicy{
+		scope: "login_account", free: 5,
+		baseDelay: time.Second, maxDelay: 15 * time.Minute, window: 24 * time.Hour,
+		lockoutAt: 10, lockout: 30 * time.Minute,
+	}
+	// every reset request counts, not just failed ones: each sends an email
+	resetRequestIPThrottle = throttlePolicy{
+		scope: "reset_request_ip", free: 10,
+		baseDelay: time.Minute, maxDelay: time.Hour, window: time.Hour,
+	}
+	resetRequestAccountThrottle = throttlePolicy{
+		scope: "reset_request_account", free: 3,
+		baseDelay: 5 * time.Minute, maxDelay: time.Hour, window: time.Hour,
+	}
+	resetTokenIPThrottle = throttlePolicy{
+		scope: "reset_token_ip", free: 10,
+		baseDelay: time.Second, maxDelay: 15 * time.Minute, window: time.Hour,
+	}
+	// sign-in links are mailed like reset links and limited the same way
+	magicLinkRequestIPThrottle = throttlePolicy{
+		scope: "magic_link_request_ip", free: 10,
+		baseDelay: time.Minute, maxDelay: time.Hour, window: time.Hour,
+	}
+	magicLinkRequestAccountThrottle = throttlePolicy{
+		scope: "magic_link_request_account", free: 3,
+		baseDelay: 5 * time.Minute, maxDelay: time.Hour, window: time.Hour,
+	}
+	magicLinkTokenIPThrottle = throttlePolicy{
+		scope: "magic_link_token_ip", free: 10,
+		baseDelay: time.Second, maxDelay: 15 * time.Minute, window: time.Hour,
+	}
+	refreshIPThrottle = throttlePolicy{
+		scope: "refresh_token_ip", free: 20,
+		baseDelay: time.Second, maxDelay: 15 * time.Minute, window: time.Hour,
+	}
+)
+
+// throttle rows are kept this long after their last failure
+const throttleRetention = 24 * time.Hour
+
+func (p throttlePolicy) delay(failures int32) time.Duration {
+	var d time.Duration
+	if over := failures - p.free; over > 0 {
+		d = p.maxDelay
+		if over <= 30 {
+			d = min(p.baseDelay<<(over-1), p.maxDelay)
+		}
+	}
+	if p.lockoutAt > 0 && failures >= p.lockoutAt {
+		d = max(d, p.lockout)
+	}
+	return d
+}
+
+// emails are throttled by hash, whether or not an account has them
+func throttleEmailKey(email string) string {
+	return hashToken(strings.ToLower(strings.TrimSpace(email)))
+}
+
+// allowAttempt writes a 429 with Retry-After and returns false while the key
+// is backing off. Throttling fails open if it can't be checked.
+func allowAttempt(c *gin.Context, q *queries.Queries, p throttlePolicy, key string) bool {
+	until, err := q.GetAuthThrottleBlock(c, queries.GetAuthThrottleBlockParams{
+		Scope: p.scope,
+		Key:   key,
+	})
+	if err == sql.ErrNoRows {
+		return true
+	}
+	if err != nil {
+		fmt.Printf("Error checking %s throttle: %v\n", p.scope, err)
+		return true
+	}
+
+	metrics.AuthThrottled.WithLabelValues(p.scope).Inc()
+	retryAfter := int(math.Ceil(time.Until(until).Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many attempts, please try again later",
+		"retry_after": retryAfter,
+	})
+	return false
+}
+
+// recordFailure counts a failed attempt against the key, blocks it for the
+// policy's backoff and returns the failures so far
+func recordFailure(c *gin.Context, q *queries.Queries, p throttlePolicy, key string, userID uuid.NullUUID) int32 {
+	metrics.AuthFailures.WithLabelValues(p.scope).Inc()
+
+	now := time.Now()
+	failures, err := q.RecordAuthFailure(c, queries.RecordAuthFailureParams{
+		Scope:       p.scope,
+		Key:         key,
+		UserID:      userID,
+		LastIp:      c.ClientIP(),
+		ResetBefore: now.Add(-p.window),
+	})
+	if err != nil {
+		fmt.Printf("Error recording %s failure: %v\n", p.scope, err)
+		return 0
+	}
+
+	if d := p.delay(failures); d > 0 {
+		err := q.BlockAuthThrottle(c, queries.BlockAuthThrottleParams{
+			Scope:        p.scope,
+			Key:          key,
+			BlockedUntil: sql.NullTime{Time: now.Add(d), Valid: true},
+		})
+		if err != nil {
+			fmt.Printf("Error blocking %s throttle: %v\n", p.scope, err)
+		}
+	}
+
+	if err := q.DeleteStaleAuthThrottles(c, now.Add(-throttleRetention)); err != nil {
+		fmt.Printf("Error deleting stale throttles: %v\n", err)
+	}
+
+	return failures
+}
+
+func clearFailures(c *gin.Context, q *queries.Queries, p throttlePolicy, key string) {
+	err := q.ClearAuthThrottle(c, queries.ClearAuthThrottleParams{
+		Scope: p.scope,
+		Key:   key,
+	})
+	if err != nil {
+		fmt.Printf("Error clearing %s throttle: %v\n", p.scope, err)
+	}
+}
+
+// recordLoginFailure counts a wrong password or 2FA code against the client
+// and the account, and mails the owner the first time the account locks
+func recordLoginFailure(c *gin.Context, q *queries.Queries, email string, userID uuid.NullUUID) {
+	recordFailure(c, q, loginIPThrottle, c.ClientIP(), uuid.NullUUID{})
+
+	key := throttleEmailKey(email)
+	failures := recordFailure(c, q, loginAccountThrottle, key, userID)
+	if !userID.Valid || failures < loginAccountThrottle.lockoutAt {
+		return
+	}
+
+	locked, err := q.LockAuthThrottle(c, queries.LockAuthThrottleParams{
+		Scope: loginAccountThrottle.scope,
+		Key:   key,
+	})
+	if err != nil || locked == 0 {
+		return
+	}
+
+	log.Printf("Locked account %s after %d failed sign-ins", userID.UUID, failures)
+	go sendLockoutNotice(email)
+}
+
+func sendLockoutNotice(email string) {
+	frontendURL := os.Getenv("FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = "https://rvif.me"
+	}
+
+	emailBody := fmt.Sprintf("There were %d failed attempts to sign in to your nano account, so sign-in is locked for %d minutes.<br><br>If this wasn't you, someone may be guessing your password. Resetting it also unlocks your account: %s/auth/forgot-password",
+		loginAccountThrottle.lockoutAt, int(loginAccountThrottle.lockout.Minutes()), frontendURL)
+
+	if err := mailClient.SendEmail(email, "Sign-in to your account was locked", emailBody); err != nil {
+		fmt.Printf("Error sending lockout notice: %v\n", err)
+	}
+}
+
+// ListLockedAccountsHandler lists accounts locked by failed sign-ins
+func ListLockedAccountsHandler(c *gin.Context) {
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	locked, err := q.ListLockedAccounts(c, loginAccountThrottle.scope)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not list locked accounts"})
+		return
+	}
+
+	response := make([]gin.H, 0, len(locked))
+	for _, account := range locked {
+		response = append(response, gin.H{
+			"user_id":         account.UserID.UUID,
+			"username":        account.Username,
+			"email":           account.Email,
+			"failures":        account.Failures,
+			"locked_at":       account.LockedAt.Time,
+			"locked_until":    account.BlockedUntil.Time,
+			"last_failure_at": account.LastFailureAt,
+			"last_ip":         account.LastIp,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// UnlockAccountHandler lifts a lockout and forgets the account's failures
+func UnlockAccountHandler(c *gin.Context) {
+	userUUID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	cleared, err := q.ClearUserAuthThrottles(c, uuid.NullUUID{UUID: userUUID, Valid: true})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not unlock account"})
+		return
+	}
+	if cleared == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account is not throttled"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlocked"})
+}
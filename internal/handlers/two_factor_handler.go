@@ -0,0 +1,494 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"image/png"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	totpIssuer = "nano"
+	totpPeriod = 30
+
+	recoveryCodeCount = 10
+
+	// how long the password step of a login stays good for
+	loginChallengeTTL = 5 * time.Minute
+	// wrong codes a challenge takes before the login has to start over
+	loginChallengeAttempts = 5
+)
+
+var totpOpts = totp.ValidateOpts{
+	Period:    totpPeriod,
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+// matchTOTP checks code against the current time step and the ones either
+// side of it (clock drift), and returns the step it belongs to
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	for _, offset := range []int64{0, -1, 1} {
+		step := now.Unix()/totpPeriod + offset
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(step*totpPeriod, 0), totpOpts)
+		if err == nil && subtle.ConstantTimeCompare([]byte(code), []byte(expected)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// recovery codes are compared case-insensitively and without their dash
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+func newRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw))
+		codes[i] = code[:4] + "-" + code[4:]
+	}
+	return codes, nil
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused
+// recovery code, using it up so it can't be replayed
+func verifySecondFactor(c *gin.Context, q *queries.Queries, userID uuid.UUID, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		used, err := q.UseRecoveryCode(c, queries.UseRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: hashToken(normalizeRecoveryCode(recoveryCode)),
+		})
+		return used == 1, err
+	}
+
+	twoFactor, err := q.GetUserTOTP(c, userID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := matchTOTP(twoFactor.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	claimed, err := q.UseTOTPStep(c, queries.UseTOTPStepParams{
+		UserID:       userID,
+		LastUsedStep: step,
+	})
+	return claimed == 1, err
+}
+
+// createLoginChallenge stores a short-lived challenge for a user who got
+// past the first factor, and returns its token
+func createLoginChallenge(c *gin.Context, q *queries.Queries, userID uuid.UUID) (string, error) {
+	if err := q.DeleteExpiredLoginChallenges(c, userID); err != nil {
+		fmt.Printf("Error deleting expired login challenges for user %s: %v\n", userID, err)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	challengeToken := hex.EncodeToString(raw)
+
+	err := q.CreateLoginChallenge(c, queries.CreateLoginChallengeParams{
+		UserID:    userID,
+		TokenHash: hashToken(challengeToken),
+		ExpiresAt: time.Now().Add(loginChallengeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return challengeToken, nil
+}
+
+// startLoginChallenge answers a correct password on a 2FA account with a
+// short-lived challenge token instead of real tokens
+func startLoginChallenge(c *gin.Context, q *queries.Queries, userID uuid.UUID) {
+	challengeToken, err := createLoginChallenge(c, q, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"two_factor_required": true,
+		"challenge_token":     challengeToken,
+		"expires_in":          int(loginChallengeTTL.Seconds()),
+	})
+}
+
+type VerifyLoginChallengeRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+// VerifyLoginChallengeHandler is the second step of a 2FA login: the
+// challenge token and a TOTP or recovery code are exchanged for real tokens
+func VerifyLoginChallengeHandler(c *gin.Context) {
+	var req VerifyLoginChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Code == "" && req.RecoveryCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code or recovery_code is required"})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	if !allowAttempt(c, q, loginIPThrottle, c.ClientIP()) {
+		return
+	}
+
+	challenge, err := q.AttemptLoginChallenge(c, queries.AttemptLoginChallengeParams{
+		TokenHash:   hashToken(req.ChallengeToken),
+		MaxAttempts: loginChallengeAttempts,
+	})
+	if err == sql.ErrNoRows {
+		recordFailure(c, q, loginIPThrottle, c.ClientIP(), uuid.NullUUID{})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login challenge, please log in again"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// a fresh password login gets a fresh challenge, so code guesses count
+	// against the account like wrong passwords do
+	user, err := q.GetUserById(c, challenge.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !allowAttempt(c, q, loginAccountThrottle, throttleEmailKey(user.Email)) {
+		return
+	}
+
+	ok, err := verifySecondFactor(c, q, challenge.UserID, req.Code, req.RecoveryCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !ok {
+		recordLoginFailure(c, q, user.Email, uuid.NullUUID{UUID: user.ID, Valid: true})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	if err := q.DeleteLoginChallenge(c, challenge.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	accessTokenStr, refreshToken, ok := startSession(c, q, challenge.UserID)
+	if !ok {
+		return
+	}
+	clearFailures(c, q, loginAccountThrottle, throttleEmailKey(user.Email))
+
+	c.JSON(http.StatusOK, gin.H{"access_token": accessTokenStr, "refresh_token": refreshToken})
+}
+
+// TwoFactorStatusHandler reports whether 2FA is on and how many recovery
+// codes are left
+func TwoFactorStatusHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	twoFactor, err := q.GetUserTOTP(c, userUUID)
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	enrolled := err == nil
+
+	remaining, err := q.CountUnusedRecoveryCodes(c, userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  enrolled && twoFactor.ConfirmedAt.Valid,
+		"pending":                  enrolled && !twoFactor.ConfirmedAt.Valid,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// EnrollTwoFactorHandler starts 2FA enrollment with a new secret, returned as
+// an otpauth:// URI and a QR code of it. Nothing changes for logins until
+// the first code is confirmed.
+func EnrollTwoFactorHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	user, err := q.GetUserById(c, userUUID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Could not find user"})
+		return
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: user.Email,
+		Period:      totpPeriod,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start enrollment"})
+		return
+	}
+
+	started, err := q.StartTOTPEnrollment(c, queries.StartTOTPEnrollmentParams{
+		UserID: userUUID,
+		Secret: key.Secret(),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start enrollment"})
+		return
+	}
+	if started == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	img, err := key.Image(256, 256)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start enrollment"})
+		return
+	}
+	var qr bytes.Buffer
+	if err := png.Encode(&qr, img); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start enrollment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      key.Secret(),
+		"otpauth_uri": key.URL(),
+		"qr_code":     "data:image/png;base64," + base64.StdEncoding.EncodeToString(qr.Bytes()),
+	})
+}
+
+type ConfirmTwoFactorRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// ConfirmTwoFactorHandler turns 2FA on once the authenticator produces a
+// valid code, and returns the recovery codes. They're only shown this once.
+func ConfirmTwoFactorHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req ConfirmTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	DB := db.GetDB()
+	tx, err := DB.BeginTx(c, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	defer tx.Rollback()
+
+	q := queries.New(DB).WithTx(tx)
+
+	twoFactor, err := q.GetUserTOTP(c, userUUID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start enrollment first"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if twoFactor.ConfirmedAt.Valid {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	ok, err = verifySecondFactor(c, q, userUUID, req.Code, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashToken(normalizeRecoveryCode(code))
+	}
+
+	if _, err := q.ConfirmTOTP(c, userUUID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not enable two-factor authentication"})
+		return
+	}
+	if err := q.DeleteRecoveryCodes(c, userUUID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not enable two-factor authentication"})
+		return
+	}
+	err = q.CreateRecoveryCodes(c, queries.CreateRecoveryCodesParams{
+		UserID:     userUUID,
+		CodeHashes: hashes,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not enable two-factor authentication"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not enable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+type DisableTwoFactorRequest struct {
+	Password     string `json:"password" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// DisableTwoFactorHandler turns 2FA off. A stolen access token isn't enough:
+// the caller re-authenticates with their password and a second factor.
+func DisableTwoFactorHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Code == "" && req.RecoveryCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code or recovery_code is required"})
+		return
+	}
+
+	DB := db.GetDB()
+	tx, err := DB.BeginTx(c, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	defer tx.Rollback()
+
+	// failures are recorded outside the transaction, which a miss rolls back
+	throttleQ := queries.New(DB)
+	q := throttleQ.WithTx(tx)
+
+	user, err := q.GetUserById(c, userUUID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Could not find user"})
+		return
+	}
+
+	// guesses with a stolen session count like guesses at the login form,
+	// for the password and the second factor alike
+	if !allowAttempt(c, throttleQ, loginAccountThrottle, throttleEmailKey(user.Email)) {
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(req.Password)); err != nil {
+		recordLoginFailure(c, throttleQ, user.Email, uuid.NullUUID{UUID: user.ID, Valid: true})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	twoFactor, err := q.GetUserTOTP(c, userUUID)
+	if err == sql.ErrNoRows || (err == nil && !twoFactor.ConfirmedAt.Valid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	ok, err = verifySecondFactor(c, q, userUUID, req.Code, req.RecoveryCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if !ok {
+		recordLoginFailure(c, throttleQ, user.Email, uuid.NullUUID{UUID: user.ID, Valid: true})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	if err := q.DeleteUserTOTP(c, userUUID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not disable two-factor authentication"})
+		return
+	}
+	if err := q.DeleteRecoveryCodes(c, userUUID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not disable two-factor authentication"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// a stolen session can't guess its way to turning 2FA off any faster than
+// the login form allows
+func TestDisableTwoFactorIsThrottled(t *testing.T) {
+	q := testDB(t)
+	user := createTestUser(t, q)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Next()
+	})
+	router.POST("/2fa/disable", DisableTwoFactorHandler)
+	guess := gin.H{"password": "wrong-password", "code": "000000"}
+
+	for i := 0; i <= int(loginAccountThrottle.free); i++ {
+		if rec := serveJSON(t, router, http.MethodPost, "/2fa/disable", guess); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("guess %d answered %d: %s", i+1, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := serveJSON(t, router, http.MethodPost, "/2fa/disable", guess)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("guess past the free ones answered %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After")
+	}
+}
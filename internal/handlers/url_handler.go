@@ -2,14 +2,20 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/rvif/nano-url/db"
 	"github.com/rvif/nano-url/internal/db/queries"
+	"github.com/rvif/nano-url/internal/services"
 )
 
 const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
@@ -43,12 +49,19 @@ func createUniqueShortURL(db *sql.DB) (string, error) {
 }
 
 type CreateURLRequest struct {
-	UserID   uuid.UUID `json:"user_id"`
-	URL      string    `json:"url"`
-	ShortURL string    `json:"short_url"`
+	WorkspaceID uuid.NullUUID `json:"workspace_id"`
+	URL         string        `json:"url"`
+	ShortURL    string        `json:"short_url"`
 }
 
+// CreateURLHandler shortens a link into the workspace_id workspace, which
+// the caller has to be an editor of, or into their personal workspace
 func CreateURLHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
 	var req CreateURLRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -58,13 +71,12 @@ func CreateURLHandler(c *gin.Context) {
 	DB := db.GetDB()
 	q := queries.New(DB)
 
-	user, err := q.GetUserById(c, req.UserID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	workspaceID, ok := targetWorkspace(c, q, userID, req.WorkspaceID)
+	if !ok {
 		return
 	}
 
-	userID := user.ID
+	var err error
 	var shortURL string
 	if req.ShortURL != "" {
 
@@ -89,9 +101,10 @@ func CreateURLHandler(c *gin.Context) {
 	}
 
 	url, err := q.CreateURL(c, queries.CreateURLParams{
-		UserID:   userID,
-		Url:      req.URL,
-		ShortUrl: shortURL,
+		UserID:      userID,
+		Url:         req.URL,
+		ShortUrl:    shortURL,
+		WorkspaceID: workspaceID,
 	})
 
 	if err != nil {
@@ -99,35 +112,22 @@ func CreateURLHandler(c *gin.Context) {
 		return
 	}
 
-	/* Before redirecting, update user analytics */
-	userID, err = q.GetUserIDByShortURL(c, shortURL)
-	if err != nil {
-		fmt.Printf("Error getting user ID for slug %s: %v\n", shortURL, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-		return
-	}
-
-	_, err = q.UpdateAnalytics(c, queries.UpdateAnalyticsParams{
-		TotalUrls:        1,
-		TotalTotalClicks: 0,
-		UserID:           userID,
-	})
-
+	// account analytics are derived from urls, rebuild the creator's row
+	_, err = q.RecomputeUserAnalytics(c, userID)
 	if err != nil {
-		fmt.Printf("Error updating analytics for user %s: %v\n", userID, err)
+		fmt.Printf("Error recomputing analytics for user %s: %v\n", userID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 
-	/* End of user analytics update */
-
 	c.JSON(http.StatusOK, gin.H{
 		"id":           url.ID,
 		"user_id":      url.UserID,
+		"workspace_id": url.WorkspaceID,
 		"url":          url.Url,
 		"short_url":    url.ShortUrl,
 		"total_clicks": url.TotalClicks,
-		"daily_clicks": url.DailyClicks,
+		"daily_clicks": sql.NullInt32{Int32: 0, Valid: true},
 		"last_clicked": url.LastClicked,
 		"created_at":   url.CreatedAt,
 		"updated_at":   url.UpdatedAt,
@@ -135,10 +135,17 @@ func CreateURLHandler(c *gin.Context) {
 }
 
 type GetURLSByUserIDRequest struct {
-	UserID uuid.UUID `json:"user_id"`
+	WorkspaceID uuid.NullUUID `json:"workspace_id"`
 }
 
+// GetURLSByUserIDHandler lists the links in every workspace the caller is a
+// member of, or only in workspace_id
 func GetURLSByUserIDHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
 	var req GetURLSByUserIDRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -148,7 +155,10 @@ func GetURLSByUserIDHandler(c *gin.Context) {
 	DB := db.GetDB()
 	q := queries.New(DB)
 
-	urls, err := q.GetURLsByUserID(c, req.UserID)
+	urls, err := q.GetMemberURLs(c, queries.GetMemberURLsParams{
+		UserID:      userID,
+		WorkspaceID: req.WorkspaceID,
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not get URLs"})
 		return
@@ -157,55 +167,153 @@ func GetURLSByUserIDHandler(c *gin.Context) {
 	var response []gin.H
 	for _, url := range urls {
 		response = append(response, gin.H{
-			"id":         url.ID,
-			"url":        url.Url,
-			"short_url":  url.ShortUrl,
-			"created_at": url.CreatedAt,
-			"updated_at": url.UpdatedAt,
+			"id":           url.ID,
+			"workspace_id": url.WorkspaceID,
+			"user_id":      url.UserID,
+			"url":          url.Url,
+			"short_url":    url.ShortUrl,
+			"created_at":   url.CreatedAt,
+			"updated_at":   url.UpdatedAt,
 		})
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
-type DeleteURLRequest struct {
-	ShortURL string `json:"short_url"`
-}
-
+// DeleteURLHandler deletes the :short_url link, for editors of its workspace
 func DeleteURLHandler(c *gin.Context) {
-	var req DeleteURLRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
 	DB := db.GetDB()
 	q := queries.New(DB)
 
-	err := q.DeleteURL(c, req.ShortURL)
+	link, ok := authorizeLink(c, q, c.Param("short_url"), workspaceEditor)
+	if !ok {
+		return
+	}
+
+	err := q.DeleteURL(c, link.ShortUrl)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete URL"})
 		return
 	}
 
+	// keep the creator's total_urls and click totals in step with the
+	// remaining links
+	if _, err := q.RecomputeUserAnalytics(c, link.UserID); err != nil {
+		fmt.Printf("Error recomputing analytics for user %s: %v\n", link.UserID, err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "URL deleted"})
 }
 
-type GetURLAnalyticsRequest struct {
-	ShortURL string `json:"short_url"`
+var errInvalidTimezone = errors.New("invalid timezone")
+
+// viewerLocation resolves the timezone "today" is computed in, taken from the
+// ?tz= query param (IANA name, e.g. Asia/Kolkata) and defaulting to UTC
+func viewerLocation(c *gin.Context) (*time.Location, error) {
+	tz := c.Query("tz")
+	if tz == "" {
+		return time.UTC, nil
+	}
+	// "Local" is whatever zone the server runs in, not a zone name
+	if strings.EqualFold(tz, "Local") {
+		return nil, errInvalidTimezone
+	}
+	return time.LoadLocation(tz)
+}
+
+// viewerDayStart is the instant the viewer's current day began, local
+// midnight in loc
+func viewerDayStart(loc *time.Location) time.Time {
+	now := time.Now().In(loc)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+}
+
+// viewerTodayClicks counts the link's clicks since the viewer's midnight.
+// Daily buckets are UTC dates, so this reads the hourly ones; in zones
+// offset by a fraction of an hour the day starts at the top of the UTC hour
+// holding midnight.
+func viewerTodayClicks(c *gin.Context, q *queries.Queries, shortURL string, loc *time.Location) (int32, error) {
+	return q.GetURLClicksSince(c, queries.GetURLClicksSinceParams{
+		ShortUrl: shortURL,
+		Hour:     viewerDayStart(loc).Truncate(time.Hour),
+	})
 }
 
+// historyDays reads how many days of history to return, today included,
+// from ?days= (1-365, default 30). It writes the 400 itself.
+func historyDays(c *gin.Context) (int, bool) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 1 || days > 365 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 365"})
+		return 0, false
+	}
+	return days, true
+}
+
+// urlClickHistory returns the link's clicks for the viewer's today and the
+// daily series (UTC dates) for the last days days
+func urlClickHistory(c *gin.Context, q *queries.Queries, shortURL string, loc *time.Location, days int) (int32, []gin.H, error) {
+	todayClicks, err := viewerTodayClicks(c, q, shortURL, loc)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	buckets, err := q.GetURLDailyClicks(c, queries.GetURLDailyClicksParams{
+		ShortUrl: shortURL,
+		Day:      services.UTCDay(time.Now()).AddDate(0, 0, -(days - 1)),
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	history := make([]gin.H, 0, len(buckets))
+	for _, b := range buckets {
+		history = append(history, gin.H{
+			"day":    b.Day.Format("2006-01-02"),
+			"clicks": b.Clicks,
+		})
+	}
+
+	return todayClicks, history, nil
+}
+
+// GetURLAnalyticsHandler serves the :short_url link's totals, daily history
+// and conversions to anyone in its workspace
 func GetURLAnalyticsHandler(c *gin.Context) {
-	var req GetURLAnalyticsRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	loc, err := viewerLocation(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
+		return
+	}
+
+	days, ok := historyDays(c)
+	if !ok {
 		return
 	}
 
 	DB := db.GetDB()
 	q := queries.New(DB)
 
-	url, err := q.GetURLAnalytics(c, req.ShortURL)
+	link, ok := authorizeLink(c, q, c.Param("short_url"), workspaceViewer)
+	if !ok {
+		return
+	}
+
+	url, err := q.GetURLAnalytics(c, link.ShortUrl)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not get URL analytics"})
+		return
+	}
+
+	todayClicks, history, err := urlClickHistory(c, q, link.ShortUrl, loc, days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not get URL analytics"})
+		return
+	}
+
+	// same window as the history, from the start of its first day
+	since := viewerDayStart(loc).AddDate(0, 0, -(days - 1))
+	conversions, err := urlConversionStats(c, q, link.ShortUrl, since)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not get URL analytics"})
 		return
@@ -213,61 +321,119 @@ func GetURLAnalyticsHandler(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"total_clicks": url.TotalClicks,
-		"daily_clicks": url.DailyClicks,
+		"daily_clicks": sql.NullInt32{Int32: todayClicks, Valid: true},
 		"last_clicked": url.LastClicked,
+		"timezone":     loc.String(),
+		"history":      history,
+		"conversions":  conversions,
 	})
 }
 
 type UpdateShortURLRequest struct {
-	UrlID       uuid.UUID `json:"url_id"`
-	NewURL      string    `json:"new_url"`
-	NewShortURL string    `json:"new_short_url"`
+	NewURL      string        `json:"new_url"`
+	NewShortURL string        `json:"new_short_url"`
+	WorkspaceID uuid.NullUUID `json:"workspace_id"`
 }
 
+// UpdateShortURLHandler changes the :url_id link's destination or slug, and
+// moves it to workspace_id if given. Moving takes editor in both workspaces.
 func UpdateShortURLHandler(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	urlID, err := uuid.Parse(c.Param("url_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL ID"})
+		return
+	}
+
 	var req UpdateShortURLRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	loc, err := viewerLocation(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
+		return
+	}
+
 	DB := db.GetDB()
 	q := queries.New(DB)
 
-	existingURL, err := q.GetURLByID(c, req.UrlID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+	link, ok := authorizeLinkByID(c, q, urlID, workspaceEditor)
+	if !ok {
 		return
 	}
 
-	// use existing values if new values are not provided
-	newURL := req.NewURL
-	if newURL == "" {
-		newURL = existingURL.Url
+	// a move and an edit that fails (a taken slug, say) leave the link as it was
+	tx, err := DB.BeginTx(c, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
 	}
+	defer tx.Rollback()
+
+	qtx := q.WithTx(tx)
 
-	newShortURL := req.NewShortURL
-	if newShortURL == "" {
-		newShortURL = existingURL.ShortUrl
+	if req.WorkspaceID.Valid && req.WorkspaceID.UUID != link.WorkspaceID {
+		workspaceID, ok := targetWorkspace(c, qtx, userID, req.WorkspaceID)
+		if !ok {
+			return
+		}
+
+		err := qtx.MoveURLToWorkspace(c, queries.MoveURLToWorkspaceParams{
+			ID:          link.ID,
+			WorkspaceID: workspaceID,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not move URL"})
+			return
+		}
 	}
 
-	url, err := q.UpdateShortURL(c, queries.UpdateShortURLParams{
-		Column1: newURL,
-		Column2: newShortURL,
-		ID:      req.UrlID,
+	// empty values keep what the link already has
+	url, err := qtx.UpdateShortURL(c, queries.UpdateShortURLParams{
+		Column1: req.NewURL,
+		Column2: req.NewShortURL,
+		ID:      link.ID,
 	})
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		if pqErr.Constraint == "urls_url_key" {
+			c.JSON(http.StatusConflict, gin.H{"error": "This URL has already been shortened"})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": "Short URL already exists"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update short URL"})
 		return
 	}
 
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update short URL"})
+		return
+	}
+
+	todayClicks, err := viewerTodayClicks(c, q, url.ShortUrl, loc)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not get URL analytics"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"id":           url.ID,
 		"user_id":      url.UserID,
+		"workspace_id": url.WorkspaceID,
 		"url":          url.Url,
 		"short_url":    url.ShortUrl,
 		"total_clicks": url.TotalClicks,
-		"daily_clicks": url.DailyClicks,
+		"daily_clicks": sql.NullInt32{Int32: todayClicks, Valid: true},
 		"last_clicked": url.LastClicked,
 		"created_at":   url.CreatedAt,
 		"updated_at":   url.UpdatedAt,
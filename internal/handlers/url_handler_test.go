@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/internal/db/queries"
+)
+
+// a move and an edit are one change: a taken slug answers 409 and the link
+// stays in its workspace
+func TestUpdateShortURLIsAtomic(t *testing.T) {
+	q := testDB(t)
+	ctx := t.Context()
+	user := createTestUser(t, q)
+	router := newLinkRouter(user.ID)
+
+	workspace, err := q.CreateWorkspace(ctx, "Team "+uuid.NewString()[:8])
+	if err != nil {
+		t.Fatalf("creating workspace: %v", err)
+	}
+	_, err = q.AddWorkspaceMember(ctx, queries.AddWorkspaceMemberParams{
+		WorkspaceID: workspace.ID,
+		UserID:      user.ID,
+		Role:        workspaceEditor,
+	})
+	if err != nil {
+		t.Fatalf("adding member: %v", err)
+	}
+
+	link := shorten(t, router, gin.H{"url": "https://example.com/" + uuid.NewString()})
+	taken := shorten(t, router, gin.H{"url": "https://example.com/" + uuid.NewString()})
+	before, err := q.GetURLForRedirect(ctx, link.ShortURL)
+	if err != nil {
+		t.Fatalf("loading link: %v", err)
+	}
+
+	rec := serveJSON(t, router, http.MethodPost, "/url/update/"+link.ID.String(), gin.H{
+		"new_short_url": taken.ShortURL,
+		"workspace_id":  workspace.ID,
+	})
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("taken slug answered %d: %s", rec.Code, rec.Body.String())
+	}
+
+	after, err := q.GetURLForRedirect(ctx, link.ShortURL)
+	if err != nil {
+		t.Fatalf("loading link: %v", err)
+	}
+	if after.WorkspaceID != before.WorkspaceID {
+		t.Errorf("link moved to %s though its edit failed", after.WorkspaceID)
+	}
+}
+
+// the update answers with today's clicks in the viewer's zone, like the
+// analytics it sits next to
+func TestUpdateShortURLTakesViewerTimezone(t *testing.T) {
+	q := testDB(t)
+	user := createTestUser(t, q)
+	router := newLinkRouter(user.ID)
+	link := shorten(t, router, gin.H{"url": "https://example.com/" + uuid.NewString()})
+	path := "/url/update/" + link.ID.String()
+	edit := gin.H{"new_url": "https://example.com/" + uuid.NewString()}
+
+	if rec := serveJSON(t, router, http.MethodPost, path+"?tz=Asia/Kolkata", edit); rec.Code != http.StatusOK {
+		t.Fatalf("known zone answered %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serveJSON(t, router, http.MethodPost, path+"?tz=Mars/Olympus_Mons", edit); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown zone answered %d: %s", rec.Code, rec.Body.String())
+	}
+}
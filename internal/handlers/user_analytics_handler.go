@@ -1,12 +1,14 @@
 package handlers
 
 import (
+	"database/sql"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/rvif/nano-url/db"
 	"github.com/rvif/nano-url/internal/db/queries"
+	"github.com/rvif/nano-url/internal/services"
 )
 
 func GetMyAnalyticsHandler(c *gin.Context) {
@@ -42,3 +44,57 @@ func GetMyAnalyticsHandler(c *gin.Context) {
 		"updated_at":         analytics.UpdatedAt,
 	})
 }
+
+var analyticsReconciler *services.AnalyticsReconciler
+
+func InitAnalyticsReconciler(reconciler *services.AnalyticsReconciler) {
+	analyticsReconciler = reconciler
+}
+
+// RecomputeAnalyticsHandler rebuilds user_analytics for the user in :user_id,
+// or for every user when no id is given
+func RecomputeAnalyticsHandler(c *gin.Context) {
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	if userIDStr := c.Param("user_id"); userIDStr != "" {
+		userID, err := uuid.Parse(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user-ID format"})
+			return
+		}
+
+		analytics, err := q.RecomputeUserAnalytics(c, userID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not recompute analytics"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"user_id":            analytics.UserID,
+			"total_urls":         analytics.TotalUrls,
+			"total_total_clicks": analytics.TotalTotalClicks,
+			"avg_daily_clicks":   analytics.AvgDailyClicks,
+			"updated_at":         analytics.UpdatedAt,
+		})
+		return
+	}
+
+	var users int64
+	var err error
+	if analyticsReconciler != nil {
+		users, err = analyticsReconciler.RunNow(c)
+	} else {
+		users, err = q.RecomputeAllUserAnalytics(c)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not recompute analytics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Analytics recomputed", "users": users})
+}
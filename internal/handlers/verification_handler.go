@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+)
+
+// how long a verification link works
+const verificationTokenTTL = 48 * time.Hour
+
+// sendVerificationEmail mails the account a signed verification link. It
+// returns sql.ErrNoRows when the account is verified or was mailed in the
+// last minute.
+func sendVerificationEmail(c *gin.Context, q *queries.Queries, userID uuid.UUID) error {
+	email, err := q.ClaimVerificationEmail(c, userID)
+	if err != nil {
+		return err
+	}
+
+	token, err := tokenService.IssueEmailVerificationToken(userID, email, time.Now().Add(verificationTokenTTL))
+	if err != nil {
+		return err
+	}
+
+	apiURL := os.Getenv("API_URL")
+	if apiURL == "" {
+		apiURL = "http://localhost:8080/api/v1"
+	}
+
+	verifyURL := fmt.Sprintf("%s/auth/verify-email?token=%s", apiURL, url.QueryEscape(token))
+	emailBody := fmt.Sprintf("Confirm this is your email address: %s<br><br>The link works for 48 hours. If you didn't sign up for nano, ignore this email.", verifyURL)
+
+	return mailClient.SendEmail(email, "Verify your email address", emailBody)
+}
+
+// VerifyEmailHandler is where the link in the verification email lands
+func VerifyEmailHandler(c *gin.Context) {
+	claims, err := tokenService.ParseEmailVerificationToken(c.Query("token"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+		return
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	verified, err := q.VerifyUserEmail(c, queries.VerifyUserEmailParams{
+		ID:    userID,
+		Email: claims.Email,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify email"})
+		return
+	}
+
+	if verified == 0 {
+		user, err := q.GetUserById(c, userID)
+		if err != nil || user.Email != claims.Email {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Your email address is verified"})
+}
+
+// ResendVerificationHandler mails a fresh verification link, at most once a minute
+func ResendVerificationHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	err := sendVerificationEmail(c, q, userUUID)
+	if err == sql.ErrNoRows {
+		verified, err := q.IsUserEmailVerified(c, userUUID)
+		if err == nil && verified {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Email already verified"})
+			return
+		}
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "A verification email was sent less than a minute ago"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failure in sending email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
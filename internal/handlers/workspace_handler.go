@@ -0,0 +1,790 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+	"github.com/rvif/nano-url/internal/services"
+)
+
+// what a member can do in a workspace, each role can do everything the ones
+// before it can: viewers see links and analytics, editors manage links,
+// admins manage members and owners manage the workspace and its owners
+const (
+	workspaceViewer = "viewer"
+	workspaceEditor = "editor"
+	workspaceAdmin  = "admin"
+	workspaceOwner  = "owner"
+)
+
+var workspaceRoles = []string{workspaceViewer, workspaceEditor, workspaceAdmin, workspaceOwner}
+
+// how long a workspace invitation link works
+const workspaceInvitationTTL = 7 * 24 * time.Hour
+
+// workspaceRoleAtLeast reports whether role can do what min can; no role
+// can do nothing
+func workspaceRoleAtLeast(role, min string) bool {
+	return slices.Index(workspaceRoles, role) >= slices.Index(workspaceRoles, min)
+}
+
+// memberWorkspace loads the :workspace_id workspace with the caller's role
+// in it. Workspaces they aren't in are a 404 and a role below min is a 403;
+// it writes the response itself.
+func memberWorkspace(c *gin.Context, q *queries.Queries, min string) (queries.GetMemberWorkspaceRow, bool) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return queries.GetMemberWorkspaceRow{}, false
+	}
+
+	workspaceID, err := uuid.Parse(c.Param("workspace_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+		return queries.GetMemberWorkspaceRow{}, false
+	}
+
+	workspace, err := q.GetMemberWorkspace(c, queries.GetMemberWorkspaceParams{
+		ID:     workspaceID,
+		UserID: userUUID,
+	})
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+		return queries.GetMemberWorkspaceRow{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return queries.GetMemberWorkspaceRow{}, false
+	}
+
+	if !workspaceRoleAtLeast(workspace.Role, min) {
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("You need to be a workspace %s or above to do this", min)})
+		return queries.GetMemberWorkspaceRow{}, false
+	}
+
+	return workspace, true
+}
+
+// targetWorkspace picks the workspace a link goes into: the one asked for,
+// if the caller can edit links there, or else their personal workspace. It
+// writes the error response itself.
+func targetWorkspace(c *gin.Context, q *queries.Queries, userID uuid.UUID, workspaceID uuid.NullUUID) (uuid.UUID, bool) {
+	if !workspaceID.Valid {
+		personal, err := q.EnsurePersonalWorkspace(c, uuid.NullUUID{UUID: userID, Valid: true})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return uuid.Nil, false
+		}
+		return personal, true
+	}
+
+	role, err := q.GetWorkspaceMemberRole(c, queries.GetWorkspaceMemberRoleParams{
+		WorkspaceID: workspaceID.UUID,
+		UserID:      userID,
+	})
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+		return uuid.Nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return uuid.Nil, false
+	}
+	if !workspaceRoleAtLeast(role, workspaceEditor) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You need to be a workspace editor or above to add links there"})
+		return uuid.Nil, false
+	}
+
+	return workspaceID.UUID, true
+}
+
+// ListWorkspacesHandler lists the caller's workspaces, personal one first
+func ListWorkspacesHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	// accounts made since workspaces were added get theirs on first use
+	if _, err := q.EnsurePersonalWorkspace(c, uuid.NullUUID{UUID: userUUID, Valid: true}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not list workspaces"})
+		return
+	}
+
+	workspaces, err := q.ListMemberWorkspaces(c, userUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not list workspaces"})
+		return
+	}
+
+	response := make([]gin.H, 0, len(workspaces))
+	for _, w := range workspaces {
+		response = append(response, gin.H{
+			"id":               w.ID,
+			"name":             w.Name,
+			"personal":         w.Personal,
+			"role":             w.Role,
+			"member_count":     w.MemberCount,
+			"url_count":        w.UrlCount,
+			"no_personal_data": w.NoPersonalData,
+			"created_at":       w.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+type WorkspaceRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// CreateWorkspaceHandler creates a team workspace with the caller as its owner
+func CreateWorkspaceHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req WorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name can't be blank"})
+		return
+	}
+
+	DB := db.GetDB()
+	tx, err := DB.BeginTx(c, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	defer tx.Rollback()
+
+	q := queries.New(DB).WithTx(tx)
+
+	workspace, err := q.CreateWorkspace(c, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create workspace"})
+		return
+	}
+
+	_, err = q.AddWorkspaceMember(c, queries.AddWorkspaceMemberParams{
+		WorkspaceID: workspace.ID,
+		UserID:      userUUID,
+		Role:        workspaceOwner,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create workspace"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create workspace"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":               workspace.ID,
+		"name":             workspace.Name,
+		"personal":         false,
+		"role":             workspaceOwner,
+		"no_personal_data": workspace.NoPersonalData,
+		"created_at":       workspace.CreatedAt,
+	})
+}
+
+// GetWorkspaceHandler shows one of the caller's workspaces and their role in it
+func GetWorkspaceHandler(c *gin.Context) {
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	workspace, ok := memberWorkspace(c, q, workspaceViewer)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":               workspace.ID,
+		"name":             workspace.Name,
+		"personal":         workspace.Personal,
+		"role":             workspace.Role,
+		"no_personal_data": workspace.NoPersonalData,
+		"created_at":       workspace.CreatedAt,
+	})
+}
+
+// RenameWorkspaceHandler renames a workspace, for its admins and owners
+func RenameWorkspaceHandler(c *gin.Context) {
+	var req WorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name can't be blank"})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	workspace, ok := memberWorkspace(c, q, workspaceAdmin)
+	if !ok {
+		return
+	}
+
+	err := q.RenameWorkspace(c, queries.RenameWorkspaceParams{
+		ID:   workspace.ID,
+		Name: name,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not rename workspace"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":               workspace.ID,
+		"name":             name,
+		"personal":         workspace.Personal,
+		"role":             workspace.Role,
+		"no_personal_data": workspace.NoPersonalData,
+		"created_at":       workspace.CreatedAt,
+	})
+}
+
+// DeleteWorkspaceHandler deletes a team workspace and every link in it, for
+// its owners
+func DeleteWorkspaceHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	workspace, ok := memberWorkspace(c, q, workspaceOwner)
+	if !ok {
+		return
+	}
+	if workspace.Personal {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Your personal workspace can't be deleted"})
+		return
+	}
+
+	// account analytics count the links each member created, so note whose
+	// links are going
+	urls, err := q.GetMemberURLs(c, queries.GetMemberURLsParams{
+		UserID:      userUUID,
+		WorkspaceID: uuid.NullUUID{UUID: workspace.ID, Valid: true},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete workspace"})
+		return
+	}
+
+	if _, err := q.DeleteWorkspace(c, workspace.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete workspace"})
+		return
+	}
+
+	recomputed := make(map[uuid.UUID]bool)
+	for _, u := range urls {
+		if recomputed[u.UserID] {
+			continue
+		}
+		recomputed[u.UserID] = true
+		if _, err := q.RecomputeUserAnalytics(c, u.UserID); err != nil {
+			fmt.Printf("Error recomputing analytics for user %s: %v\n", u.UserID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Workspace deleted"})
+}
+
+// ListWorkspaceMembersHandler lists a workspace's members and their roles
+func ListWorkspaceMembersHandler(c *gin.Context) {
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	workspace, ok := memberWorkspace(c, q, workspaceViewer)
+	if !ok {
+		return
+	}
+
+	members, err := q.ListWorkspaceMembers(c, workspace.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not list members"})
+		return
+	}
+
+	response := make([]gin.H, 0, len(members))
+	for _, m := range members {
+		response = append(response, gin.H{
+			"user_id":   m.UserID,
+			"username":  m.Username,
+			"email":     m.Email,
+			"pfp_url":   m.PfpUrl,
+			"role":      m.Role,
+			"joined_at": m.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// memberTargetRole reads the :user_id member's current role, writing a 400
+// or 404 itself
+func memberTargetRole(c *gin.Context, q *queries.Queries, workspaceID uuid.UUID) (uuid.UUID, string, bool) {
+	memberID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return uuid.Nil, "", false
+	}
+
+	role, err := q.GetWorkspaceMemberRole(c, queries.GetWorkspaceMemberRoleParams{
+		WorkspaceID: workspaceID,
+		UserID:      memberID,
+	})
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return uuid.Nil, "", false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return uuid.Nil, "", false
+	}
+
+	return memberID, role, true
+}
+
+type SetWorkspaceMemberRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// SetWorkspaceMemberRoleHandler changes a member's role. Admins can move
+// members between viewer, editor and admin; only owners can make or unmake
+// owners, and the last owner can't step down.
+func SetWorkspaceMemberRoleHandler(c *gin.Context) {
+	var req SetWorkspaceMemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !slices.Contains(workspaceRoles, req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be one of " + strings.Join(workspaceRoles, ", ")})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	workspace, ok := memberWorkspace(c, q, workspaceAdmin)
+	if !ok {
+		return
+	}
+
+	memberID, currentRole, ok := memberTargetRole(c, q, workspace.ID)
+	if !ok {
+		return
+	}
+
+	if (currentRole == workspaceOwner || req.Role == workspaceOwner) && workspace.Role != workspaceOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only owners can change who owns the workspace"})
+		return
+	}
+
+	updated, err := q.SetWorkspaceMemberRole(c, queries.SetWorkspaceMemberRoleParams{
+		Role:        req.Role,
+		WorkspaceID: workspace.ID,
+		UserID:      memberID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not change role"})
+		return
+	}
+	if updated == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A workspace needs at least one owner, make someone else an owner first"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user_id": memberID, "role": req.Role})
+}
+
+// RemoveWorkspaceMemberHandler takes someone out of a workspace. Members can
+// always leave; removing others takes an admin, or an owner to remove an
+// owner. The links they made stay in the workspace.
+func RemoveWorkspaceMemberHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	workspace, ok := memberWorkspace(c, q, workspaceViewer)
+	if !ok {
+		return
+	}
+
+	memberID, memberRole, ok := memberTargetRole(c, q, workspace.ID)
+	if !ok {
+		return
+	}
+
+	leaving := memberID == userUUID
+	if !leaving {
+		min := workspaceAdmin
+		if memberRole == workspaceOwner {
+			min = workspaceOwner
+		}
+		if !workspaceRoleAtLeast(workspace.Role, min) {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("You need to be a workspace %s or above to do this", min)})
+			return
+		}
+	}
+
+	removed, err := q.RemoveWorkspaceMember(c, queries.RemoveWorkspaceMemberParams{
+		WorkspaceID: workspace.ID,
+		UserID:      memberID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not remove member"})
+		return
+	}
+	if removed == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "A workspace needs at least one owner, make someone else an owner first"})
+		return
+	}
+
+	if leaving {
+		c.JSON(http.StatusOK, gin.H{"message": "You left the workspace"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed"})
+}
+
+// ListWorkspaceInvitationsHandler lists a workspace's pending invitations
+func ListWorkspaceInvitationsHandler(c *gin.Context) {
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	workspace, ok := memberWorkspace(c, q, workspaceAdmin)
+	if !ok {
+		return
+	}
+
+	invitations, err := q.ListWorkspaceInvitations(c, workspace.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not list invitations"})
+		return
+	}
+
+	response := make([]gin.H, 0, len(invitations))
+	for _, i := range invitations {
+		response = append(response, gin.H{
+			"id":         i.ID,
+			"email":      i.Email,
+			"role":       i.Role,
+			"invited_by": i.InvitedBy,
+			"expires_at": i.ExpiresAt,
+			"created_at": i.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+type InviteWorkspaceMemberRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required"`
+}
+
+// InviteWorkspaceMemberHandler emails someone a link to join a team
+// workspace. Inviting the same address again replaces the old link. People
+// join as admin at most; an owner can promote them afterwards.
+func InviteWorkspaceMemberHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req InviteWorkspaceMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Role == workspaceOwner || !slices.Contains(workspaceRoles, req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be one of viewer, editor, admin"})
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	workspace, ok := memberWorkspace(c, q, workspaceAdmin)
+	if !ok {
+		return
+	}
+	if workspace.Personal {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Personal workspaces can't be shared, create a team workspace"})
+		return
+	}
+
+	inviter, err := q.GetUserById(c, userUUID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Could not find user"})
+		return
+	}
+
+	if invitee, err := q.GetUserByEmail(c, email); err == nil {
+		_, err := q.GetWorkspaceMemberRole(c, queries.GetWorkspaceMemberRoleParams{
+			WorkspaceID: workspace.ID,
+			UserID:      invitee.ID,
+		})
+		if err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "They're already a member of this workspace"})
+			return
+		}
+	}
+
+	token, err := randomHex(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	invitation, err := q.CreateWorkspaceInvitation(c, queries.CreateWorkspaceInvitationParams{
+		WorkspaceID: workspace.ID,
+		Email:       email,
+		Role:        req.Role,
+		TokenHash:   hashToken(token),
+		InvitedBy:   uuid.NullUUID{UUID: inviter.ID, Valid: true},
+		ExpiresAt:   time.Now().Add(workspaceInvitationTTL),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create invitation"})
+		return
+	}
+
+	frontendURL := os.Getenv("FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = "https://rvif.me"
+	}
+	link := fmt.Sprintf("%s/invitations/accept?token=%s", frontendURL, url.QueryEscape(token))
+
+	emailBody := fmt.Sprintf("%s invited you to the %s workspace on nano as %s. To join, sign in or sign up as %s and follow this link: %s<br><br>The link works for 7 days.", inviter.Username, workspace.Name, req.Role, email, link)
+	if err := mailClient.SendEmail(email, "You're invited to "+workspace.Name+" on nano", emailBody); err != nil {
+		fmt.Printf("Error sending workspace invitation email: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not send invitation email"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":         invitation.ID,
+		"email":      invitation.Email,
+		"role":       invitation.Role,
+		"expires_at": invitation.ExpiresAt,
+	})
+}
+
+// RevokeWorkspaceInvitationHandler cancels a pending invitation
+func RevokeWorkspaceInvitationHandler(c *gin.Context) {
+	invitationID, err := uuid.Parse(c.Param("invitation_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invitation ID"})
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	workspace, ok := memberWorkspace(c, q, workspaceAdmin)
+	if !ok {
+		return
+	}
+
+	deleted, err := q.DeleteWorkspaceInvitation(c, queries.DeleteWorkspaceInvitationParams{
+		ID:          invitationID,
+		WorkspaceID: workspace.ID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke invitation"})
+		return
+	}
+	if deleted == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked"})
+}
+
+type AcceptWorkspaceInvitationRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// AcceptWorkspaceInvitationHandler adds the caller to the workspace an
+// invitation is for. It has to be accepted from the account with the address
+// it was sent to; someone who's already a member keeps their role.
+func AcceptWorkspaceInvitationHandler(c *gin.Context) {
+	userUUID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req AcceptWorkspaceInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	DB := db.GetDB()
+	tx, err := DB.BeginTx(c, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	defer tx.Rollback()
+
+	q := queries.New(DB).WithTx(tx)
+
+	user, err := q.GetUserById(c, userUUID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Could not find user"})
+		return
+	}
+
+	invitation, err := q.ClaimWorkspaceInvitation(c, hashToken(req.Token))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invitation"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	// rolling back leaves the invitation for the right account
+	if !strings.EqualFold(invitation.Email, user.Email) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This invitation was sent to a different email address"})
+		return
+	}
+
+	_, err = q.AddWorkspaceMember(c, queries.AddWorkspaceMemberParams{
+		WorkspaceID: invitation.WorkspaceID,
+		UserID:      userUUID,
+		Role:        invitation.Role,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not accept invitation"})
+		return
+	}
+
+	workspace, err := q.GetMemberWorkspace(c, queries.GetMemberWorkspaceParams{
+		ID:     invitation.WorkspaceID,
+		UserID: userUUID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not accept invitation"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not accept invitation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":         workspace.ID,
+		"name":       workspace.Name,
+		"personal":   workspace.Personal,
+		"role":       workspace.Role,
+		"created_at": workspace.CreatedAt,
+	})
+}
+
+// WorkspaceAnalyticsHandler sums clicks over every link in a workspace,
+// whoever created them, with the same ?tz= and ?days= as a single link's
+// analytics
+func WorkspaceAnalyticsHandler(c *gin.Context) {
+	loc, err := viewerLocation(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid timezone"})
+		return
+	}
+
+	days, ok := historyDays(c)
+	if !ok {
+		return
+	}
+
+	DB := db.GetDB()
+	q := queries.New(DB)
+
+	workspace, ok := memberWorkspace(c, q, workspaceViewer)
+	if !ok {
+		return
+	}
+
+	totals, err := q.GetWorkspaceAnalytics(c, workspace.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not get workspace analytics"})
+		return
+	}
+
+	// today from the hourly buckets, as for a single link
+	todayClicks, err := q.GetWorkspaceClicksSince(c, queries.GetWorkspaceClicksSinceParams{
+		WorkspaceID: workspace.ID,
+		Hour:        viewerDayStart(loc).Truncate(time.Hour),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not get workspace analytics"})
+		return
+	}
+
+	buckets, err := q.GetWorkspaceDailyClicks(c, queries.GetWorkspaceDailyClicksParams{
+		WorkspaceID: workspace.ID,
+		Day:         services.UTCDay(time.Now()).AddDate(0, 0, -(days - 1)),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not get workspace analytics"})
+		return
+	}
+
+	history := make([]gin.H, 0, len(buckets))
+	for _, b := range buckets {
+		history = append(history, gin.H{
+			"day":    b.Day.Format("2006-01-02"),
+			"clicks": b.Clicks,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"workspace_id": workspace.ID,
+		"total_urls":   totals.TotalUrls,
+		"total_clicks": totals.TotalClicks,
+		"daily_clicks": todayClicks,
+		"timezone":     loc.String(),
+		"history":      history,
+	})
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/internal/db/queries"
+	"github.com/rvif/nano-url/internal/services"
+)
+
+// Digests and alerts follow workspace membership: a member sees their
+// teammates' links and stops seeing all of them, their own included, once
+// they're removed
+func TestRemovedMemberLosesWorkspaceDigestsAndAlerts(t *testing.T) {
+	q := testDB(t)
+	ctx := t.Context()
+	owner := createTestUser(t, q)
+	member := createTestUser(t, q)
+
+	workspace, err := q.CreateWorkspace(ctx, "Team "+uuid.NewString()[:8])
+	if err != nil {
+		t.Fatalf("creating workspace: %v", err)
+	}
+	for userID, role := range map[uuid.UUID]string{owner.ID: workspaceOwner, member.ID: workspaceEditor} {
+		_, err := q.AddWorkspaceMember(ctx, queries.AddWorkspaceMemberParams{
+			WorkspaceID: workspace.ID,
+			UserID:      userID,
+			Role:        role,
+		})
+		if err != nil {
+			t.Fatalf("adding member: %v", err)
+		}
+	}
+
+	inWorkspace := gin.H{"url": "https://example.com/team", "workspace_id": workspace.ID}
+	ownLink := shorten(t, newLinkRouter(member.ID), inWorkspace)
+	teammateLink := shorten(t, newLinkRouter(owner.ID), inWorkspace)
+
+	hour := time.Now().UTC().Truncate(time.Hour).Add(-2 * time.Hour)
+	err = q.AddHourlyClicks(ctx, queries.AddHourlyClicksParams{
+		UrlIds: []uuid.UUID{ownLink.ID, teammateLink.ID},
+		Hours:  []time.Time{hour, hour},
+		Clicks: []int32{3, 5},
+	})
+	if err != nil {
+		t.Fatalf("adding clicks: %v", err)
+	}
+
+	rule, err := q.CreateAlertRule(ctx, queries.CreateAlertRuleParams{
+		UserID:          member.ID,
+		UrlID:           uuid.NullUUID{UUID: teammateLink.ID, Valid: true},
+		Kind:            "no_clicks",
+		WindowHours:     1,
+		CooldownMinutes: 60,
+		NotifyEmail:     true,
+		WebhookSecret:   "secret",
+	})
+	if err != nil {
+		t.Fatalf("creating alert rule: %v", err)
+	}
+
+	start, end := hour.Add(-12*time.Hour), hour.Add(12*time.Hour)
+	// the slugs in the member's digest, their account-wide alert count and
+	// whether their alert on the teammate's link is still evaluated
+	memberSees := func() ([]string, int32, bool) {
+		t.Helper()
+
+		digest, err := services.BuildDigest(ctx, q, member.ID, "daily", start, end)
+		if err != nil {
+			t.Fatalf("building digest: %v", err)
+		}
+		var slugs []string
+		for _, link := range digest.TopLinks {
+			slugs = append(slugs, link.ShortURL)
+		}
+
+		clicks, err := q.CountHourlyClicks(ctx, queries.CountHourlyClicksParams{
+			UserID: member.ID,
+			Since:  start,
+			Until:  end,
+		})
+		if err != nil {
+			t.Fatalf("counting clicks: %v", err)
+		}
+
+		rules, err := q.ListEnabledAlertRules(ctx)
+		if err != nil {
+			t.Fatalf("listing alert rules: %v", err)
+		}
+		evaluated := slices.ContainsFunc(rules, func(r queries.ListEnabledAlertRulesRow) bool {
+			return r.ID == rule.ID
+		})
+		return slugs, clicks, evaluated
+	}
+
+	slugs, clicks, evaluated := memberSees()
+	if !slices.Contains(slugs, ownLink.ShortURL) || !slices.Contains(slugs, teammateLink.ShortURL) {
+		t.Errorf("member's digest lists %v, want both workspace links", slugs)
+	}
+	if clicks != 8 {
+		t.Errorf("member's account alert counts %d clicks, want 8", clicks)
+	}
+	if !evaluated {
+		t.Error("member's alert on a workspace link isn't evaluated")
+	}
+
+	asOwner := gin.New()
+	asOwner.Use(func(c *gin.Context) {
+		c.Set("user_id", owner.ID)
+		c.Next()
+	})
+	asOwner.DELETE("/workspaces/:workspace_id/members/:user_id", RemoveWorkspaceMemberHandler)
+	path := "/workspaces/" + workspace.ID.String() + "/members/" + member.ID.String()
+	if rec := serveJSON(t, asOwner, http.MethodDelete, path, nil); rec.Code != http.StatusOK {
+		t.Fatalf("removing member answered %d: %s", rec.Code, rec.Body.String())
+	}
+
+	slugs, clicks, evaluated = memberSees()
+	if len(slugs) != 0 {
+		t.Errorf("removed member's digest still lists %v", slugs)
+	}
+	if clicks != 0 {
+		t.Errorf("removed member's account alert still counts %d clicks", clicks)
+	}
+	if evaluated {
+		t.Error("removed member's alert on a workspace link is still evaluated")
+	}
+}
+
+// No-personal-data mode belongs to the workspace: an admin turning it on
+// scrubs and stops collecting data for links a teammate created too
+func TestWorkspacePrivacyCoversTeammatesLinks(t *testing.T) {
+	q := testDB(t)
+	ctx := t.Context()
+	admin := createTestUser(t, q)
+	editor := createTestUser(t, q)
+
+	workspace, err := q.CreateWorkspace(ctx, "Team "+uuid.NewString()[:8])
+	if err != nil {
+		t.Fatalf("creating workspace: %v", err)
+	}
+	for userID, role := range map[uuid.UUID]string{admin.ID: workspaceAdmin, editor.ID: workspaceEditor} {
+		_, err := q.AddWorkspaceMember(ctx, queries.AddWorkspaceMemberParams{
+			WorkspaceID: workspace.ID,
+			UserID:      userID,
+			Role:        role,
+		})
+		if err != nil {
+			t.Fatalf("adding member: %v", err)
+		}
+	}
+
+	link := shorten(t, newLinkRouter(editor.ID), gin.H{"url": "https://example.com/editor", "workspace_id": workspace.ID})
+	err = q.CreateURLClick(ctx, queries.CreateURLClickParams{
+		ID:        uuid.New(),
+		UrlID:     link.ID,
+		ClickedAt: time.Now(),
+		Referrer:  "news.example.com",
+		Country:   "NL",
+		Device:    "mobile",
+		Ip:        "203.0.113.0",
+	})
+	if err != nil {
+		t.Fatalf("adding click: %v", err)
+	}
+
+	privacyRouter := func(userID uuid.UUID) *gin.Engine {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set("user_id", userID)
+			c.Next()
+		})
+		router.PUT("/workspaces/:workspace_id/privacy", UpdateWorkspacePrivacyHandler)
+		return router
+	}
+	path := "/workspaces/" + workspace.ID.String() + "/privacy"
+	on := gin.H{"no_personal_data": true}
+
+	if rec := serveJSON(t, privacyRouter(editor.ID), http.MethodPut, path, on); rec.Code != http.StatusForbidden {
+		t.Fatalf("editor turning it on answered %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec := serveJSON(t, privacyRouter(admin.ID), http.MethodPut, path, on)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("admin turning it on answered %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), `"clicks_scrubbed":1`) {
+		t.Errorf("response %s, want the teammate's click scrubbed", rec.Body.String())
+	}
+
+	redirect, err := q.GetURLForRedirect(ctx, link.ShortURL)
+	if err != nil {
+		t.Fatalf("loading link: %v", err)
+	}
+	if !redirect.NoPersonalData {
+		t.Error("new clicks on the teammate's link would still keep personal data")
+	}
+}
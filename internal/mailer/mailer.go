@@ -3,6 +3,7 @@ package mailer
 import (
 	"log"
 
+	"github.com/rvif/nano-url/internal/metrics"
 	"gopkg.in/gomail.v2"
 )
 
@@ -34,9 +35,12 @@ func (m *Mailer) SendEmail(to, subject, body string) error {
 	dialer := gomail.NewDialer(m.SMTPHost, m.SMTPPort, m.Username, m.Password)
 	if err := dialer.DialAndSend(msg); err != nil {
 		log.Println("SMTP FAILED:", err)
+		metrics.MailerSends.WithLabelValues("failure").Inc()
 		return err
 	}
 
+	metrics.MailerSends.WithLabelValues("success").Inc()
+
 	log.Printf("Email sent successfully to %s", to)
 	return nil
 }
@@ -0,0 +1,15 @@
+// Package metrics declares the service's Prometheus metrics on the default
+// registry and serves them for scraping.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Handler serves everything on the default registry, the Go runtime and
+// process collectors included
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nano_http_requests_total",
+		Help: "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "nano_http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route template.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+	Redirects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nano_redirect_lookups_total",
+		Help: "Short link lookups by result: hit, miss, disabled or error.",
+	}, []string{"result"})
+	ClickWriteErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nano_click_write_errors_total",
+		Help: "Failed click writes by writer: aggregator (batched counters and click rows) or click_log (click rows written early for a conversion).",
+	}, []string{"writer"})
+	MailerSends = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nano_mailer_sends_total",
+		Help: "Emails handed to SMTP by result: success or failure.",
+	}, []string{"result"})
+	AnalyticsReconcileRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nano_analytics_reconcile_runs_total",
+		Help: "Analytics reconciliation runs by result: success or failure.",
+	}, []string{"result"})
+	RetentionDeleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nano_retention_deleted_total",
+		Help: "Click-level rows deleted by the retention purge, by kind: clicks or conversions.",
+	}, []string{"kind"})
+	AuthFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nano_auth_failures_total",
+		Help: "Failed attempts at the auth endpoints, by throttle scope.",
+	}, []string{"scope"})
+	AuthThrottled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "nano_auth_throttled_total",
+		Help: "Auth attempts refused while backing off or locked out, by throttle scope.",
+	}, []string{"scope"})
+)
+
+// GaugeFunc and CounterFunc register a metric read when scraped, for numbers
+// another component already keeps (pool stats, service state)
+func GaugeFunc(name, help string, value func() float64) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, value)
+}
+
+func CounterFunc(name, help string, value func() float64) {
+	promauto.NewCounterFunc(prometheus.CounterOpts{Name: name, Help: help}, value)
+}
+
+// RegisterDBStats exposes the connection pool numbers from sql.DB.Stats()
+func RegisterDBStats(db *sql.DB) {
+	stats := func(read func(sql.DBStats) float64) func() float64 {
+		return func() float64 { return read(db.Stats()) }
+	}
+
+	GaugeFunc("nano_db_max_open_connections", "Maximum number of open connections to the database.",
+		stats(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	GaugeFunc("nano_db_open_connections", "Established connections, in use and idle.",
+		stats(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	GaugeFunc("nano_db_in_use_connections", "Connections currently in use.",
+		stats(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	GaugeFunc("nano_db_idle_connections", "Idle connections.",
+		stats(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	CounterFunc("nano_db_wait_count_total", "Connections waited for.",
+		stats(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	CounterFunc("nano_db_wait_duration_seconds_total", "Time spent waiting for a connection.",
+		stats(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+	CounterFunc("nano_db_max_idle_closed_total", "Connections closed due to SetMaxIdleConns.",
+		stats(func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }))
+	CounterFunc("nano_db_max_lifetime_closed_total", "Connections closed due to SetConnMaxLifetime.",
+		stats(func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }))
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+	"github.com/rvif/nano-url/internal/tokens"
+)
+
+// what a user may do in the admin API: support staff can look, admins can
+// also act
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+var Roles = []string{RoleUser, RoleSupport, RoleAdmin}
+
+// AdminMiddleware guards the admin API. Operators get in with the shared
+// ADMIN_TOKEN in the X-Admin-Token header and act as admins; otherwise the
+// caller must be signed in (not with an API key) as support or admin. The
+// role is read from the database on every request, so a demotion or
+// suspension takes effect at once. The caller's role is set on the context
+// for RequireRole.
+func AdminMiddleware(tokenService *tokens.Service, adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token := c.GetHeader("X-Admin-Token"); token != "" {
+			if adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid admin token"})
+				c.Abort()
+				return
+			}
+
+			c.Set("role", RoleAdmin)
+			c.Next()
+			return
+		}
+
+		if !authenticate(c, tokenService) {
+			return
+		}
+		if _, isAPIKey := c.Get("api_key_id"); isAPIKey {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API keys can't be used for the admin API"})
+			c.Abort()
+			return
+		}
+
+		userID, _ := c.Get("user_id")
+		role, err := queries.New(db.GetDB()).GetActiveUserRole(c, userID.(uuid.UUID))
+		if err != nil && err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			c.Abort()
+			return
+		}
+		if err == sql.ErrNoRows || (role != RoleSupport && role != RoleAdmin) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			c.Abort()
+			return
+		}
+
+		c.Set("role", role)
+		c.Next()
+	}
+}
+
+// RequireRole lets callers AdminMiddleware admitted through only with one of
+// roles
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !slices.Contains(roles, c.GetString("role")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Your role can't do this"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
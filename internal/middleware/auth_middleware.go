@@ -1,84 +1,127 @@
 package middleware
 
 import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
 	"net/http"
-	"os"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 
 	"github.com/google/uuid"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+	"github.com/rvif/nano-url/internal/tokens"
 )
 
-var jwtSecret = os.Getenv("JWT_SECRET")
-
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware accepts access tokens issued by tokenService that haven't
+// been revoked, or API keys, and sets the caller's user_id (and session_id or
+// api_key_id) on the context
+func AuthMiddleware(tokenService *tokens.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
-
-		tokenStr := c.GetHeader("Authorization")
-		if tokenStr == "" {
-			redirectTo := c.Request.URL.Path
-			// TODO: integrate with frontend next?= query parameter
-			next := c.DefaultQuery("next", "")
-			if next != "" {
-				redirectTo = next
-			}
-			c.Set("redirectTo", redirectTo)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized", "redirectTo": redirectTo})
-			c.Abort()
+		if !authenticate(c, tokenService) {
 			return
 		}
+		c.Next()
+	}
+}
 
-		tokenStr = strings.TrimPrefix(tokenStr, "Bearer ")
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return []byte(jwtSecret), nil
-		})
-
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
-			return
+// authenticate identifies the caller from the Authorization header, or
+// writes a 401 and aborts
+func authenticate(c *gin.Context, tokenService *tokens.Service) bool {
+	tokenStr := c.GetHeader("Authorization")
+	if tokenStr == "" {
+		redirectTo := c.Request.URL.Path
+		// TODO: integrate with frontend next?= query parameter
+		next := c.DefaultQuery("next", "")
+		if next != "" {
+			redirectTo = next
 		}
+		c.Set("redirectTo", redirectTo)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized", "redirectTo": redirectTo})
+		c.Abort()
+		return false
+	}
 
-		// Extract the claims from the token
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
-			return
-		}
+	tokenStr = strings.TrimPrefix(tokenStr, "Bearer ")
+	if strings.HasPrefix(tokenStr, APIKeyPrefix) {
+		return authenticateAPIKey(c, tokenStr)
+	}
 
-		// JWT stores claims as map[string]interface{} (i.e., it serializes UUID as a string), so we must parse it manually
-		// Extract the user_id from the claims
-		userIDStr, exists := claims["user_id"].(string)
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
-			return
-		}
+	claims, err := tokenService.ParseAccessToken(tokenStr)
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
+		c.Abort()
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return false
+	}
 
-		// Parse the user_id string into a UUID
-		userID, err := uuid.Parse(userIDStr)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			c.Abort()
-			return
-		}
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return false
+	}
 
-		// Check if the token has expired
-		if exp, ok := claims["expiry"].(float64); ok && time.Now().Unix() > int64(exp) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
-			c.Abort()
-			return
-		}
+	// every access token carries a jti so it can be revoked before it expires
+	jti, err := uuid.Parse(claims.ID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return false
+	}
 
-		c.Set("user_id", userID)
-		c.Next()
+	revoked, err := queries.New(db.GetDB()).IsAccessTokenRevoked(c, jti)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		c.Abort()
+		return false
+	}
+	if revoked {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token revoked"})
+		c.Abort()
+		return false
+	}
+
+	c.Set("user_id", userID)
+	if sessionID, err := uuid.Parse(claims.SessionID); err == nil {
+		c.Set("session_id", sessionID)
+	}
+	return true
+}
+
+// authenticateAPIKey lets an active API key through with its scopes on the
+// context; RequireScope and RequireSession decide what it may reach
+func authenticateAPIKey(c *gin.Context, key string) bool {
+	sum := sha256.Sum256([]byte(key))
+
+	q := queries.New(db.GetDB())
+	apiKey, err := q.GetActiveAPIKeyByHash(c, hex.EncodeToString(sum[:]))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		c.Abort()
+		return false
+	}
+
+	if err := q.TouchAPIKey(c, apiKey.ID); err != nil {
+		log.Printf("Error recording use of API key %s: %v", apiKey.ID, err)
 	}
 
+	c.Set("user_id", apiKey.UserID)
+	c.Set("api_key_id", apiKey.ID)
+	c.Set("api_key_scopes", apiKey.Scopes)
+	return true
 }
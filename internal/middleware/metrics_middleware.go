@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rvif/nano-url/internal/metrics"
+)
+
+// MetricsMiddleware counts requests and records their latency, labelled by
+// the route template (/api/v1/url/:slug) rather than the raw path so slugs
+// don't blow up the number of series
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		started := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(started).Seconds())
+	}
+}
+
+// MetricsTokenMiddleware guards /metrics on the public port with a bearer
+// token, which is what Prometheus sends for `authorization: credentials`
+func MetricsTokenMiddleware(metricsToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if metricsToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(metricsToken)) != 1 {
+			c.String(http.StatusUnauthorized, "Unauthorized\n")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+)
+
+// actions an account can be kept from until its email is verified
+const (
+	ActionCreateLinks = "create_links"
+	ActionAPIKeys     = "api_keys"
+	ActionDigests     = "digests"
+	ActionAlerts      = "alerts"
+	ActionInvites     = "invites"
+)
+
+// blocked for unverified accounts unless UNVERIFIED_BLOCKED_ACTIONS says otherwise
+const DefaultUnverifiedBlocked = "create_links,api_keys,digests,alerts,invites"
+
+var unverifiedActions = []string{ActionCreateLinks, ActionAPIKeys, ActionDigests, ActionAlerts, ActionInvites}
+
+// VerifiedEmailGate keeps unverified accounts from the configured actions
+type VerifiedEmailGate struct {
+	blocked map[string]bool
+}
+
+// NewVerifiedEmailGate takes a comma-separated list of actions to block,
+// "none" to block nothing
+func NewVerifiedEmailGate(blocked string) *VerifiedEmailGate {
+	g := &VerifiedEmailGate{blocked: make(map[string]bool)}
+	for _, action := range strings.Split(blocked, ",") {
+		action = strings.TrimSpace(action)
+		if action == "" || action == "none" {
+			continue
+		}
+
+		if !slices.Contains(unverifiedActions, action) {
+			log.Printf("Ignoring unknown unverified-account action %q", action)
+			continue
+		}
+		g.blocked[action] = true
+	}
+	return g
+}
+
+// Require lets the request through if action isn't blocked or the caller's
+// email is verified. It runs after AuthMiddleware.
+func (g *VerifiedEmailGate) Require(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !g.blocked[action] {
+			c.Next()
+			return
+		}
+
+		userID, _ := c.Get("user_id")
+		userUUID, _ := userID.(uuid.UUID)
+
+		verified, err := queries.New(db.GetDB()).IsUserEmailVerified(c, userUUID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			c.Abort()
+			return
+		}
+		if !verified {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Verify your email address first", "action": action})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+	"github.com/rvif/nano-url/internal/mailer"
+)
+
+// accounts deleted per run, the rest wait for the next one
+const accountDeletionBatch = 100
+
+// AccountDeleter carries out confirmed account deletions once their grace
+// period is over. Deleting the user row takes their links, click data,
+// sessions and tokens with it (ON DELETE CASCADE); the uploaded profile
+// picture is removed from imageDir and the owner gets a last email. Links
+// they made in shared workspaces stay there, passed on to another owner.
+type AccountDeleter struct {
+	mailer    *mailer.Mailer
+	graceDays int
+	imageDir  string
+	interval  time.Duration
+	stop      chan bool
+	isRunning bool
+}
+
+func NewAccountDeleter(m *mailer.Mailer, graceDays int, imageDir string, interval time.Duration) *AccountDeleter {
+	log.Printf("Creating account deleter (%d day grace period, check every %v)", graceDays, interval)
+	return &AccountDeleter{
+		mailer:    m,
+		graceDays: graceDays,
+		imageDir:  imageDir,
+		interval:  interval,
+		stop:      make(chan bool),
+		isRunning: false,
+	}
+}
+
+func (d *AccountDeleter) Start() {
+	if d.isRunning {
+		log.Println("Account deleter is already running")
+		return
+	}
+
+	log.Println("Starting account deleter...")
+	d.isRunning = true
+
+	go func() {
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+				if _, err := d.RunNow(ctx); err != nil {
+					log.Printf("Error deleting accounts: %v", err)
+				}
+				cancel()
+			case <-d.stop:
+				log.Println("Account deleter stopped")
+				d.isRunning = false
+				return
+			}
+		}
+	}()
+}
+
+func (d *AccountDeleter) Stop() {
+	if !d.isRunning {
+		log.Println("Account deleter is not running")
+		return
+	}
+
+	log.Println("Stopping account deleter...")
+	d.stop <- true
+}
+
+func (d *AccountDeleter) IsRunning() bool {
+	return d.isRunning
+}
+
+// GracePeriod is how long a confirmed deletion can still be cancelled
+func (d *AccountDeleter) GracePeriod() time.Duration {
+	return time.Duration(d.graceDays) * 24 * time.Hour
+}
+
+// RunNow deletes the accounts whose grace period is over and returns how
+// many were deleted
+func (d *AccountDeleter) RunNow(ctx context.Context) (int, error) {
+	q := queries.New(db.GetDB())
+
+	due, err := q.ListDueAccountDeletions(ctx, accountDeletionBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, userID := range due {
+		user, heirs, err := d.deleteUser(ctx, userID)
+		if err == sql.ErrNoRows {
+			// cancelled since it was listed
+			continue
+		}
+		if err != nil {
+			log.Printf("Error deleting account %s: %v", userID, err)
+			continue
+		}
+
+		// account analytics count the links each user created
+		for heir := range heirs {
+			if _, err := q.RecomputeUserAnalytics(ctx, heir); err != nil {
+				log.Printf("Error recomputing analytics for user %s: %v", heir, err)
+			}
+		}
+
+		deleted++
+		log.Printf("Deleted account %s", userID)
+		RemoveProfilePicture(d.imageDir, user.PfpUrl)
+
+		emailBody := "Your nano account and everything in it (links, click data, sessions and API keys) has been deleted, as you asked.<br><br>Thank you for using nano."
+		if err := d.mailer.SendEmail(user.Email, "Your account has been deleted", emailBody); err != nil {
+			log.Printf("Error sending deletion notice for account %s: %v", userID, err)
+		}
+	}
+
+	return deleted, nil
+}
+
+// deleteUser hands the user's links in shared workspaces over to another
+// owner, drops the team workspaces nobody else is in and deletes the user,
+// all or nothing. It returns who got links.
+func (d *AccountDeleter) deleteUser(ctx context.Context, userID uuid.UUID) (queries.DeleteScheduledUserRow, map[uuid.UUID]bool, error) {
+	DB := db.GetDB()
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return queries.DeleteScheduledUserRow{}, nil, err
+	}
+	defer tx.Rollback()
+
+	q := queries.New(DB).WithTx(tx)
+
+	transferred, err := q.TransferSharedWorkspaceURLs(ctx, userID)
+	if err != nil {
+		return queries.DeleteScheduledUserRow{}, nil, err
+	}
+	if err := q.DeleteUnsharedWorkspaces(ctx, userID); err != nil {
+		return queries.DeleteScheduledUserRow{}, nil, err
+	}
+
+	user, err := q.DeleteScheduledUser(ctx, userID)
+	if err != nil {
+		return queries.DeleteScheduledUserRow{}, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return queries.DeleteScheduledUserRow{}, nil, err
+	}
+
+	heirs := make(map[uuid.UUID]bool)
+	for _, heir := range transferred {
+		heirs[heir] = true
+	}
+	return user, heirs, nil
+}
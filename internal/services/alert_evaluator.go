@@ -0,0 +1,260 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+	"github.com/rvif/nano-url/internal/mailer"
+)
+
+// spike rules compare the current window against the average window over this span
+const spikeBaselineWindow = 7 * 24 * time.Hour
+
+// AlertEvaluator checks users' alert rules against the hourly click buckets
+// and notifies by email and/or webhook. A rule that fires is claimed in the
+// database first, so its cooldown holds across restarts and instances.
+type AlertEvaluator struct {
+	mailer      *mailer.Mailer
+	client      *http.Client
+	frontendURL string
+	interval    time.Duration
+	stop        chan bool
+	isRunning   bool
+}
+
+// AlertNotification is the JSON body POSTed to webhooks
+type AlertNotification struct {
+	RuleID      uuid.UUID `json:"rule_id"`
+	Kind        string    `json:"kind"`
+	ShortURL    string    `json:"short_url,omitempty"`
+	Clicks      int32     `json:"clicks"`
+	Threshold   float64   `json:"threshold"`
+	Baseline    float64   `json:"baseline,omitempty"`
+	WindowHours int32     `json:"window_hours"`
+	TriggeredAt time.Time `json:"triggered_at"`
+	Message     string    `json:"message"`
+}
+
+func NewAlertEvaluator(m *mailer.Mailer, frontendURL string, interval time.Duration) *AlertEvaluator {
+	log.Println("Creating alert evaluator, checking every", interval)
+	return &AlertEvaluator{
+		mailer:      m,
+		client:      newWebhookClient(10 * time.Second),
+		frontendURL: frontendURL,
+		interval:    interval,
+		stop:        make(chan bool),
+		isRunning:   false,
+	}
+}
+
+func (e *AlertEvaluator) Start() {
+	if e.isRunning {
+		log.Println("Alert evaluator is already running")
+		return
+	}
+
+	log.Println("Starting alert evaluator...")
+	e.isRunning = true
+
+	go func() {
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				e.evaluateAll()
+			case <-e.stop:
+				log.Println("Alert evaluator stopped")
+				e.isRunning = false
+				return
+			}
+		}
+	}()
+}
+
+func (e *AlertEvaluator) Stop() {
+	if !e.isRunning {
+		log.Println("Alert evaluator is not running")
+		return
+	}
+
+	log.Println("Stopping alert evaluator...")
+	e.stop <- true
+}
+
+func (e *AlertEvaluator) IsRunning() bool {
+	return e.isRunning
+}
+
+func (e *AlertEvaluator) evaluateAll() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	q := queries.New(db.GetDB())
+
+	rules, err := q.ListEnabledAlertRules(ctx)
+	if err != nil {
+		log.Printf("Error listing alert rules: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, rule := range rules {
+		// cheap pre-check, ClaimAlertTrigger is the one that counts
+		if rule.LastTriggeredAt.Valid && now.Sub(rule.LastTriggeredAt.Time) < time.Duration(rule.CooldownMinutes)*time.Minute {
+			continue
+		}
+
+		notification, fired, err := evaluateRule(ctx, q, rule, now)
+		if err != nil {
+			log.Printf("Error evaluating alert rule %s: %v", rule.ID, err)
+			continue
+		}
+		if !fired {
+			continue
+		}
+
+		claimed, err := q.ClaimAlertTrigger(ctx, rule.ID)
+		if err != nil {
+			log.Printf("Error claiming alert rule %s: %v", rule.ID, err)
+			continue
+		}
+		if claimed == 0 {
+			continue
+		}
+
+		log.Printf("Alert rule %s fired: %s", rule.ID, notification.Message)
+		e.notify(ctx, rule, notification)
+	}
+}
+
+func evaluateRule(ctx context.Context, q *queries.Queries, rule queries.ListEnabledAlertRulesRow, now time.Time) (AlertNotification, bool, error) {
+	window := time.Duration(rule.WindowHours) * time.Hour
+	// hour buckets: the current (partial) hour plus the full hours before it
+	since := now.UTC().Truncate(time.Hour).Add(-window + time.Hour)
+
+	target := "your account"
+	if rule.ShortUrl.Valid {
+		target = "/" + rule.ShortUrl.String
+	}
+
+	notification := AlertNotification{
+		RuleID:      rule.ID,
+		Kind:        rule.Kind,
+		ShortURL:    rule.ShortUrl.String,
+		Threshold:   rule.Threshold,
+		WindowHours: rule.WindowHours,
+		TriggeredAt: now,
+	}
+
+	clicks, err := q.CountHourlyClicks(ctx, queries.CountHourlyClicksParams{
+		UserID: rule.UserID,
+		UrlID:  rule.UrlID,
+		Since:  since,
+		Until:  now.Add(time.Hour),
+	})
+	if err != nil {
+		return notification, false, err
+	}
+	notification.Clicks = clicks
+
+	switch rule.Kind {
+	case "threshold":
+		notification.Message = fmt.Sprintf("%s got %d clicks in the last %d hour(s), above your limit of %.0f",
+			target, clicks, rule.WindowHours, rule.Threshold)
+		return notification, float64(clicks) > rule.Threshold, nil
+
+	case "no_clicks":
+		// a rule or link younger than the window can't have been quiet for all of it
+		watchedSince := rule.CreatedAt
+		if rule.UrlCreatedAt.Valid && rule.UrlCreatedAt.Time.After(watchedSince) {
+			watchedSince = rule.UrlCreatedAt.Time
+		}
+		if now.Sub(watchedSince) < window {
+			return notification, false, nil
+		}
+
+		notification.Message = fmt.Sprintf("%s has had no clicks in the last %d hour(s)", target, rule.WindowHours)
+		return notification, clicks == 0, nil
+
+	case "spike":
+		trailing, err := q.CountHourlyClicks(ctx, queries.CountHourlyClicksParams{
+			UserID: rule.UserID,
+			UrlID:  rule.UrlID,
+			Since:  since.Add(-spikeBaselineWindow),
+			Until:  since,
+		})
+		if err != nil {
+			return notification, false, err
+		}
+
+		baseline := float64(trailing) / (float64(spikeBaselineWindow) / float64(window))
+		notification.Baseline = baseline
+
+		// with no history any click would be an infinite spike, treat the baseline as at least 1
+		notification.Message = fmt.Sprintf("%s got %d clicks in the last %d hour(s), %.1fx its trailing average of %.1f",
+			target, clicks, rule.WindowHours, float64(clicks)/max(baseline, 1), baseline)
+		return notification, float64(clicks) >= rule.Threshold*max(baseline, 1), nil
+	}
+
+	return notification, false, fmt.Errorf("unknown alert kind %q", rule.Kind)
+}
+
+func (e *AlertEvaluator) notify(ctx context.Context, rule queries.ListEnabledAlertRulesRow, notification AlertNotification) {
+	if rule.NotifyEmail {
+		body := fmt.Sprintf(`<p><b>nano alert:</b> %s</p><p><a href="%s/my-links">Open your links</a></p>`,
+			html.EscapeString(notification.Message), e.frontendURL)
+		if err := e.mailer.SendEmail(rule.Email, "nano alert: "+notification.Message, body); err != nil {
+			log.Printf("Error emailing alert %s: %v", rule.ID, err)
+		}
+	}
+
+	if rule.WebhookUrl.Valid && rule.WebhookUrl.String != "" {
+		if err := e.postWebhook(ctx, rule.WebhookUrl.String, rule.WebhookSecret, notification); err != nil {
+			log.Printf("Error delivering alert %s webhook: %v", rule.ID, err)
+		}
+	}
+}
+
+// postWebhook signs the body with the rule's secret so receivers can verify
+// it came from us: X-Nano-Signature: sha256=<hex hmac>
+func (e *AlertEvaluator) postWebhook(ctx context.Context, url, secret string, notification AlertNotification) error {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Nano-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+	"github.com/rvif/nano-url/internal/metrics"
+)
+
+// AnalyticsReconciler periodically rebuilds user_analytics from urls so the
+// derived counters can never drift from the links they describe
+type AnalyticsReconciler struct {
+	interval  time.Duration
+	stop      chan bool
+	isRunning bool
+
+	mu      sync.Mutex
+	lastRun ReconcileRun
+}
+
+type ReconcileRun struct {
+	At       time.Time     `json:"at"`
+	Users    int64         `json:"users"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+func NewAnalyticsReconciler(interval time.Duration) *AnalyticsReconciler {
+	log.Println("Creating analytics reconciler, interval:", interval)
+	return &AnalyticsReconciler{
+		interval:  interval,
+		stop:      make(chan bool),
+		isRunning: false,
+	}
+}
+
+func (r *AnalyticsReconciler) Start() {
+	if r.isRunning {
+		log.Println("Analytics reconciler is already running")
+		return
+	}
+
+	log.Println("Starting analytics reconciler...")
+	r.isRunning = true
+
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.reconcile()
+			case <-r.stop:
+				log.Println("Analytics reconciler stopped")
+				r.isRunning = false
+				return
+			}
+		}
+	}()
+}
+
+func (r *AnalyticsReconciler) Stop() {
+	if !r.isRunning {
+		log.Println("Analytics reconciler is not running")
+		return
+	}
+
+	log.Println("Stopping analytics reconciler...")
+	r.stop <- true
+}
+
+func (r *AnalyticsReconciler) IsRunning() bool {
+	return r.isRunning
+}
+
+func (r *AnalyticsReconciler) LastRun() ReconcileRun {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastRun
+}
+
+func (r *AnalyticsReconciler) reconcile() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	maxRetries := 3
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		_, err := r.RunNow(ctx)
+		if err == nil {
+			return
+		}
+
+		log.Printf("Error reconciling user analytics (attempt %d/%d): %v",
+			attempt, maxRetries, err)
+
+		if attempt < maxRetries {
+			time.Sleep(5 * time.Second)
+		}
+	}
+
+	log.Printf("Failed to reconcile user analytics after %d attempts", maxRetries)
+}
+
+// RunNow rebuilds the analytics row of every user and returns how many rows
+// were written
+func (r *AnalyticsReconciler) RunNow(ctx context.Context) (int64, error) {
+	started := time.Now()
+
+	q := queries.New(db.GetDB())
+	users, err := q.RecomputeAllUserAnalytics(ctx)
+
+	run := ReconcileRun{
+		At:       started,
+		Users:    users,
+		Duration: time.Since(started),
+	}
+	if err != nil {
+		run.Error = err.Error()
+		metrics.AnalyticsReconcileRuns.WithLabelValues("failure").Inc()
+	} else {
+		metrics.AnalyticsReconcileRuns.WithLabelValues("success").Inc()
+		log.Printf("Reconciled analytics for %d users in %v", users, run.Duration.Round(time.Millisecond))
+	}
+
+	r.mu.Lock()
+	r.lastRun = run
+	r.mu.Unlock()
+
+	return users, err
+}
+
+// RegisterMetrics exposes the outcome of the most recent run
+func (r *AnalyticsReconciler) RegisterMetrics() {
+	metrics.GaugeFunc("nano_analytics_reconcile_last_run_timestamp_seconds", "Unix time the last reconciliation started, 0 before the first run.",
+		func() float64 {
+			if at := r.LastRun().At; !at.IsZero() {
+				return float64(at.Unix())
+			}
+			return 0
+		})
+	metrics.GaugeFunc("nano_analytics_reconcile_last_run_success", "1 if the last reconciliation succeeded, 0 if it failed.",
+		func() float64 {
+			if r.LastRun().Error != "" {
+				return 0
+			}
+			return 1
+		})
+	metrics.GaugeFunc("nano_analytics_reconcile_last_run_users", "Users rebuilt by the last reconciliation.",
+		func() float64 { return float64(r.LastRun().Users) })
+	metrics.GaugeFunc("nano_analytics_reconcile_last_run_duration_seconds", "How long the last reconciliation took.",
+		func() float64 { return r.LastRun().Duration.Seconds() })
+}
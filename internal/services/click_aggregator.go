@@ -0,0 +1,402 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+	"github.com/rvif/nano-url/internal/metrics"
+)
+
+// ClickAggregator buffers redirect clicks in memory and writes them to the
+// database in batches, so the redirect path never waits on a write
+type ClickAggregator struct {
+	interval   time.Duration
+	maxPending int
+
+	mu     sync.Mutex
+	links  map[uuid.UUID]*linkClicks
+	days   map[bucketKey]int32
+	hours  map[bucketKey]int32
+	owners map[uuid.UUID]struct{}
+	// raw rows for clicks on conversion-tracked links, by click ID, and the
+	// ones in the flush under way
+	clicks  map[uuid.UUID]queries.CreateURLClickParams
+	writing map[uuid.UUID]queries.CreateURLClickParams
+
+	stop      chan struct{}
+	done      chan struct{}
+	isRunning bool
+
+	recorded    atomic.Uint64
+	dropped     atomic.Uint64
+	flushed     atomic.Uint64
+	flushErrors atomic.Uint64
+}
+
+type linkClicks struct {
+	clicks      int32
+	lastClicked time.Time
+}
+
+// a link's UTC day or UTC hour
+type bucketKey struct {
+	urlID uuid.UUID
+	start time.Time
+}
+
+type ClickAggregatorStats struct {
+	Recorded    uint64 `json:"recorded"`
+	Dropped     uint64 `json:"dropped"`
+	Flushed     uint64 `json:"flushed"`
+	FlushErrors uint64 `json:"flush_errors"`
+	Pending     int    `json:"pending"`
+}
+
+// maxPending caps the number of distinct (link, hour) buckets held between
+// flushes; clicks for a new bucket past that cap are dropped and counted
+func NewClickAggregator(interval time.Duration, maxPending int) *ClickAggregator {
+	log.Printf("Creating click aggregator (flush every %v, max %d pending buckets)", interval, maxPending)
+	return &ClickAggregator{
+		interval:   interval,
+		maxPending: maxPending,
+		links:      make(map[uuid.UUID]*linkClicks),
+		days:       make(map[bucketKey]int32),
+		hours:      make(map[bucketKey]int32),
+		owners:     make(map[uuid.UUID]struct{}),
+		clicks:     make(map[uuid.UUID]queries.CreateURLClickParams),
+		writing:    make(map[uuid.UUID]queries.CreateURLClickParams),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+func (a *ClickAggregator) Start() {
+	if a.isRunning {
+		log.Println("Click aggregator is already running")
+		return
+	}
+
+	log.Println("Starting click aggregator...")
+	a.isRunning = true
+
+	go func() {
+		defer close(a.done)
+
+		ticker := time.NewTicker(a.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				a.Flush(context.Background())
+			case <-a.stop:
+				log.Println("Click aggregator stopping, flushing pending clicks...")
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				a.Flush(ctx)
+				cancel()
+				a.isRunning = false
+				return
+			}
+		}
+	}()
+}
+
+// Stop flushes whatever is still buffered and waits for the write to finish
+func (a *ClickAggregator) Stop() {
+	if !a.isRunning {
+		log.Println("Click aggregator is not running")
+		return
+	}
+
+	close(a.stop)
+	<-a.done
+	log.Println("Click aggregator stopped")
+}
+
+func (a *ClickAggregator) IsRunning() bool {
+	return a.isRunning
+}
+
+// Record counts one click for a link and its owner. It never blocks on the
+// database and returns false if the click had to be dropped.
+func (a *ClickAggregator) Record(urlID, ownerID uuid.UUID, at time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.add(urlID, ownerID, at, 1) {
+		a.dropped.Add(1)
+		return false
+	}
+
+	a.recorded.Add(1)
+	return true
+}
+
+// RecordTracked is Record for a link with conversion tracking on, which also
+// keeps the click's own row so conversions can refer to its ID
+func (a *ClickAggregator) RecordTracked(ownerID uuid.UUID, click queries.CreateURLClickParams) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.clicks) >= a.maxPending || !a.add(click.UrlID, ownerID, click.ClickedAt, 1) {
+		a.dropped.Add(1)
+		return false
+	}
+	a.clicks[click.ID] = click
+
+	a.recorded.Add(1)
+	return true
+}
+
+// PendingClick returns a tracked click that hasn't been written yet, so a
+// conversion arriving before the next flush can write it first
+func (a *ClickAggregator) PendingClick(clickID uuid.UUID) (queries.CreateURLClickParams, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if click, ok := a.clicks[clickID]; ok {
+		return click, true
+	}
+	click, ok := a.writing[clickID]
+	return click, ok
+}
+
+// add must be called with mu held
+func (a *ClickAggregator) add(urlID, ownerID uuid.UUID, at time.Time, clicks int32) bool {
+	// there are never fewer hour buckets than day buckets, so bounding hours bounds both
+	hour := bucketKey{urlID: urlID, start: at.UTC().Truncate(time.Hour)}
+	if _, ok := a.hours[hour]; !ok && len(a.hours) >= a.maxPending {
+		return false
+	}
+	a.hours[hour] += clicks
+	a.days[bucketKey{urlID: urlID, start: UTCDay(at)}] += clicks
+
+	link, ok := a.links[urlID]
+	if !ok {
+		link = &linkClicks{}
+		a.links[urlID] = link
+	}
+	link.clicks += clicks
+	if at.After(link.lastClicked) {
+		link.lastClicked = at
+	}
+
+	a.owners[ownerID] = struct{}{}
+	return true
+}
+
+// Flush writes all buffered clicks in a single transaction. If the database
+// was unavailable the batch is merged back into the buffer so it is retried on
+// the next tick; a batch the database rejected would fail the same way every
+// time, so it is dropped instead of holding up the clicks after it.
+func (a *ClickAggregator) Flush(ctx context.Context) {
+	a.mu.Lock()
+	links, days, hours, owners, clicks := a.links, a.days, a.hours, a.owners, a.clicks
+	a.links = make(map[uuid.UUID]*linkClicks)
+	a.days = make(map[bucketKey]int32)
+	a.hours = make(map[bucketKey]int32)
+	a.owners = make(map[uuid.UUID]struct{})
+	a.clicks = make(map[uuid.UUID]queries.CreateURLClickParams)
+	a.writing = clicks
+	a.mu.Unlock()
+
+	if len(days) == 0 {
+		return
+	}
+
+	total, err := a.write(ctx, links, days, hours, owners, clicks)
+
+	a.mu.Lock()
+	a.writing = make(map[uuid.UUID]queries.CreateURLClickParams)
+	a.mu.Unlock()
+
+	if err != nil {
+		a.flushErrors.Add(1)
+		metrics.ClickWriteErrors.WithLabelValues("aggregator").Inc()
+		if !transientDBError(err) {
+			a.dropped.Add(uint64(total))
+			log.Printf("Dropped %d buffered clicks the database rejected: %v", total, err)
+			return
+		}
+		log.Printf("Error flushing %d buffered clicks, retrying next tick: %v", total, err)
+		a.requeue(links, days, hours, owners, clicks)
+		return
+	}
+
+	a.flushed.Add(uint64(total))
+	log.Printf("Flushed %d clicks across %d links", total, len(links))
+}
+
+func (a *ClickAggregator) write(ctx context.Context, links map[uuid.UUID]*linkClicks, days, hours map[bucketKey]int32, owners map[uuid.UUID]struct{}, clicks map[uuid.UUID]queries.CreateURLClickParams) (int32, error) {
+	var total int32
+
+	linkParams := queries.AddURLClicksParams{}
+	for urlID, link := range links {
+		linkParams.UrlIds = append(linkParams.UrlIds, urlID)
+		linkParams.Clicks = append(linkParams.Clicks, link.clicks)
+		linkParams.LastClicked = append(linkParams.LastClicked, link.lastClicked)
+		total += link.clicks
+	}
+
+	dayParams := queries.AddDailyClicksParams{}
+	for key, clicks := range days {
+		dayParams.UrlIds = append(dayParams.UrlIds, key.urlID)
+		dayParams.Days = append(dayParams.Days, key.start)
+		dayParams.Clicks = append(dayParams.Clicks, clicks)
+	}
+
+	hourParams := queries.AddHourlyClicksParams{}
+	for key, clicks := range hours {
+		hourParams.UrlIds = append(hourParams.UrlIds, key.urlID)
+		hourParams.Hours = append(hourParams.Hours, key.start)
+		hourParams.Clicks = append(hourParams.Clicks, clicks)
+	}
+
+	clickParams := queries.CreateURLClicksParams{}
+	for _, click := range clicks {
+		clickParams.Ids = append(clickParams.Ids, click.ID)
+		clickParams.UrlIds = append(clickParams.UrlIds, click.UrlID)
+		clickParams.ClickedAt = append(clickParams.ClickedAt, click.ClickedAt)
+		clickParams.Referrers = append(clickParams.Referrers, click.Referrer)
+		clickParams.Variants = append(clickParams.Variants, click.Variant)
+		clickParams.Countries = append(clickParams.Countries, click.Country)
+		clickParams.Devices = append(clickParams.Devices, click.Device)
+		clickParams.Ips = append(clickParams.Ips, click.Ip)
+	}
+
+	DB := db.GetDB()
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return total, err
+	}
+	defer tx.Rollback()
+
+	q := queries.New(DB).WithTx(tx)
+
+	if err := q.AddURLClicks(ctx, linkParams); err != nil {
+		return total, err
+	}
+
+	if err := q.AddDailyClicks(ctx, dayParams); err != nil {
+		return total, err
+	}
+
+	if err := q.AddHourlyClicks(ctx, hourParams); err != nil {
+		return total, err
+	}
+
+	if len(clicks) > 0 {
+		if err := q.CreateURLClicks(ctx, clickParams); err != nil {
+			return total, err
+		}
+	}
+
+	// account analytics are derived from urls, rebuild them for every owner touched
+	for ownerID := range owners {
+		if _, err := q.RecomputeUserAnalytics(ctx, ownerID); err != nil && err != sql.ErrNoRows {
+			return total, err
+		}
+	}
+
+	return total, tx.Commit()
+}
+
+func (a *ClickAggregator) requeue(links map[uuid.UUID]*linkClicks, days, hours map[bucketKey]int32, owners map[uuid.UUID]struct{}, clicks map[uuid.UUID]queries.CreateURLClickParams) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var lost int32
+	for key, clicks := range hours {
+		if _, ok := a.hours[key]; !ok && len(a.hours) >= a.maxPending {
+			lost += clicks
+			continue
+		}
+		a.hours[key] += clicks
+	}
+	for key, clicks := range days {
+		a.days[key] += clicks
+	}
+	for urlID, link := range links {
+		existing, ok := a.links[urlID]
+		if !ok {
+			a.links[urlID] = link
+			continue
+		}
+		existing.clicks += link.clicks
+		if link.lastClicked.After(existing.lastClicked) {
+			existing.lastClicked = link.lastClicked
+		}
+	}
+	for ownerID := range owners {
+		a.owners[ownerID] = struct{}{}
+	}
+	for clickID, click := range clicks {
+		a.clicks[clickID] = click
+	}
+
+	if lost > 0 {
+		a.dropped.Add(uint64(lost))
+		log.Printf("Dropped %d clicks while requeueing a failed flush (buffer full)", lost)
+	}
+}
+
+func (a *ClickAggregator) Stats() ClickAggregatorStats {
+	a.mu.Lock()
+	pending := len(a.hours)
+	a.mu.Unlock()
+
+	return ClickAggregatorStats{
+		Recorded:    a.recorded.Load(),
+		Dropped:     a.dropped.Load(),
+		Flushed:     a.flushed.Load(),
+		FlushErrors: a.flushErrors.Load(),
+		Pending:     pending,
+	}
+}
+
+// transientDBError reports whether a failed write may succeed if tried again:
+// anything short of an error from Postgres itself (a lost connection, a
+// timeout), or one of the error classes for conflicts and unavailability
+func transientDBError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return true
+	}
+	switch pqErr.Code.Class() {
+	case "08", // connection exception
+		"40", // transaction rollback: serialization failure, deadlock
+		"53", // insufficient resources
+		"57", // operator intervention: shutdown, query canceled
+		"58": // system error
+		return true
+	}
+	return false
+}
+
+// UTCDay is the daily click bucket t falls in: its UTC calendar date, at
+// midnight UTC. Local days are counted from the hourly buckets instead.
+func UTCDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// RegisterMetrics exposes the aggregator's counters and buffer size
+func (a *ClickAggregator) RegisterMetrics() {
+	metrics.CounterFunc("nano_click_aggregator_recorded_total", "Clicks accepted into the buffer.",
+		func() float64 { return float64(a.Stats().Recorded) })
+	metrics.CounterFunc("nano_click_aggregator_dropped_total", "Clicks dropped because the buffer was full.",
+		func() float64 { return float64(a.Stats().Dropped) })
+	metrics.CounterFunc("nano_click_aggregator_flushed_total", "Clicks written to the database.",
+		func() float64 { return float64(a.Stats().Flushed) })
+	metrics.GaugeFunc("nano_click_aggregator_pending_buckets", "Link-hour buckets waiting for the next flush.",
+		func() float64 { return float64(a.Stats().Pending) })
+}
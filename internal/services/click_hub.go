@@ -0,0 +1,153 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/internal/metrics"
+)
+
+// ClickEvent is what the live dashboards receive for every counted redirect
+type ClickEvent struct {
+	URLID       uuid.UUID `json:"url_id"`
+	WorkspaceID uuid.UUID `json:"-"`
+	Slug        string    `json:"short_url"`
+	Timestamp   time.Time `json:"timestamp"`
+	Country     string    `json:"country"`
+	Referrer    string    `json:"referrer"`
+	Device      string    `json:"device"`
+}
+
+// ClickHub is an in-process pub/sub for click events. Publishing never blocks:
+// each subscriber has its own buffer and events are dropped (and counted) for
+// subscribers that fall behind.
+type ClickHub struct {
+	bufferSize int
+
+	mu     sync.RWMutex
+	subs   map[*ClickSubscription]struct{}
+	closed bool
+
+	published atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+type ClickSubscription struct {
+	C <-chan ClickEvent
+
+	ch         chan ClickEvent
+	workspaces map[uuid.UUID]bool // guarded by the hub's mu
+	urlID      uuid.NullUUID
+	dropped    atomic.Uint64
+}
+
+func NewClickHub(bufferSize int) *ClickHub {
+	log.Printf("Creating click hub (buffer %d events per subscriber)", bufferSize)
+	return &ClickHub{
+		bufferSize: bufferSize,
+		subs:       make(map[*ClickSubscription]struct{}),
+	}
+}
+
+// Subscribe registers for clicks on the links in these workspaces, optionally
+// narrowed to one link. Callers must Unsubscribe when the connection goes away.
+func (h *ClickHub) Subscribe(workspaceIDs []uuid.UUID, urlID uuid.NullUUID) *ClickSubscription {
+	ch := make(chan ClickEvent, h.bufferSize)
+	sub := &ClickSubscription{C: ch, ch: ch, workspaces: workspaceSet(workspaceIDs), urlID: urlID}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(ch)
+		return sub
+	}
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+// Rescope swaps the workspaces a subscription receives clicks from, for when
+// the subscriber joins or leaves one
+func (h *ClickHub) Rescope(sub *ClickSubscription, workspaceIDs []uuid.UUID) {
+	workspaces := workspaceSet(workspaceIDs)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sub.workspaces = workspaces
+}
+
+func workspaceSet(workspaceIDs []uuid.UUID) map[uuid.UUID]bool {
+	set := make(map[uuid.UUID]bool, len(workspaceIDs))
+	for _, id := range workspaceIDs {
+		set[id] = true
+	}
+	return set
+}
+
+func (h *ClickHub) Unsubscribe(sub *ClickSubscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.ch)
+	}
+}
+
+func (h *ClickHub) Publish(event ClickEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	h.published.Add(1)
+	for sub := range h.subs {
+		if !sub.workspaces[event.WorkspaceID] {
+			continue
+		}
+		if sub.urlID.Valid && sub.urlID.UUID != event.URLID {
+			continue
+		}
+
+		select {
+		case sub.ch <- event:
+		default:
+			sub.dropped.Add(1)
+			h.dropped.Add(1)
+		}
+	}
+}
+
+// Close ends every subscription, used on shutdown so open streams return
+func (h *ClickHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+	h.closed = true
+	for sub := range h.subs {
+		delete(h.subs, sub)
+		close(sub.ch)
+	}
+	log.Println("Click hub closed")
+}
+
+func (h *ClickHub) Subscribers() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subs)
+}
+
+// Dropped reports how many events this subscriber missed by falling behind
+func (s *ClickSubscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// RegisterMetrics exposes the number of open live streams
+func (h *ClickHub) RegisterMetrics() {
+	metrics.GaugeFunc("nano_live_subscribers", "Open live click streams.",
+		func() float64 { return float64(h.Subscribers()) })
+}
@@ -0,0 +1,320 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"html/template"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+	"github.com/rvif/nano-url/internal/mailer"
+)
+
+// digests go out at this local hour once their period has closed
+const digestSendHour = 8
+
+// how many links the top/movers sections list
+const digestListSize = 5
+
+// DigestScheduler emails opt-in daily/weekly analytics digests. Each
+// subscription is claimed in the database before sending, so a restart or a
+// second instance never sends the same period twice.
+type DigestScheduler struct {
+	mailer      *mailer.Mailer
+	apiURL      string
+	frontendURL string
+	interval    time.Duration
+	stop        chan bool
+	isRunning   bool
+}
+
+type DigestLink struct {
+	ShortURL       string
+	URL            string
+	Clicks         int32
+	PreviousClicks int32
+	Change         int32
+}
+
+type Digest struct {
+	Username       string
+	Frequency      string
+	PeriodStart    time.Time
+	PeriodEnd      time.Time
+	TotalClicks    int32
+	PreviousClicks int32
+	TopLinks       []DigestLink
+	Movers         []DigestLink
+	NewLinks       []DigestLink
+	DashboardURL   string
+	UnsubscribeURL string
+}
+
+// apiURL is the public base of this API (unsubscribe links point at it),
+// frontendURL the dashboard linked from the digest
+func NewDigestScheduler(m *mailer.Mailer, apiURL, frontendURL string, interval time.Duration) *DigestScheduler {
+	log.Println("Creating digest scheduler, checking every", interval)
+	return &DigestScheduler{
+		mailer:      m,
+		apiURL:      apiURL,
+		frontendURL: frontendURL,
+		interval:    interval,
+		stop:        make(chan bool),
+		isRunning:   false,
+	}
+}
+
+func (s *DigestScheduler) Start() {
+	if s.isRunning {
+		log.Println("Digest scheduler is already running")
+		return
+	}
+
+	log.Println("Starting digest scheduler...")
+	s.isRunning = true
+
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.sendDueDigests()
+			case <-s.stop:
+				log.Println("Digest scheduler stopped")
+				s.isRunning = false
+				return
+			}
+		}
+	}()
+}
+
+func (s *DigestScheduler) Stop() {
+	if !s.isRunning {
+		log.Println("Digest scheduler is not running")
+		return
+	}
+
+	log.Println("Stopping digest scheduler...")
+	s.stop <- true
+}
+
+func (s *DigestScheduler) IsRunning() bool {
+	return s.isRunning
+}
+
+func (s *DigestScheduler) sendDueDigests() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	q := queries.New(db.GetDB())
+
+	subs, err := q.ListDigestSubscriptions(ctx)
+	if err != nil {
+		log.Printf("Error listing digest subscriptions: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, sub := range subs {
+		if err := s.sendIfDue(ctx, q, sub, now); err != nil {
+			log.Printf("Error sending %s digest %s to %s: %v", sub.Frequency, sub.ID, sub.Email, err)
+		}
+	}
+}
+
+func (s *DigestScheduler) sendIfDue(ctx context.Context, q *queries.Queries, sub queries.ListDigestSubscriptionsRow, now time.Time) error {
+	loc, err := time.LoadLocation(sub.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	start, end := LastDigestPeriod(sub.Frequency, now.In(loc))
+	if now.Before(end.Add(digestSendHour * time.Hour)) {
+		return nil
+	}
+	if sub.LastSentAt.Valid && !sub.LastSentAt.Time.Before(end) {
+		return nil
+	}
+
+	// claim the period first, only one sender wins
+	claimed, err := q.ClaimDigest(ctx, queries.ClaimDigestParams{
+		ID:         sub.ID,
+		LastSentAt: sql.NullTime{Time: end, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+	if claimed == 0 {
+		return nil
+	}
+
+	err = s.send(ctx, q, sub, start, end)
+	if err != nil {
+		// hand the period back so the next tick retries it
+		if releaseErr := q.ReleaseDigest(ctx, queries.ReleaseDigestParams{
+			ID:         sub.ID,
+			LastSentAt: sub.LastSentAt,
+		}); releaseErr != nil {
+			log.Printf("Error releasing digest %s: %v", sub.ID, releaseErr)
+		}
+		return err
+	}
+
+	log.Printf("Sent %s digest for %s to %s", sub.Frequency, start.Format("2006-01-02"), sub.Email)
+	return nil
+}
+
+func (s *DigestScheduler) send(ctx context.Context, q *queries.Queries, sub queries.ListDigestSubscriptionsRow, start, end time.Time) error {
+	digest, err := BuildDigest(ctx, q, sub.UserID, sub.Frequency, start, end)
+	if err != nil {
+		return err
+	}
+
+	digest.Username = sub.Username
+	digest.DashboardURL = s.frontendURL + "/analytics"
+	digest.UnsubscribeURL = fmt.Sprintf("%s/digests/unsubscribe?token=%s", s.apiURL, sub.UnsubscribeToken)
+
+	body, err := RenderDigest(digest)
+	if err != nil {
+		return err
+	}
+
+	subject := fmt.Sprintf("Your nano %s digest: %d clicks", sub.Frequency, digest.TotalClicks)
+	return s.mailer.SendEmail(sub.Email, subject, body)
+}
+
+// LastDigestPeriod returns the most recently completed period in now's
+// location: yesterday for daily digests, last Monday–Sunday for weekly ones
+func LastDigestPeriod(frequency string, now time.Time) (time.Time, time.Time) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	if frequency == "weekly" {
+		sinceMonday := (int(today.Weekday()) + 6) % 7
+		end := today.AddDate(0, 0, -sinceMonday)
+		return end.AddDate(0, 0, -7), end
+	}
+
+	return today.AddDate(0, 0, -1), today
+}
+
+// BuildDigest collects the numbers for [start, end) along with the period
+// right before it, which the movers section compares against
+func BuildDigest(ctx context.Context, q *queries.Queries, userID uuid.UUID, frequency string, start, end time.Time) (*Digest, error) {
+	periodDays := int(end.Sub(start).Hours()/24 + 0.5)
+
+	// start and end are local midnights; hourly buckets are whole UTC hours,
+	// so half-hour zones count from the hour their midnight falls in
+	links, err := q.GetDigestLinkClicks(ctx, queries.GetDigestLinkClicksParams{
+		PeriodStart:   start.Truncate(time.Hour),
+		PreviousStart: start.AddDate(0, 0, -periodDays).Truncate(time.Hour),
+		PeriodEnd:     end.Truncate(time.Hour),
+		UserID:        userID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	digest := &Digest{
+		Frequency:   frequency,
+		PeriodStart: start,
+		PeriodEnd:   end.AddDate(0, 0, -1),
+	}
+
+	var movers []DigestLink
+	for _, link := range links {
+		entry := DigestLink{
+			ShortURL:       link.ShortUrl,
+			URL:            link.Url,
+			Clicks:         link.Clicks,
+			PreviousClicks: link.PreviousClicks,
+			Change:         link.Clicks - link.PreviousClicks,
+		}
+
+		digest.TotalClicks += link.Clicks
+		digest.PreviousClicks += link.PreviousClicks
+
+		// rows come back ordered by clicks
+		if link.Clicks > 0 && len(digest.TopLinks) < digestListSize {
+			digest.TopLinks = append(digest.TopLinks, entry)
+		}
+		if entry.Change != 0 {
+			movers = append(movers, entry)
+		}
+		if link.CreatedAt.Valid && !link.CreatedAt.Time.Before(start) && link.CreatedAt.Time.Before(end) {
+			digest.NewLinks = append(digest.NewLinks, entry)
+		}
+	}
+
+	sort.Slice(movers, func(i, j int) bool {
+		return abs32(movers[i].Change) > abs32(movers[j].Change)
+	})
+	if len(movers) > digestListSize {
+		movers = movers[:digestListSize]
+	}
+	digest.Movers = movers
+
+	return digest, nil
+}
+
+var digestTemplate = template.Must(template.New("digest").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: -apple-system, Segoe UI, Roboto, sans-serif; color: #1c2024; max-width: 560px; margin: 0 auto; padding: 24px;">
+  <h2 style="margin-bottom: 4px;">Your {{.Frequency}} nano digest</h2>
+  <p style="color: #60646c; margin-top: 0;">
+    {{.Username}} &middot; {{.PeriodStart.Format "Jan 2, 2006"}}{{if ne .Frequency "daily"}} &ndash; {{.PeriodEnd.Format "Jan 2, 2006"}}{{end}}
+  </p>
+
+  <p style="font-size: 32px; font-weight: bold; margin: 16px 0 0;">{{.TotalClicks}} clicks</p>
+  <p style="color: #60646c; margin-top: 4px;">{{.PreviousClicks}} in the period before</p>
+
+  <h3>Top links</h3>
+  {{if .TopLinks}}<table style="width: 100%; border-collapse: collapse;">
+    {{range .TopLinks}}<tr>
+      <td style="padding: 4px 0;"><b>/{{.ShortURL}}</b><br><span style="color: #60646c; font-size: 12px;">{{.URL}}</span></td>
+      <td style="text-align: right;">{{.Clicks}}</td>
+    </tr>{{end}}
+  </table>{{else}}<p style="color: #60646c;">No clicks this period.</p>{{end}}
+
+  {{if .Movers}}<h3>Biggest movers</h3>
+  <table style="width: 100%; border-collapse: collapse;">
+    {{range .Movers}}<tr>
+      <td style="padding: 4px 0;"><b>/{{.ShortURL}}</b></td>
+      <td style="text-align: right; color: {{if gt .Change 0}}#18794e{{else}}#ce2c31{{end}};">{{if gt .Change 0}}+{{end}}{{.Change}} ({{.PreviousClicks}} &rarr; {{.Clicks}})</td>
+    </tr>{{end}}
+  </table>{{end}}
+
+  {{if .NewLinks}}<h3>New links</h3>
+  <ul style="padding-left: 18px;">
+    {{range .NewLinks}}<li><b>/{{.ShortURL}}</b> &rarr; {{.URL}} ({{.Clicks}} clicks)</li>{{end}}
+  </ul>{{end}}
+
+  <p style="margin-top: 24px;"><a href="{{.DashboardURL}}">Open your dashboard</a></p>
+  <p style="color: #8b8d98; font-size: 12px; margin-top: 32px;">
+    You're receiving this because a {{.Frequency}} digest was set up for this address.
+    <a href="{{.UnsubscribeURL}}" style="color: #8b8d98;">Unsubscribe</a>
+  </p>
+</body>
+</html>`))
+
+func RenderDigest(digest *Digest) (string, error) {
+	var buf bytes.Buffer
+	if err := digestTemplate.Execute(&buf, digest); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultPfpURL is the picture accounts start with. Every account shares the
+// one file, so it's never removed or exported.
+const DefaultPfpURL = "/images/default_pfp.jpg"
+
+// UploadedPfpPath returns where an uploaded profile picture lives in
+// imageDir, or false for the default picture and URLs that aren't uploads
+func UploadedPfpPath(imageDir, pfpURL string) (string, bool) {
+	if pfpURL == DefaultPfpURL || !strings.HasPrefix(pfpURL, "/images/") {
+		return "", false
+	}
+	return filepath.Join(imageDir, filepath.Base(pfpURL)), true
+}
+
+// RemoveProfilePicture deletes an uploaded profile picture from imageDir;
+// the default picture stays
+func RemoveProfilePicture(imageDir, pfpURL string) {
+	path, ok := UploadedPfpPath(imageDir, pfpURL)
+	if !ok {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error removing profile picture %s: %v", path, err)
+	}
+}
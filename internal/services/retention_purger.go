@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/rvif/nano-url/db"
+	"github.com/rvif/nano-url/internal/db/queries"
+	"github.com/rvif/nano-url/internal/metrics"
+)
+
+// RetentionPurger enforces the click-level retention period: raw url_clicks
+// rows (and their conversions) older than it are rolled up into
+// url_click_rollups and deleted. Every run is written to retention_runs so
+// there is a record of what was removed and when.
+type RetentionPurger struct {
+	retentionDays int
+	interval      time.Duration
+	stop          chan bool
+	isRunning     bool
+}
+
+func NewRetentionPurger(retentionDays int, interval time.Duration) *RetentionPurger {
+	log.Printf("Creating retention purger (keep %d days of raw clicks, check every %v)", retentionDays, interval)
+	return &RetentionPurger{
+		retentionDays: retentionDays,
+		interval:      interval,
+		stop:          make(chan bool),
+		isRunning:     false,
+	}
+}
+
+func (p *RetentionPurger) Start() {
+	if p.isRunning {
+		log.Println("Retention purger is already running")
+		return
+	}
+
+	log.Println("Starting retention purger...")
+	p.isRunning = true
+
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+				if _, err := p.RunNow(ctx); err != nil {
+					log.Printf("Error purging expired click data: %v", err)
+				}
+				cancel()
+			case <-p.stop:
+				log.Println("Retention purger stopped")
+				p.isRunning = false
+				return
+			}
+		}
+	}()
+}
+
+func (p *RetentionPurger) Stop() {
+	if !p.isRunning {
+		log.Println("Retention purger is not running")
+		return
+	}
+
+	log.Println("Stopping retention purger...")
+	p.stop <- true
+}
+
+func (p *RetentionPurger) IsRunning() bool {
+	return p.isRunning
+}
+
+func (p *RetentionPurger) RetentionDays() int {
+	return p.retentionDays
+}
+
+// RunNow purges everything clicked before the start of the UTC day
+// retentionDays ago, so whole days are rolled up at once. The rollup and the
+// delete share a transaction; the run is recorded either way.
+func (p *RetentionPurger) RunNow(ctx context.Context) (queries.RetentionRun, error) {
+	started := time.Now()
+	today := UTCDay(started)
+	cutoff := today.AddDate(0, 0, -p.retentionDays)
+
+	rollups, conversions, clicks, err := p.purge(ctx, cutoff)
+
+	params := queries.CreateRetentionRunParams{
+		Cutoff:             cutoff,
+		ClicksDeleted:      clicks,
+		ConversionsDeleted: conversions,
+		RollupRows:         rollups,
+		DurationMs:         time.Since(started).Milliseconds(),
+	}
+	if err != nil {
+		params.Error = sql.NullString{String: err.Error(), Valid: true}
+	} else {
+		metrics.RetentionDeleted.WithLabelValues("clicks").Add(float64(clicks))
+		metrics.RetentionDeleted.WithLabelValues("conversions").Add(float64(conversions))
+		log.Printf("Purged %d clicks and %d conversions older than %s into %d rollup rows",
+			clicks, conversions, cutoff.Format("2006-01-02"), rollups)
+	}
+
+	run, recordErr := queries.New(db.GetDB()).CreateRetentionRun(ctx, params)
+	if recordErr != nil {
+		log.Printf("Error recording retention run: %v", recordErr)
+	}
+
+	return run, err
+}
+
+func (p *RetentionPurger) purge(ctx context.Context, cutoff time.Time) (rollups, conversions, clicks int64, err error) {
+	DB := db.GetDB()
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer tx.Rollback()
+
+	q := queries.New(DB).WithTx(tx)
+
+	if rollups, err = q.RollupExpiredClicks(ctx, cutoff); err != nil {
+		return 0, 0, 0, err
+	}
+	if conversions, err = q.CountExpiredConversions(ctx, cutoff); err != nil {
+		return 0, 0, 0, err
+	}
+	// conversions go with their clicks (ON DELETE CASCADE)
+	if clicks, err = q.DeleteExpiredClicks(ctx, cutoff); err != nil {
+		return 0, 0, 0, err
+	}
+
+	return rollups, conversions, clicks, tx.Commit()
+}
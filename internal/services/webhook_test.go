@@ -0,0 +1,43 @@
+package services
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"198.18.0.1", false},
+		{"192.0.0.8", false},
+		{"192.0.2.1", false},
+		{"198.51.100.1", false},
+		{"203.0.113.1", false},
+		{"240.0.0.1", false},
+		{"255.255.255.255", false},
+		{"::1", false},
+		{"::", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"::ffff:93.184.216.34", true},
+		{"64:ff9b::a9fe:a9fe", false},
+		{"fd00::1", false},
+		{"fe80::1%eth0", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := publicIP(netip.MustParseAddr(tt.addr)); got != tt.public {
+				t.Errorf("publicIP(%s) = %v, want %v", tt.addr, got, tt.public)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+// Package sso signs users in with external OpenID Connect providers using the
+// authorization code flow with PKCE. Providers are configured by issuer URL;
+// their endpoints and signing keys come from the issuer's discovery document.
+package sso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var providerName = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// ErrInvalidIDToken is returned for an ID token that doesn't verify: bad
+// signature, wrong issuer or audience, expired, or a nonce mismatch
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+type ProviderConfig struct {
+	// lowercase name used in the login and callback URLs
+	Name        string
+	DisplayName string
+	Issuer      string
+	ClientID    string
+	// empty for public clients, which rely on PKCE alone
+	ClientSecret string
+	Scopes       []string
+	RedirectURL  string
+}
+
+// ConfigFromEnv reads the providers named in OIDC_PROVIDERS (comma-separated)
+// from OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET and
+// the optional OIDC_<NAME>_DISPLAY_NAME and OIDC_<NAME>_SCOPES. Callbacks
+// land on <apiURL>/auth/oidc/<name>/callback.
+func ConfigFromEnv(apiURL string) ([]ProviderConfig, error) {
+	var configs []ProviderConfig
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !providerName.MatchString(name) {
+			return nil, fmt.Errorf("invalid provider name %q", name)
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		cfg := ProviderConfig{
+			Name:         name,
+			DisplayName:  os.Getenv(prefix + "DISPLAY_NAME"),
+			Issuer:       strings.TrimSuffix(os.Getenv(prefix+"ISSUER"), "/"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+			RedirectURL:  fmt.Sprintf("%s/auth/oidc/%s/callback", strings.TrimSuffix(apiURL, "/"), name),
+		}
+		if cfg.Issuer == "" || cfg.ClientID == "" {
+			return nil, fmt.Errorf("provider %s: %sISSUER and %sCLIENT_ID are required", name, prefix, prefix)
+		}
+		if cfg.DisplayName == "" {
+			cfg.DisplayName = name
+		}
+		if scopes := os.Getenv(prefix + "SCOPES"); scopes != "" {
+			cfg.Scopes = strings.Fields(strings.ReplaceAll(scopes, ",", " "))
+		}
+
+		configs = append(configs, cfg)
+	}
+	return configs, nil
+}
+
+// Registry holds the configured providers, in configuration order
+type Registry struct {
+	providers map[string]*Provider
+	order     []string
+}
+
+func NewRegistry(configs []ProviderConfig) *Registry {
+	r := &Registry{providers: make(map[string]*Provider)}
+	for _, cfg := range configs {
+		if _, exists := r.providers[cfg.Name]; exists {
+			continue
+		}
+		r.providers[cfg.Name] = &Provider{config: cfg}
+		r.order = append(r.order, cfg.Name)
+	}
+	return r
+}
+
+func (r *Registry) Get(name string) (*Provider, bool) {
+	if r == nil {
+		return nil, false
+	}
+	p, ok := r.providers[name]
+	return p, ok
+}
+
+func (r *Registry) List() []*Provider {
+	if r == nil {
+		return nil
+	}
+	list := make([]*Provider, 0, len(r.order))
+	for _, name := range r.order {
+		list = append(list, r.providers[name])
+	}
+	return list
+}
+
+// Provider is one OpenID Connect provider. Discovery happens on first use and
+// is retried on the next login if the provider was unreachable.
+type Provider struct {
+	config ProviderConfig
+
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+func (p *Provider) Name() string        { return p.config.Name }
+func (p *Provider) DisplayName() string { return p.config.DisplayName }
+func (p *Provider) Issuer() string      { return p.config.Issuer }
+
+// the discovered provider outlives any one request: its key set refetches
+// keys with the context it was created with
+var discoveryClient = &http.Client{Timeout: 10 * time.Second}
+
+func (p *Provider) discover() (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.oauth != nil {
+		return p.oauth, p.verifier, nil
+	}
+
+	ctx := oidc.ClientContext(context.Background(), discoveryClient)
+	provider, err := oidc.NewProvider(ctx, p.config.Issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("discovering %s: %w", p.config.Issuer, err)
+	}
+
+	p.oauth = &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  p.config.RedirectURL,
+		Scopes:       p.config.Scopes,
+	}
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.config.ClientID})
+	return p.oauth, p.verifier, nil
+}
+
+// AuthCodeURL is where the browser is sent to sign in. The PKCE verifier and
+// nonce have to be presented again when the code comes back.
+func (p *Provider) AuthCodeURL(state, nonce, codeVerifier string) (string, error) {
+	config, _, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+	return config.AuthCodeURL(state,
+		oidc.Nonce(nonce),
+		oauth2.S256ChallengeOption(codeVerifier),
+	), nil
+}
+
+// Identity is who the provider says signed in
+type Identity struct {
+	// stable ID of the user at the issuer; the email can change, this can't
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Username      string
+}
+
+// Exchange redeems the authorization code and verifies the ID token that
+// comes with it against the provider's published keys
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error) {
+	config, verifier, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := config.Exchange(oidc.ClientContext(ctx, discoveryClient), code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("exchanging code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, fmt.Errorf("%w: no id_token in token response", ErrInvalidIDToken)
+	}
+
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	var claims struct {
+		Email             string `json:"email"`
+		EmailVerified     any    `json:"email_verified"`
+		Name              string `json:"name"`
+		PreferredUsername string `json:"preferred_username"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	return &Identity{
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claimTrue(claims.EmailVerified),
+		Name:          claims.Name,
+		Username:      claims.PreferredUsername,
+	}, nil
+}
+
+// some providers send email_verified as a string
+func claimTrue(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
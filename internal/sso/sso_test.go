@@ -0,0 +1,161 @@
+package sso_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/rvif/nano-url/internal/sso"
+	"github.com/rvif/nano-url/internal/sso/ssotest"
+	"golang.org/x/oauth2"
+)
+
+const redirectURL = "http://api.test/api/v1/auth/oidc/mock/callback"
+
+func newProvider(t *testing.T) (*ssotest.Provider, *sso.Provider) {
+	t.Helper()
+
+	mock := ssotest.NewProvider(t, "nano")
+	mock.User = ssotest.Claims{
+		Subject:           "user-1",
+		Email:             "ada@example.com",
+		EmailVerified:     true,
+		Name:              "Ada",
+		PreferredUsername: "ada",
+	}
+
+	registry := sso.NewRegistry([]sso.ProviderConfig{{
+		Name:        "mock",
+		DisplayName: "Mock",
+		Issuer:      mock.URL,
+		ClientID:    "nano",
+		Scopes:      []string{"openid", "email", "profile"},
+		RedirectURL: redirectURL,
+	}})
+	provider, ok := registry.Get("mock")
+	if !ok {
+		t.Fatal("mock provider not registered")
+	}
+	return mock, provider
+}
+
+// signIn starts a sign-in and returns the code the provider sends back
+func signIn(t *testing.T, mock *ssotest.Provider, provider *sso.Provider, state, nonce, verifier string) string {
+	t.Helper()
+
+	authURL, err := provider.AuthCodeURL(state, nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code, returnedState, err := mock.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	if returnedState != state {
+		t.Fatalf("state came back as %q, want %q", returnedState, state)
+	}
+	return code
+}
+
+func TestAuthCodeURLSendsPKCEChallengeAndNonce(t *testing.T) {
+	_, provider := newProvider(t)
+
+	authURL, err := provider.AuthCodeURL("state-1", "nonce-1", oauth2.GenerateVerifier())
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parsing %q: %v", authURL, err)
+	}
+
+	query := parsed.Query()
+	if got := query.Get("code_challenge_method"); got != "S256" {
+		t.Errorf("code_challenge_method = %q, want S256", got)
+	}
+	if query.Get("code_challenge") == "" {
+		t.Error("no code_challenge")
+	}
+	if got := query.Get("nonce"); got != "nonce-1" {
+		t.Errorf("nonce = %q, want nonce-1", got)
+	}
+	if got := query.Get("redirect_uri"); got != redirectURL {
+		t.Errorf("redirect_uri = %q, want %q", got, redirectURL)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	mock, provider := newProvider(t)
+	verifier := oauth2.GenerateVerifier()
+	code := signIn(t, mock, provider, "state-1", "nonce-1", verifier)
+
+	identity, err := provider.Exchange(context.Background(), code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	want := sso.Identity{
+		Subject:       "user-1",
+		Email:         "ada@example.com",
+		EmailVerified: true,
+		Name:          "Ada",
+		Username:      "ada",
+	}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+}
+
+func TestExchangeRejectsWrongPKCEVerifier(t *testing.T) {
+	mock, provider := newProvider(t)
+	code := signIn(t, mock, provider, "state-1", "nonce-1", oauth2.GenerateVerifier())
+
+	_, err := provider.Exchange(context.Background(), code, oauth2.GenerateVerifier(), "nonce-1")
+	if err == nil {
+		t.Fatal("code was redeemed with a verifier it wasn't issued for")
+	}
+}
+
+func TestExchangeRejectsNonceMismatch(t *testing.T) {
+	mock, provider := newProvider(t)
+	mock.Nonce = "someone-elses-nonce"
+	verifier := oauth2.GenerateVerifier()
+	code := signIn(t, mock, provider, "state-1", "nonce-1", verifier)
+
+	_, err := provider.Exchange(context.Background(), code, verifier, "nonce-1")
+	if !errors.Is(err, sso.ErrInvalidIDToken) {
+		t.Fatalf("err = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestExchangeReportsEmailVerification(t *testing.T) {
+	tests := []struct {
+		name     string
+		claim    any
+		verified bool
+	}{
+		{"bool true", true, true},
+		{"string true", "true", true},
+		{"bool false", false, false},
+		{"string false", "false", false},
+		{"missing", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, provider := newProvider(t)
+			mock.User.EmailVerified = tt.claim
+			verifier := oauth2.GenerateVerifier()
+			code := signIn(t, mock, provider, "state-1", "nonce-1", verifier)
+
+			identity, err := provider.Exchange(context.Background(), code, verifier, "nonce-1")
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+			if identity.EmailVerified != tt.verified {
+				t.Errorf("EmailVerified = %v, want %v", identity.EmailVerified, tt.verified)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package tokens
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWK is the public half of a signing key, as published in the JWK set
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists every key tokens may currently be signed with: the active one
+// and retired ones whose tokens haven't all expired. HS256 tokens can't be
+// verified by anyone but us and are never published.
+func (s *Service) JWKS() JWKSet {
+	set := JWKSet{Keys: make([]JWK, 0, len(s.order))}
+	for _, kid := range s.order {
+		set.Keys = append(set.Keys, s.keys[kid].jwk())
+	}
+	return set
+}
+
+// JWKSHandler serves the JWK set for /.well-known/jwks.json
+func (s *Service) JWKSHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// verifiers refetch on an unknown kid, so a short cache is enough
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(s.JWKS())
+	})
+}
+
+func (k *Key) jwk() JWK {
+	jwk := JWK{Use: "sig", Alg: k.Method.Alg(), Kid: k.ID}
+	switch pub := k.Public.(type) {
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = b64(pub)
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = b64(pub.N.Bytes())
+		jwk.E = b64(big.NewInt(int64(pub.E)).Bytes())
+	}
+	return jwk
+}
+
+func parsePEMKeys(data []byte) ([]*Key, error) {
+	var keys []*Key
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		key, err := parsePEMBlock(block)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no PEM keys found")
+	}
+	return keys, nil
+}
+
+func parsePEMBlock(block *pem.Block) (*Key, error) {
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", parsed)
+		}
+		return newKey(signer.Public(), signer)
+	case "RSA PRIVATE KEY":
+		parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newKey(parsed.Public(), parsed)
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newKey(parsed, nil)
+	case "RSA PUBLIC KEY":
+		parsed, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newKey(parsed, nil)
+	}
+	return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
+
+// newKey picks the algorithm from the key type and names the key by its
+// RFC 7638 thumbprint, so the kid never has to be configured separately
+func newKey(public crypto.PublicKey, private crypto.Signer) (*Key, error) {
+	var method jwt.SigningMethod
+	var thumbprintInput string
+
+	switch pub := public.(type) {
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+		thumbprintInput = fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%s"}`, b64(pub))
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		method = jwt.SigningMethodRS256
+		thumbprintInput = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, b64(big.NewInt(int64(pub.E)).Bytes()), b64(pub.N.Bytes()))
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, use Ed25519 or RSA", public)
+	}
+
+	sum := sha256.Sum256([]byte(thumbprintInput))
+	return &Key{
+		ID:      b64(sum[:]),
+		Method:  method,
+		Public:  public,
+		private: private,
+	}, nil
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
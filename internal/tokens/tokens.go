@@ -0,0 +1,330 @@
+// Package tokens issues and verifies nano's JWTs. Tokens carry the standard
+// registered claims (iss, sub, aud, exp, nbf, iat, jti) and are signed with an
+// Ed25519 (EdDSA) or RSA (RS256) key named in the kid header, so other
+// services can verify them against the keys published as a JWK set.
+package tokens
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// audiences of the single-purpose tokens, so none of them can be used as an
+// access token or for each other's purpose
+const (
+	StatsShareAudience        = "nano-public-stats"
+	EmailVerificationAudience = "nano-email-verification"
+)
+
+// how far a verifier's clock may lag ours before nbf/iat reject a fresh token
+const clockSkew = 30 * time.Second
+
+// HS256 secrets shorter than this can be brute-forced from a single token
+const minSecretLength = 32
+
+// placeholder secrets from old defaults and .env.example
+var placeholderSecrets = []string{"ur-kept-secret", "YOUR_JWT_SECRET"}
+
+type Config struct {
+	Issuer   string
+	Audience string
+	// PEM private key (PKCS#8 Ed25519 or RSA, or PKCS#1 RSA), or a path to one
+	SigningKey string
+	// PEM public keys of retired signing keys that are still accepted, or a
+	// comma-separated list of paths to them
+	VerifyKeys string
+	// HS256 secret, used to sign when there's no SigningKey and to accept
+	// tokens signed before one was configured
+	Secret string
+}
+
+// ConfigFromEnv reads JWT_ISSUER, JWT_AUDIENCE, JWT_SIGNING_KEY,
+// JWT_VERIFY_KEYS and JWT_SECRET
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Issuer:     os.Getenv("JWT_ISSUER"),
+		Audience:   os.Getenv("JWT_AUDIENCE"),
+		SigningKey: os.Getenv("JWT_SIGNING_KEY"),
+		VerifyKeys: os.Getenv("JWT_VERIFY_KEYS"),
+		Secret:     os.Getenv("JWT_SECRET"),
+	}
+	if cfg.Issuer == "" {
+		cfg.Issuer = "nano-url"
+	}
+	if cfg.Audience == "" {
+		cfg.Audience = "nano-url"
+	}
+	return cfg
+}
+
+type Service struct {
+	issuer   string
+	audience string
+
+	signing *Key            // nil when tokens are signed with the HS256 secret
+	keys    map[string]*Key // every accepted asymmetric key by kid, signing key included
+	order   []string        // kids in the order they're published
+	secret  []byte
+}
+
+func NewService(cfg Config) (*Service, error) {
+	s := &Service{
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+		keys:     make(map[string]*Key),
+	}
+	if cfg.Secret != "" {
+		s.secret = []byte(cfg.Secret)
+	}
+
+	if cfg.SigningKey != "" {
+		keys, err := loadKeys(cfg.SigningKey)
+		if err != nil {
+			return nil, fmt.Errorf("signing key: %w", err)
+		}
+		if len(keys) != 1 || keys[0].private == nil {
+			return nil, errors.New("signing key: expected exactly one private key")
+		}
+		s.signing = keys[0]
+		s.addKey(keys[0])
+	}
+
+	if cfg.VerifyKeys != "" {
+		keys, err := loadKeys(cfg.VerifyKeys)
+		if err != nil {
+			return nil, fmt.Errorf("verify keys: %w", err)
+		}
+		for _, key := range keys {
+			s.addKey(key)
+		}
+	}
+
+	if s.signing == nil && s.secret == nil {
+		return nil, errors.New("neither JWT_SIGNING_KEY nor JWT_SECRET is set")
+	}
+
+	return s, nil
+}
+
+func (s *Service) addKey(key *Key) {
+	if _, exists := s.keys[key.ID]; exists {
+		return
+	}
+	s.keys[key.ID] = key
+	s.order = append(s.order, key.ID)
+}
+
+// Algorithm names what new tokens are signed with
+func (s *Service) Algorithm() string {
+	if s.signing != nil {
+		return s.signing.Method.Alg()
+	}
+	return jwt.SigningMethodHS256.Alg()
+}
+
+// WeakSecret reports whether an HS256 secret is accepted that is a known
+// placeholder or too short. It matters even with a signing key, since tokens
+// signed with the secret are still accepted then.
+func (s *Service) WeakSecret() bool {
+	if s.secret == nil {
+		return false
+	}
+	for _, placeholder := range placeholderSecrets {
+		if string(s.secret) == placeholder {
+			return true
+		}
+	}
+	return len(s.secret) < minSecretLength
+}
+
+// AccessClaims are the claims of an access token. The subject is the user ID.
+type AccessClaims struct {
+	SessionID string `json:"sid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+func (s *Service) IssueAccessToken(userID, sessionID, jti uuid.UUID, expiresAt time.Time) (string, error) {
+	now := time.Now()
+	return s.sign(AccessClaims{
+		SessionID: sessionID.String(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer,
+			Subject:   userID.String(),
+			Audience:  jwt.ClaimStrings{s.audience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        jti.String(),
+		},
+	})
+}
+
+func (s *Service) ParseAccessToken(tokenStr string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	if err := s.parse(tokenStr, claims, s.audience); err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" || claims.ID == "" {
+		return nil, jwt.ErrTokenRequiredClaimMissing
+	}
+	return claims, nil
+}
+
+// ShareClaims unlock one link's public stats page. Bumping the link's share
+// version revokes every token issued under the old one.
+type ShareClaims struct {
+	URLID   string `json:"url_id"`
+	Version int32  `json:"ver"`
+	jwt.RegisteredClaims
+}
+
+func (s *Service) IssueShareToken(urlID uuid.UUID, version int32, expiresAt time.Time) (string, error) {
+	now := time.Now()
+	return s.sign(ShareClaims{
+		URLID:   urlID.String(),
+		Version: version,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer,
+			Audience:  jwt.ClaimStrings{StatsShareAudience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	})
+}
+
+func (s *Service) ParseShareToken(tokenStr string) (*ShareClaims, error) {
+	claims := &ShareClaims{}
+	if err := s.parse(tokenStr, claims, StatsShareAudience); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// EmailVerificationClaims prove the holder received mail at Email. The
+// subject is the user ID.
+type EmailVerificationClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+func (s *Service) IssueEmailVerificationToken(userID uuid.UUID, email string, expiresAt time.Time) (string, error) {
+	now := time.Now()
+	return s.sign(EmailVerificationClaims{
+		Email: email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer,
+			Subject:   userID.String(),
+			Audience:  jwt.ClaimStrings{EmailVerificationAudience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	})
+}
+
+func (s *Service) ParseEmailVerificationToken(tokenStr string) (*EmailVerificationClaims, error) {
+	claims := &EmailVerificationClaims{}
+	if err := s.parse(tokenStr, claims, EmailVerificationAudience); err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" || claims.Email == "" {
+		return nil, jwt.ErrTokenRequiredClaimMissing
+	}
+	return claims, nil
+}
+
+func (s *Service) sign(claims jwt.Claims) (string, error) {
+	if s.signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	}
+
+	token := jwt.NewWithClaims(s.signing.Method, claims)
+	token.Header["kid"] = s.signing.ID
+	return token.SignedString(s.signing.private)
+}
+
+func (s *Service) parse(tokenStr string, claims jwt.Claims, audience string) error {
+	methods := []string{}
+	for _, kid := range s.order {
+		methods = append(methods, s.keys[kid].Method.Alg())
+	}
+	if s.secret != nil {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+
+	token, err := jwt.ParseWithClaims(tokenStr, claims, s.keyFunc,
+		jwt.WithValidMethods(methods),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return err
+	}
+	if !token.Valid {
+		return jwt.ErrTokenSignatureInvalid
+	}
+	return nil
+}
+
+// keyFunc picks the verification key by kid. A key only verifies the
+// algorithm it was loaded for, so an RSA public key can't be replayed as an
+// HMAC secret.
+func (s *Service) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok && s.secret != nil {
+			return s.secret, nil
+		}
+		return nil, jwt.ErrTokenUnverifiable
+	}
+
+	key, ok := s.keys[kid]
+	if !ok || key.Method.Alg() != token.Method.Alg() {
+		return nil, jwt.ErrTokenUnverifiable
+	}
+	return key.Public, nil
+}
+
+// Key is one asymmetric key, identified by its RFC 7638 thumbprint
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Public  crypto.PublicKey
+	private crypto.Signer // nil for keys that only verify
+}
+
+// loadKeys reads PEM blocks from the value itself, or from the files it lists
+func loadKeys(value string) ([]*Key, error) {
+	if strings.Contains(value, "-----BEGIN") {
+		return parsePEMKeys([]byte(value))
+	}
+
+	var keys []*Key
+	for _, path := range strings.Split(value, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := parsePEMKeys(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		keys = append(keys, parsed...)
+	}
+	return keys, nil
+}
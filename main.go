@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -11,8 +16,12 @@ import (
 	"github.com/rvif/nano-url/db"
 
 	"github.com/rvif/nano-url/internal/handlers"
+	"github.com/rvif/nano-url/internal/mailer"
+	"github.com/rvif/nano-url/internal/metrics"
 	"github.com/rvif/nano-url/internal/middleware"
 	"github.com/rvif/nano-url/internal/services"
+	"github.com/rvif/nano-url/internal/sso"
+	"github.com/rvif/nano-url/internal/tokens"
 )
 
 func main() {
@@ -36,27 +45,83 @@ func main() {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	log.Println("Database connection successful")
+	metrics.RegisterDBStats(db.GetDB())
+
+	// Access and share tokens, signed with JWT_SIGNING_KEY (or JWT_SECRET)
+	tokenService, err := tokens.NewService(tokens.ConfigFromEnv())
+	if err != nil {
+		log.Fatalf("Failed to configure tokens: %v", err)
+	}
+	log.Printf("Signing tokens with %s", tokenService.Algorithm())
+	handlers.InitTokenService(tokenService)
 
 	// Load SMTP credentials from environment
 	username := os.Getenv("SMTP_USERNAME")
 	password := os.Getenv("SMTP_PASSWORD")
 	log.Println("Initializing mailer...")
-	handlers.InitMailer(username, password)
+	mailClient := mailer.NewMailer(username, password)
+	handlers.InitMailer(mailClient)
 
-	log.Println("Initializing daily reset service...")
+	// Redirect clicks are buffered in memory and written in batches
+	log.Println("Initializing click aggregator...")
+	clickAggregator := services.NewClickAggregator(5*time.Second, 10000)
+	clickAggregator.Start()
+	clickAggregator.RegisterMetrics()
+	handlers.InitClickAggregator(clickAggregator)
 
-	// Initialize the daily reset service
-	istLocation, err := time.LoadLocation("Asia/Kolkata")
-	if err != nil {
-		log.Printf("Error loading IST timezone: %v. Using local timezone instead.", err)
-		istLocation = time.Local
-	} else {
-		log.Printf("Successfully loaded IST timezone: %v", istLocation)
+	// Live click events for the SSE dashboards
+	clickHub := services.NewClickHub(64)
+	clickHub.RegisterMetrics()
+	handlers.InitClickHub(clickHub)
+
+	// user_analytics is derived from urls and rebuilt periodically
+	log.Println("Initializing analytics reconciler...")
+	analyticsReconciler := services.NewAnalyticsReconciler(time.Hour)
+	analyticsReconciler.Start()
+	analyticsReconciler.RegisterMetrics()
+	handlers.InitAnalyticsReconciler(analyticsReconciler)
+
+	// Raw click rows are kept CLICK_RETENTION_DAYS, then rolled up and deleted
+	retentionDays, err := strconv.Atoi(os.Getenv("CLICK_RETENTION_DAYS"))
+	if err != nil || retentionDays < 1 {
+		retentionDays = 90
 	}
+	retentionPurger := services.NewRetentionPurger(retentionDays, time.Hour)
+	retentionPurger.Start()
+	handlers.InitRetentionPurger(retentionPurger)
 
-	// Daily clicks will reset on 12:00 AM IST
-	dailyResetService := services.NewDailyResetService(istLocation)
-	dailyResetService.Start()
+	// Opt-in analytics digests, sent in each subscriber's timezone
+	apiURL := os.Getenv("API_URL")
+	if apiURL == "" {
+		apiURL = "http://localhost:8080/api/v1"
+	}
+	frontendURL := os.Getenv("FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = "https://rvif.me"
+	}
+	digestScheduler := services.NewDigestScheduler(mailClient, apiURL, frontendURL, 15*time.Minute)
+	digestScheduler.Start()
+
+	// Click threshold/anomaly alerts, delivered by email and webhook
+	alertEvaluator := services.NewAlertEvaluator(mailClient, frontendURL, time.Minute)
+	alertEvaluator.Start()
+
+	// Confirmed account deletions are carried out after a grace period
+	graceDays, err := strconv.Atoi(os.Getenv("ACCOUNT_DELETION_GRACE_DAYS"))
+	if err != nil || graceDays < 0 {
+		graceDays = 14
+	}
+	accountDeleter := services.NewAccountDeleter(mailClient, graceDays, "./public/images", time.Hour)
+	accountDeleter.Start()
+	handlers.InitAccountDeleter(accountDeleter)
+
+	// Sign-in with external OpenID Connect providers (OIDC_PROVIDERS)
+	ssoConfigs, err := sso.ConfigFromEnv(apiURL)
+	if err != nil {
+		log.Fatalf("Failed to configure sign-in providers: %v", err)
+	}
+	log.Printf("Sign-in providers configured: %d", len(ssoConfigs))
+	handlers.InitSSOProviders(sso.NewRegistry(ssoConfigs))
 
 	// Start the server
 	port := os.Getenv("PORT")
@@ -67,6 +132,7 @@ func main() {
 	log.Printf("Server starting on port: %s", port)
 
 	router := gin.Default()
+	router.Use(middleware.MetricsMiddleware())
 
 	allowedOrigins := []string{"http://localhost:5173"}
 	if os.Getenv("ENV") == "production" {
@@ -114,6 +180,9 @@ func main() {
 	})
 
 	// Routes configuration
+	// Public keys for verifying our tokens, for other services
+	router.GET("/.well-known/jwks.json", gin.WrapH(tokenService.JWKSHandler()))
+
 	v1Router := router.Group("/api/v1")
 	{
 		auth := v1Router.Group("/auth")
@@ -122,38 +191,217 @@ func main() {
 			auth.POST("/login", handlers.LoginHandler)
 			auth.POST("/forgot-password", handlers.ForgotPasswordHandler)
 			auth.POST("/reset-password", handlers.ResetPasswordHandler)
+			auth.POST("/magic-link", handlers.RequestMagicLinkHandler)
+			auth.POST("/magic-link/verify", handlers.VerifyMagicLinkHandler)
 			auth.POST("/refresh-token", handlers.RefreshTokenHandler)
+			auth.POST("/logout", middleware.AuthMiddleware(tokenService), middleware.RequireSession(), handlers.LogoutHandler)
+			auth.GET("/verify-email", handlers.VerifyEmailHandler)
+			auth.GET("/confirm-email-change", handlers.ConfirmEmailChangeHandler)
+			auth.GET("/confirm-account-deletion", handlers.ConfirmAccountDeletionHandler)
+			auth.POST("/resend-verification", middleware.AuthMiddleware(tokenService), middleware.RequireSession(), handlers.ResendVerificationHandler)
+			auth.POST("/2fa/verify", handlers.VerifyLoginChallengeHandler)
+			auth.GET("/oidc/providers", handlers.ListSSOProvidersHandler)
+			auth.GET("/oidc/:provider/login", handlers.OIDCLoginHandler)
+			auth.GET("/oidc/:provider/callback", handlers.OIDCCallbackHandler)
 		}
 
-		// Protected routes
+		// Protected routes, for signed-in users and API keys with the right scope
 		protected := v1Router.Group("")
-		protected.Use(middleware.AuthMiddleware())
+		protected.Use(middleware.AuthMiddleware(tokenService))
 		protected.GET("/me", handlers.MeHandler)
 
+		linksRead := middleware.RequireScope(middleware.ScopeLinksRead)
+		linksWrite := middleware.RequireScope(middleware.ScopeLinksWrite)
+		analyticsRead := middleware.RequireScope(middleware.ScopeAnalyticsRead)
+
+		// What unverified accounts can't do yet
+		unverifiedBlocked := os.Getenv("UNVERIFIED_BLOCKED_ACTIONS")
+		if unverifiedBlocked == "" {
+			unverifiedBlocked = middleware.DefaultUnverifiedBlocked
+		}
+		verified := middleware.NewVerifiedEmailGate(unverifiedBlocked)
+
 		// URL shortener routes
 		url := protected.Group("/url")
 		{
-			url.POST("/shorten", handlers.CreateURLHandler)
-			url.POST("/get-urls", handlers.GetURLSByUserIDHandler)
-			url.POST("/update/:url_id", handlers.UpdateShortURLHandler)
-			url.POST("/delete/:short_url", handlers.DeleteURLHandler)
-			url.POST("/analytics/:short_url", handlers.GetURLAnalyticsHandler)
+			url.POST("/shorten", linksWrite, verified.Require(middleware.ActionCreateLinks), handlers.CreateURLHandler)
+			url.POST("/get-urls", linksRead, handlers.GetURLSByUserIDHandler)
+			url.POST("/update/:url_id", linksWrite, handlers.UpdateShortURLHandler)
+			url.POST("/delete/:short_url", linksWrite, handlers.DeleteURLHandler)
+			url.POST("/analytics/:short_url", analyticsRead, handlers.GetURLAnalyticsHandler)
+			url.GET("/:slug/live", analyticsRead, handlers.LiveURLClicksHandler)
+			url.POST("/share/:short_url", linksWrite, handlers.ShareURLStatsHandler)
+			url.POST("/conversions/:short_url", linksWrite, handlers.SetConversionTrackingHandler)
+		}
+		protected.GET("/analytics", analyticsRead, handlers.GetMyAnalyticsHandler)
+		protected.GET("/analytics/heatmap", analyticsRead, handlers.HeatmapHandler)
+		protected.GET("/analytics/compare", analyticsRead, handlers.CompareLinksHandler)
+		protected.GET("/live", analyticsRead, handlers.LiveAccountClicksHandler)
+
+		// Account settings, off limits to API keys
+		account := protected.Group("", middleware.RequireSession())
+
+		// Profile
+		account.PATCH("/me", handlers.UpdateProfileHandler)
+		account.POST("/me/password", handlers.ChangePasswordHandler)
+
+		// Personal data export and account deletion
+		account.POST("/me/export", handlers.ExportAccountHandler)
+		account.DELETE("/me", handlers.RequestAccountDeletionHandler)
+		account.POST("/me/cancel-deletion", handlers.CancelAccountDeletionHandler)
+
+		// Analytics email digests
+		account.GET("/digests", handlers.ListDigestsHandler)
+		account.POST("/digests", verified.Require(middleware.ActionDigests), handlers.SubscribeDigestHandler)
+		account.DELETE("/digests/:id", handlers.DeleteDigestHandler)
+		v1Router.GET("/digests/unsubscribe", handlers.UnsubscribeDigestHandler)
+		v1Router.GET("/digests/confirm", handlers.ConfirmDigestHandler)
+
+		// Click alerts
+		account.GET("/alerts", handlers.ListAlertsHandler)
+		account.POST("/alerts", verified.Require(middleware.ActionAlerts), handlers.CreateAlertHandler)
+		account.DELETE("/alerts/:id", handlers.DeleteAlertHandler)
+
+		// Personal data settings
+		account.GET("/privacy", handlers.GetPrivacyHandler)
+		account.PUT("/privacy", handlers.UpdatePrivacyHandler)
+
+		// Signed-in devices
+		account.GET("/sessions", handlers.ListSessionsHandler)
+		account.DELETE("/sessions", handlers.RevokeAllSessionsHandler)
+		account.DELETE("/sessions/:id", handlers.RevokeSessionHandler)
+
+		// Personal API keys
+		account.GET("/api-keys", handlers.ListAPIKeysHandler)
+		account.POST("/api-keys", verified.Require(middleware.ActionAPIKeys), handlers.CreateAPIKeyHandler)
+		account.DELETE("/api-keys/:id", handlers.RevokeAPIKeyHandler)
+
+		// Two-factor authentication
+		account.GET("/2fa", handlers.TwoFactorStatusHandler)
+		account.POST("/2fa/enroll", handlers.EnrollTwoFactorHandler)
+		account.POST("/2fa/confirm", handlers.ConfirmTwoFactorHandler)
+		account.POST("/2fa/disable", handlers.DisableTwoFactorHandler)
+
+		// Linked sign-in providers
+		account.GET("/identities", handlers.ListIdentitiesHandler)
+
+		// Shared workspaces; link routes check the caller's role in the
+		// link's workspace themselves
+		account.GET("/workspaces", handlers.ListWorkspacesHandler)
+		account.POST("/workspaces", handlers.CreateWorkspaceHandler)
+		account.POST("/workspaces/invitations/accept", handlers.AcceptWorkspaceInvitationHandler)
+		account.GET("/workspaces/:workspace_id", handlers.GetWorkspaceHandler)
+		account.PATCH("/workspaces/:workspace_id", handlers.RenameWorkspaceHandler)
+		account.DELETE("/workspaces/:workspace_id", handlers.DeleteWorkspaceHandler)
+		account.GET("/workspaces/:workspace_id/privacy", handlers.GetWorkspacePrivacyHandler)
+		account.PUT("/workspaces/:workspace_id/privacy", handlers.UpdateWorkspacePrivacyHandler)
+		account.GET("/workspaces/:workspace_id/members", handlers.ListWorkspaceMembersHandler)
+		account.PUT("/workspaces/:workspace_id/members/:user_id", handlers.SetWorkspaceMemberRoleHandler)
+		account.DELETE("/workspaces/:workspace_id/members/:user_id", handlers.RemoveWorkspaceMemberHandler)
+		account.GET("/workspaces/:workspace_id/invitations", handlers.ListWorkspaceInvitationsHandler)
+		account.POST("/workspaces/:workspace_id/invitations", verified.Require(middleware.ActionInvites), handlers.InviteWorkspaceMemberHandler)
+		account.DELETE("/workspaces/:workspace_id/invitations/:invitation_id", handlers.RevokeWorkspaceInvitationHandler)
+		protected.GET("/workspaces/:workspace_id/analytics", analyticsRead, handlers.WorkspaceAnalyticsHandler)
+
+		// Admin API, for support and admin users or operators with ADMIN_TOKEN;
+		// support staff can only look
+		admin := v1Router.Group("/admin")
+		admin.Use(middleware.AdminMiddleware(tokenService, os.Getenv("ADMIN_TOKEN")))
+		{
+			adminOnly := middleware.RequireRole(middleware.RoleAdmin)
+
+			admin.GET("/stats", handlers.AdminStatsHandler)
+
+			admin.GET("/users", handlers.AdminListUsersHandler)
+			admin.GET("/users/:user_id", handlers.AdminGetUserHandler)
+			admin.POST("/users/:user_id/suspend", adminOnly, handlers.AdminSuspendUserHandler)
+			admin.POST("/users/:user_id/unsuspend", adminOnly, handlers.AdminUnsuspendUserHandler)
+			admin.PUT("/users/:user_id/role", adminOnly, handlers.AdminSetRoleHandler)
+
+			admin.GET("/links", handlers.AdminListLinksHandler)
+			admin.GET("/links/:short_url", handlers.AdminGetLinkHandler)
+			admin.POST("/links/:short_url/disable", adminOnly, handlers.AdminDisableLinkHandler)
+			admin.POST("/links/:short_url/enable", adminOnly, handlers.AdminEnableLinkHandler)
+
+			admin.POST("/analytics/recompute", adminOnly, handlers.RecomputeAnalyticsHandler)
+			admin.POST("/analytics/recompute/:user_id", adminOnly, handlers.RecomputeAnalyticsHandler)
+			admin.POST("/retention/purge", adminOnly, handlers.PurgeRetentionHandler)
+			admin.GET("/retention/runs", handlers.ListRetentionRunsHandler)
+			admin.GET("/locked-accounts", handlers.ListLockedAccountsHandler)
+			admin.DELETE("/locked-accounts/:user_id", adminOnly, handlers.UnlockAccountHandler)
 		}
-		protected.GET("/analytics", handlers.GetMyAnalyticsHandler)
 
 		v1Router.GET("/url/:slug", handlers.RedirectToURLHandler)
+		v1Router.GET("/public/stats/:slug", handlers.PublicURLStatsHandler)
+		v1Router.GET("/convert/:slug/pixel.gif", handlers.ConversionPixelHandler)
+		v1Router.GET("/convert/:slug/postback", handlers.ConversionPostbackHandler)
+		v1Router.POST("/convert/:slug/postback", handlers.ConversionPostbackHandler)
 		v1Router.GET("/health", handlers.HealthCheckHandler)
 		v1Router.GET("/", func(c *gin.Context) {
 			c.JSON(200, gin.H{"message": "Welcome to nano-url"})
 		})
 	}
 
+	// Prometheus metrics: on an internal port when METRICS_ADDR is set (e.g.
+	// 127.0.0.1:9090), otherwise on the public port behind METRICS_TOKEN
+	var metricsServer *http.Server
+	if metricsAddr := os.Getenv("METRICS_ADDR"); metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsServer = &http.Server{Addr: metricsAddr, Handler: mux}
+
+		go func() {
+			log.Printf("Serving metrics on %s/metrics", metricsAddr)
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("Error serving metrics: %v", err)
+			}
+		}()
+	} else if metricsToken := os.Getenv("METRICS_TOKEN"); metricsToken != "" {
+		router.GET("/metrics", middleware.MetricsTokenMiddleware(metricsToken), gin.WrapH(metrics.Handler()))
+		log.Println("Serving metrics on /metrics (token protected)")
+	} else {
+		log.Println("Metrics disabled, set METRICS_ADDR or METRICS_TOKEN to expose /metrics")
+	}
+
 	// Start the server with explicit address
 	address := "0.0.0.0:" + port
 	log.Printf("Binding to address: %s", address)
 
-	err = router.Run(address)
-	if err != nil {
-		log.Fatalf("ERROR starting server: %v", err)
+	server := &http.Server{
+		Addr:    address,
+		Handler: router,
+	}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("ERROR starting server: %v", err)
+		}
+	}()
+
+	// Wait for a shutdown signal so buffered clicks can be flushed before exit
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	log.Println("Shutting down server...")
+	// end open live streams first, Shutdown waits on active requests
+	clickHub.Close()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
 	}
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Error shutting down metrics server: %v", err)
+		}
+	}
+
+	accountDeleter.Stop()
+	alertEvaluator.Stop()
+	digestScheduler.Stop()
+	retentionPurger.Stop()
+	analyticsReconciler.Stop()
+	clickAggregator.Stop()
+	log.Println("Server stopped")
 }
@@ -55,7 +55,14 @@ const MyLinksPage = React.lazy(() => import("./pages/MyLinksPage"));
 const LoginPage = React.lazy(() => import("./pages/auth/LoginPage"));
 const SignupPage = React.lazy(() => import("./pages/auth/SignupPage"));
 const ResetPassword = React.lazy(() => import("./pages/auth/ResetPassword"));
+const OIDCCallbackPage = React.lazy(
+  () => import("./pages/auth/OIDCCallbackPage")
+);
+const MagicLinkPage = React.lazy(() => import("./pages/auth/MagicLinkPage"));
 const AnalyticsPage = React.lazy(() => import("./pages/AnalyticsPage"));
+const AcceptInvitationPage = React.lazy(
+  () => import("./pages/AcceptInvitationPage")
+);
 
 // Utility
 const NotFoundPage = React.lazy(() => import("./pages/utility/NotFoundPage"));
@@ -193,6 +200,19 @@ function App() {
                 }
               />
 
+              <Route
+                path="invitations/accept"
+                element={
+                  <Suspense fallback={<LoadingSpinner />}>
+                    <NavigationLoader>
+                      <ProtectedRoute>
+                        <AcceptInvitationPage />
+                      </ProtectedRoute>
+                    </NavigationLoader>
+                  </Suspense>
+                }
+              />
+
               {/* Public routes */}
               <Route
                 path="health"
@@ -289,6 +309,28 @@ function App() {
                 }
               />
 
+              <Route
+                path="oidc/callback"
+                element={
+                  <Suspense fallback={<LoadingSpinner />}>
+                    <PublicOnlyRoute>
+                      <OIDCCallbackPage />
+                    </PublicOnlyRoute>
+                  </Suspense>
+                }
+              />
+
+              <Route
+                path="magic-link"
+                element={
+                  <Suspense fallback={<LoadingSpinner />}>
+                    <PublicOnlyRoute>
+                      <MagicLinkPage />
+                    </PublicOnlyRoute>
+                  </Suspense>
+                }
+              />
+
               {/* Auth layout catch-all */}
               <Route
                 path="*"
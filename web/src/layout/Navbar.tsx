@@ -27,6 +27,7 @@ import { useLocation, useNavigate } from "react-router-dom";
 import { logout } from "../store/slices/authSlice";
 import { ProfileAvatar } from "../components/ProfileAvatar";
 import { useEffect } from "react";
+import api from "../utils/api";
 
 const Navbar = () => {
   const dispatch = useAppDispatch();
@@ -41,7 +42,13 @@ const Navbar = () => {
   const isTabActive = (path: string) => {
     return currentPath === path;
   };
-  const handleLogout = () => {
+  const handleLogout = async () => {
+    // end the session server side too, the tokens stop working everywhere
+    try {
+      await api.post("/auth/logout");
+    } catch (error) {
+      console.error("Failed to end session:", error);
+    }
     dispatch(logout());
     navigate("/");
   };
@@ -0,0 +1,66 @@
+import { Card, Em, Text } from "@radix-ui/themes";
+import { useEffect, useRef, useState } from "react";
+import { Link, useSearchParams } from "react-router-dom";
+import api from "../utils/api";
+
+// Where the link in a workspace invitation email lands. Accepting needs the
+// invited address to be signed in, so this sits behind ProtectedRoute.
+const AcceptInvitationPage = () => {
+  const [searchParams] = useSearchParams();
+  const [workspace, setWorkspace] = useState<string | null>(null);
+  const [error, setError] = useState<string | null>(null);
+  const sent = useRef(false);
+
+  useEffect(() => {
+    // the token is used up by the first request, don't send it twice
+    if (sent.current) return;
+    sent.current = true;
+
+    const token = searchParams.get("token");
+    if (!token) {
+      setError("This invitation link is incomplete");
+      return;
+    }
+
+    api
+      .post("/workspaces/invitations/accept", { token })
+      .then((response) => setWorkspace(response.data.name))
+      .catch((err) =>
+        setError(err.response?.data?.error || "Could not accept the invitation")
+      );
+  }, [searchParams]);
+
+  return (
+    <div className="flex items-center justify-center min-h-screen">
+      <Card className="max-w-md mx-auto p-5 text-center">
+        {workspace && (
+          <>
+            <Text as="div" size="2" weight="bold">
+              You joined {workspace}
+            </Text>
+            <Text as="p" className="mt-2">
+              Its links are now on <Link to="/my-links">My Links</Link>
+            </Text>
+          </>
+        )}
+        {error && (
+          <>
+            <Text as="div" size="2" weight="bold">
+              Could not join the workspace
+            </Text>
+            <Text as="p" className="mt-2">
+              {error}
+            </Text>
+          </>
+        )}
+        {!workspace && !error && (
+          <Text as="div" size="2" weight="bold">
+            <Em>Joining workspace...</Em>
+          </Text>
+        )}
+      </Card>
+    </div>
+  );
+};
+
+export default AcceptInvitationPage;
@@ -121,7 +121,7 @@ const MyLinksPage = () => {
       }
 
       try {
-        const response = await api.post("/url/get-urls", { user_id: user.id });
+        const response = await api.post("/url/get-urls", {});
 
         if (!response.data || response.data.length === 0) {
           setUrls([]);
@@ -162,7 +162,7 @@ const MyLinksPage = () => {
 
     setLoading(true);
     try {
-      const response = await api.post("/url/get-urls", { user_id: user.id });
+      const response = await api.post("/url/get-urls", {});
       // console.log(response.data);
 
       if (!response.data || response.data.length === 0) {
@@ -223,9 +223,9 @@ const MyLinksPage = () => {
 
   const deleteUrl = async (shortUrl: string) => {
     try {
-      const response = await api.post("/url/delete/:short_url", {
-        short_url: shortUrl,
-      });
+      const response = await api.post(
+        `/url/delete/${encodeURIComponent(shortUrl)}`
+      );
 
       // server returns {message: 'URL deleted'} on successful deletion
       if (response.data.message === "URL deleted") {
@@ -260,9 +260,9 @@ const MyLinksPage = () => {
         },
       }));
 
-      const response = await api.post("/url/analytics/:short_url", {
-        short_url: shortUrl,
-      });
+      const response = await api.post(
+        `/url/analytics/${encodeURIComponent(shortUrl)}`
+      );
 
       if (response.status === 200) {
         const totalClicks = response.data.total_clicks?.Int32 || 0;
@@ -330,7 +330,7 @@ const MyLinksPage = () => {
     }
 
     try {
-      const payload: any = { url_id: editingUrl.id };
+      const payload: any = {};
       if (newUrl.trim() && newUrl !== editingUrl.url) {
         payload.new_url = newUrl.trim();
       }
@@ -344,7 +344,7 @@ const MyLinksPage = () => {
         return;
       }
 
-      const response = await api.post("/url/update/:id", payload);
+      const response = await api.post(`/url/update/${editingUrl.id}`, payload);
 
       if (response.status === 200) {
         // clear edit state and reload URLs on successful update
@@ -18,7 +18,6 @@ import {
 } from "@radix-ui/themes";
 import api from "../utils/api";
 import { useState, useEffect } from "react";
-import { useAppSelector } from "../store/hooks";
 import {
   CheckCircledIcon,
   CopyIcon,
@@ -73,7 +72,6 @@ const ShortnerPage = () => {
   const [copied, setCopied] = useState(false);
   const [urlError, setUrlError] = useState<string | null>(null);
   const [customPathError, setCustomPathError] = useState<string | null>(null);
-  const { user } = useAppSelector((state) => state.auth);
 
   useEffect(() => {
     setUrlError(null);
@@ -106,7 +104,6 @@ const ShortnerPage = () => {
 
     try {
       const response = await api.post("/url/shorten", {
-        user_id: user?.id,
         url: url,
         short_url: shortUrl || undefined, // send if it has a value
       });
@@ -194,7 +194,8 @@ const ForgotPassword = () => {
                 Check your email
               </Text>
               <Text size="3" align="center">
-                We've sent a password reset link to <strong>{email}</strong>
+                If <strong>{email}</strong> has an account, we've sent it a
+                password reset link
               </Text>
               <Text size="2" color="gray" align="center">
                 If you don't see it, check your spam folder
@@ -36,8 +36,35 @@ const LoginPage = () => {
   const [rememberMe, setRememberMe] = useState(false);
   const [errorMessage, setErrorMessage] = useState("");
   const [formSubmitting, setFormSubmitting] = useState(false);
+  // set when the password was right and the account wants a 2FA code
+  const [challengeToken, setChallengeToken] = useState("");
+  const [twoFactorCode, setTwoFactorCode] = useState("");
+  // set once a sign-in link has been asked for
+  const [magicLinkMessage, setMagicLinkMessage] = useState("");
+  const [ssoProviders, setSSOProviders] = useState<
+    { name: string; display_name: string }[]
+  >([]);
   const passwordInputRef = useRef<HTMLInputElement>(null);
 
+  useEffect(() => {
+    // provider sign-ins come back here with an error or a 2FA challenge
+    const params = new URLSearchParams(window.location.hash.slice(1));
+    if (params.get("challenge_token")) {
+      setChallengeToken(params.get("challenge_token") || "");
+    }
+    if (params.get("error")) {
+      setErrorMessage(params.get("error") || "");
+    }
+    if (window.location.hash) {
+      window.history.replaceState(null, "", window.location.pathname);
+    }
+
+    api
+      .get("/auth/oidc/providers")
+      .then((response) => setSSOProviders(response.data.providers || []))
+      .catch(() => setSSOProviders([]));
+  }, []);
+
   useEffect(() => {
     // Try localStorage first, then fallback to sessionStorage
     const registeredEmail =
@@ -103,7 +130,78 @@ const LoginPage = () => {
       setErrorMessage("");
     };
 
+  const completeLogin = (access_token: string, refresh_token: string) => {
+    // save tokens in localStorage
+    localStorage.setItem("accessToken", access_token);
+    if (rememberMe) {
+      localStorage.setItem("refreshToken", refresh_token);
+    }
+
+    // dispatch login success action to update Redux state
+    dispatch(
+      loginSuccess({
+        accessToken: access_token,
+        refreshToken: rememberMe ? refresh_token : undefined,
+      })
+    );
+
+    // console.log("Login successful!");
+    navigate("/");
+  };
+
+  const handleLoginError = (error: unknown) => {
+    setFormSubmitting(false);
+
+    if (axios.isAxiosError(error) && error.response) {
+      setErrorMessage(
+        error.response.data.error ||
+          "Login failed. Please check your credentials."
+      );
+    } else {
+      setErrorMessage("An unexpected error occurred. Please try again.");
+    }
+
+    console.error("Login error:", error);
+  };
+
+  const handleVerifyCode = async () => {
+    const code = twoFactorCode.trim();
+    if (!code) {
+      setErrorMessage("Enter the code from your authenticator app");
+      return;
+    }
+
+    setFormSubmitting(true);
+    setErrorMessage("");
+
+    try {
+      // six digits is an authenticator code, anything else a recovery code
+      const response = await api.post("/auth/2fa/verify", {
+        challenge_token: challengeToken,
+        ...(/^\d{6}$/.test(code) ? { code } : { recovery_code: code }),
+      });
+
+      const { access_token, refresh_token } = response.data;
+      completeLogin(access_token, refresh_token);
+    } catch (error) {
+      // a used-up or expired challenge means starting over from the password
+      if (
+        axios.isAxiosError(error) &&
+        error.response?.status === 401 &&
+        error.response.data.error !== "Invalid code"
+      ) {
+        setChallengeToken("");
+        setTwoFactorCode("");
+      }
+      handleLoginError(error);
+    }
+  };
+
   const handleContinue = async () => {
+    if (challengeToken) {
+      return handleVerifyCode();
+    }
+
     setShowValidation({
       email: true,
       password: true,
@@ -122,38 +220,47 @@ const LoginPage = () => {
           password: formData.password,
         });
 
-        const { access_token, refresh_token } = response.data;
-
-        // save tokens in localStorage
-        localStorage.setItem("accessToken", access_token);
-        if (rememberMe) {
-          localStorage.setItem("refreshToken", refresh_token);
+        if (response.data.two_factor_required) {
+          setChallengeToken(response.data.challenge_token);
+          setFormSubmitting(false);
+          return;
         }
 
-        // dispatch login success action to update Redux state
-        dispatch(
-          loginSuccess({
-            accessToken: access_token,
-            refreshToken: rememberMe ? refresh_token : undefined,
-          })
-        );
-
-        // console.log("Login successful!");
-        navigate("/");
+        const { access_token, refresh_token } = response.data;
+        completeLogin(access_token, refresh_token);
       } catch (error) {
-        setFormSubmitting(false);
-
-        if (axios.isAxiosError(error) && error.response) {
-          setErrorMessage(
-            error.response.data.error ||
-              "Login failed. Please check your credentials."
-          );
-        } else {
-          setErrorMessage("An unexpected error occurred. Please try again.");
-        }
+        handleLoginError(error);
+      }
+    }
+  };
 
-        console.error("Login error:", error);
+  const handleMagicLink = async () => {
+    setShowValidation((prev) => ({ ...prev, email: true }));
+    if (!validation.email) return;
+
+    setFormSubmitting(true);
+    setErrorMessage("");
+
+    try {
+      // the API sets a cookie the link only works alongside
+      const response = await api.post(
+        "/auth/magic-link",
+        { email: formData.email },
+        { withCredentials: true }
+      );
+      setMagicLinkMessage(
+        `${response.data.message}. Open it in this browser within 15 minutes.`
+      );
+    } catch (error) {
+      if (axios.isAxiosError(error) && error.response) {
+        setErrorMessage(
+          error.response.data.error || "Could not send a sign-in link"
+        );
+      } else {
+        setErrorMessage("An unexpected error occurred. Please try again.");
       }
+    } finally {
+      setFormSubmitting(false);
     }
   };
 
@@ -245,12 +352,39 @@ const LoginPage = () => {
                 </Flex>
               </Text>
 
+              {challengeToken && (
+                <>
+                  <Text size="4" weight="medium" highContrast color="iris">
+                    Authentication code
+                  </Text>
+                  <TextField.Root
+                    size="3"
+                    placeholder="6-digit code or a recovery code"
+                    color="iris"
+                    autoFocus
+                    autoComplete="one-time-code"
+                    value={twoFactorCode}
+                    onChange={(e) => {
+                      setTwoFactorCode(e.target.value);
+                      setErrorMessage("");
+                    }}
+                    disabled={formSubmitting}
+                  />
+                </>
+              )}
+
               {errorMessage && (
                 <Text size="2" style={{ color: "var(--red-11)" }}>
                   {errorMessage}
                 </Text>
               )}
 
+              {magicLinkMessage && (
+                <Text size="2" color="iris">
+                  {magicLinkMessage}
+                </Text>
+              )}
+
               <Button
                 variant="solid"
                 size="3"
@@ -264,9 +398,44 @@ const LoginPage = () => {
               >
                 Continue
               </Button>
+
+              {!challengeToken && (
+                <Button
+                  variant="ghost"
+                  size="2"
+                  color="iris"
+                  highContrast
+                  onClick={handleMagicLink}
+                  disabled={formSubmitting}
+                >
+                  Email me a sign-in link instead
+                </Button>
+              )}
             </Flex>
 
             <Flex direction="column" align="center" pb="5" px="5" gap="4">
+              {ssoProviders.length > 0 && !challengeToken && (
+                <>
+                  <Separator orientation="horizontal" size="4" />
+                  {ssoProviders.map((provider) => (
+                    <Button
+                      key={provider.name}
+                      variant="outline"
+                      size="3"
+                      radius="small"
+                      className="w-full"
+                      color="iris"
+                      highContrast
+                      disabled={formSubmitting}
+                      onClick={() => {
+                        window.location.href = `${api.defaults.baseURL}/auth/oidc/${provider.name}/login`;
+                      }}
+                    >
+                      Continue with {provider.display_name}
+                    </Button>
+                  ))}
+                </>
+              )}
               <Separator orientation="horizontal" size="4" />
               <Text size="3" weight="regular" highContrast color="iris">
                 Don't have an account?{" "}
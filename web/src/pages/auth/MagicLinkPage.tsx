@@ -0,0 +1,81 @@
+import { Flex, Spinner, Text } from "@radix-ui/themes";
+import { useEffect, useRef } from "react";
+import axios from "axios";
+import { useNavigate, useSearchParams } from "react-router-dom";
+import { useAppDispatch } from "../../store/hooks";
+import { loginSuccess } from "../../store/slices/authSlice";
+import api from "../../utils/api";
+
+// Where the link in a sign-in email lands. The API only accepts it along
+// with the nonce cookie set on the browser that asked for the link.
+const MagicLinkPage = () => {
+  const navigate = useNavigate();
+  const dispatch = useAppDispatch();
+  const [searchParams] = useSearchParams();
+  const sent = useRef(false);
+
+  useEffect(() => {
+    // the token is used up by the first request, don't send it twice
+    if (sent.current) return;
+    sent.current = true;
+
+    const token = searchParams.get("token");
+
+    // drop the token from the address bar and history
+    window.history.replaceState(null, "", window.location.pathname);
+
+    if (!token) {
+      navigate("/auth/login", { replace: true });
+      return;
+    }
+
+    api
+      .post("/auth/magic-link/verify", { token }, { withCredentials: true })
+      .then((response) => {
+        // accounts with 2FA finish on the login page, like provider sign-ins
+        if (response.data.two_factor_required) {
+          navigate(
+            `/auth/login#challenge_token=${response.data.challenge_token}`,
+            { replace: true }
+          );
+          return;
+        }
+
+        const { access_token, refresh_token } = response.data;
+        localStorage.setItem("accessToken", access_token);
+        localStorage.setItem("refreshToken", refresh_token);
+        dispatch(
+          loginSuccess({
+            accessToken: access_token,
+            refreshToken: refresh_token,
+          })
+        );
+
+        navigate("/", { replace: true });
+      })
+      .catch((error) => {
+        const message =
+          (axios.isAxiosError(error) && error.response?.data?.error) ||
+          "Could not sign in, please try again";
+        navigate(`/auth/login#error=${encodeURIComponent(message)}`, {
+          replace: true,
+        });
+      });
+  }, [dispatch, navigate, searchParams]);
+
+  return (
+    <Flex
+      align="center"
+      justify="center"
+      gap="3"
+      className="h-[calc(100vh-110px)]"
+    >
+      <Spinner size="3" />
+      <Text size="3" color="iris">
+        Signing you in...
+      </Text>
+    </Flex>
+  );
+};
+
+export default MagicLinkPage;
@@ -0,0 +1,53 @@
+import { Flex, Spinner, Text } from "@radix-ui/themes";
+import { useEffect } from "react";
+import { useNavigate } from "react-router-dom";
+import { useAppDispatch } from "../../store/hooks";
+import { loginSuccess } from "../../store/slices/authSlice";
+
+// Landing page after signing in with an external provider. The API puts the
+// tokens in the URL fragment, which never leaves the browser.
+const OIDCCallbackPage = () => {
+  const navigate = useNavigate();
+  const dispatch = useAppDispatch();
+
+  useEffect(() => {
+    const params = new URLSearchParams(window.location.hash.slice(1));
+    const access_token = params.get("access_token");
+    const refresh_token = params.get("refresh_token");
+
+    // drop the tokens from the address bar and history
+    window.history.replaceState(null, "", window.location.pathname);
+
+    if (!access_token || !refresh_token) {
+      navigate("/auth/login", { replace: true });
+      return;
+    }
+
+    localStorage.setItem("accessToken", access_token);
+    localStorage.setItem("refreshToken", refresh_token);
+    dispatch(
+      loginSuccess({
+        accessToken: access_token,
+        refreshToken: refresh_token,
+      })
+    );
+
+    navigate("/", { replace: true });
+  }, [dispatch, navigate]);
+
+  return (
+    <Flex
+      align="center"
+      justify="center"
+      gap="3"
+      className="h-[calc(100vh-110px)]"
+    >
+      <Spinner size="3" />
+      <Text size="3" color="iris">
+        Signing you in...
+      </Text>
+    </Flex>
+  );
+};
+
+export default OIDCCallbackPage;
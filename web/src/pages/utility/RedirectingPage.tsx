@@ -21,6 +21,7 @@ function RedirectingPage() {
   const [loading, setLoading] = useState(true);
   const [redirectUrl, setRedirectUrl] = useState("");
   const [countdown, setCountdown] = useState(2);
+  const [disabled, setDisabled] = useState(false);
 
   useEffect(() => {
     async function checkSlug() {
@@ -33,6 +34,11 @@ function RedirectingPage() {
         if (response.status === 404) {
           setError("URL not found");
           setLoading(false);
+        } else if (response.status === 410) {
+          // taken down by an admin
+          setDisabled(true);
+          setError("This link has been disabled");
+          setLoading(false);
         } else if (response.ok) {
           const data = await response.json();
           console.log("Redirect data received:", data);
@@ -54,11 +60,26 @@ function RedirectingPage() {
   useEffect(() => {
     if (!redirectUrl) return;
 
+    // links with conversion tracking come back with a click ID appended,
+    // so prefer the URL from the counted request when we get one
+    let destination = redirectUrl;
+
     // before redirect, make another request with type=redirect
     // to count the click just once
     async function incrementClickCount() {
       try {
-        await fetch(`${apiBaseUrl}/url/${slug}?type=redirect`);
+        // forward the visitor's referrer, the API only sees this page as referer
+        const ref = encodeURIComponent(document.referrer);
+        const variant = encodeURIComponent(
+          new URLSearchParams(window.location.search).get("variant") || ""
+        );
+        const response = await fetch(
+          `${apiBaseUrl}/url/${slug}?type=redirect&ref=${ref}&variant=${variant}`
+        );
+        if (response.ok) {
+          const data = await response.json();
+          if (data.originalURL) destination = data.originalURL;
+        }
       } catch (error) {
         console.error("Error incrementing click count:", error);
       }
@@ -71,7 +92,7 @@ function RedirectingPage() {
         if (prev <= 1) {
           clearInterval(timer);
           // Use window.location for external redirects
-          window.location.href = redirectUrl;
+          window.location.href = destination;
           return 0;
         }
         return prev - 1;
@@ -81,6 +102,21 @@ function RedirectingPage() {
     return () => clearInterval(timer);
   }, [redirectUrl, slug]);
 
+  if (disabled) {
+    return (
+      <div className="flex items-center justify-center min-h-screen">
+        <Card className="max-w-md mx-auto p-5 text-center">
+          <Text as="div" size="2" weight="bold">
+            This link has been disabled
+          </Text>
+          <Text as="p" className="mt-2">
+            It was taken down for breaking our terms of use
+          </Text>
+        </Card>
+      </div>
+    );
+  }
+
   if (error) {
     return <NotFoundPage />;
   }
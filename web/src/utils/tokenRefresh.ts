@@ -10,6 +10,24 @@ export const refreshAccessToken = async (): Promise<string | null> => {
     return null;
   }
 
+  // presenting a rotated refresh token again signs the session out, so tabs
+  // take turns and only the first one actually refreshes
+  if (navigator.locks) {
+    return navigator.locks.request("nano-url-refresh-token", () =>
+      refreshWith(refreshToken)
+    );
+  }
+  return refreshWith(refreshToken);
+};
+
+const refreshWith = async (refreshToken: string): Promise<string | null> => {
+  // another tab rotated the token while we waited, use what it stored
+  if (localStorage.getItem("refreshToken") !== refreshToken) {
+    return localStorage.getItem("refreshToken")
+      ? localStorage.getItem("accessToken")
+      : null;
+  }
+
   try {
     const response = await api.post(
       "/auth/refresh-token",
@@ -21,17 +39,24 @@ export const refreshAccessToken = async (): Promise<string | null> => {
       }
     );
 
-    const { access_token } = response.data;
+    // refresh tokens are single use, keep the one that replaced ours
+    const { access_token, refresh_token } = response.data;
     localStorage.setItem("accessToken", access_token);
+    localStorage.setItem("refreshToken", refresh_token);
     store.dispatch(
       loginSuccess({
         accessToken: access_token,
-        refreshToken,
+        refreshToken: refresh_token,
       })
     );
 
     return access_token;
-  } catch (error) {
+  } catch (error: any) {
+    // throttled, not rejected: the refresh token is still good for later
+    if (error?.response?.status === 429) {
+      return localStorage.getItem("accessToken");
+    }
+
     console.error("Failed to refresh token:", error);
     store.dispatch(logout());
     return null;
@@ -44,7 +69,7 @@ export const checkTokenExpiration = (): boolean => {
 
   try {
     const payload = JSON.parse(atob(token.split(".")[1]));
-    const expiryTime = payload.expiry * 1000; // milliseconds
+    const expiryTime = payload.exp * 1000; // milliseconds
 
     // check if the token will expire in the next hour
     return Date.now() > expiryTime - 3600000; // 3600000 ms = 1 hour